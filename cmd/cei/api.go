@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/api"
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/policy"
+)
+
+func runServer(args []string) {
+	fs := newFlagSet("server")
+	listen := fs.String("listen", "127.0.0.1:7300", "Address to listen on, or unix:<path> for a Unix socket")
+	tokenFile := fs.String("token-file", "", "Read the API token from this file, creating it with a random token if missing (default: "+api.EnvToken+", else a random token printed at start)")
+	policyPath := fs.String("policy", currentConfig().Policy, "Policy file restricting which extensions may be installed")
+	profile := addProfileFlags(fs)
+	profile.root = addRootFlags(fs)
+	parseArgs(fs, args, 0)
+
+	profileOpts, ctx, cancel := profile.setup()
+	defer cancel()
+	logger := profileOpts.Logger
+
+	opts := api.Options{Defaults: extension.InstallOptions{ProfileOptions: profileOpts}}
+	opts.Version, _ = buildVersion()
+	if *policyPath != "" {
+		var err error
+		opts.Defaults.Policy, err = policy.Load(*policyPath)
+		exitOnError(err)
+	}
+	token, generated, err := serverToken(*tokenFile)
+	exitOnError(err)
+	opts.Token = token
+
+	listener, err := serverListener(*listen)
+	exitOnError(err)
+	server := &http.Server{Handler: api.Handler(opts)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if generated {
+		fmt.Printf("Token: %s\n", token)
+	}
+	logger.Info("serving management API", "listen", listener.Addr().String())
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		exitOnError(err)
+	}
+}
+
+// serverToken returns the API token from tokenFile or the environment. Without
+// either, or when tokenFile does not exist yet, it generates one and reports so.
+func serverToken(tokenFile string) (string, bool, error) {
+	if tokenFile == "" {
+		if token := os.Getenv(api.EnvToken); token != "" {
+			return token, false, nil
+		}
+	} else if data, err := os.ReadFile(tokenFile); err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", false, fmt.Errorf("token file %s is empty", tokenFile)
+		}
+		return token, false, nil
+	} else if !os.IsNotExist(err) {
+		return "", false, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, err
+	}
+	token := hex.EncodeToString(buf)
+	if tokenFile == "" {
+		return token, true, nil
+	}
+	if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0600); err != nil {
+		return "", false, err
+	}
+	return token, false, nil
+}
+
+// serverListener listens on a TCP address or, with a unix: prefix, on a Unix
+// socket only the current user can connect to
+func serverListener(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, "unix:")
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	// A socket left behind by a previous run would make Listen fail
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	// The socket is created with mode 0600 rather than restricted afterwards,
+	// so no other user can connect in between
+	var listener net.Listener
+	err := withUmask(0177, func() (err error) {
+		listener, err = net.Listen("unix", path)
+		return err
+	})
+	return listener, err
+}
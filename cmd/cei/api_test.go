@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestServerListenerSocketMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix socket permissions are not file modes on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "cei.sock")
+
+	listener, err := serverListener("unix:" + path)
+	if err != nil {
+		t.Fatalf("serverListener() error = %v", err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("socket mode = %o, want 600", mode)
+	}
+}
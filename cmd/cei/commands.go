@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/config"
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/policy"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// exitOnError prints err and exits with status 1 if it is not nil
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runInstall(args []string) {
+	fs := newFlagSet("install")
+	pkg := addPackageFlags(fs)
+	method := addMethodFlag(fs)
+	profile := addProfileFlags(fs)
+	profile.root = addRootFlags(fs)
+	profile.volumeSerial = fs.String("volume-serial", "", "Override the volume serial number (also "+system.EnvVolumeSerial+")")
+	args = parseArgs(fs, args, 1)
+
+	zipPath, err := filepath.Abs(args[0])
+	exitOnError(err)
+
+	profileOpts, ctx, cancel := profile.setup()
+	defer cancel()
+	profileOpts.Method = *method
+	opts, err := pkg.options(profileOpts)
+	exitOnError(err)
+
+	exitOnError(extension.Install(ctx, zipPath, opts))
+	fmt.Println("✓ Extension installed successfully.")
+}
+
+func runUninstall(args []string) {
+	fs := newFlagSet("uninstall")
+	method := addMethodFlag(fs)
+	profile := addProfileFlags(fs)
+	profile.root = addRootFlags(fs)
+	args = parseArgs(fs, args, 1)
+
+	opts, ctx, cancel := profile.setup()
+	defer cancel()
+	opts.Method = *method
+
+	exitOnError(extension.Uninstall(ctx, args[0], opts))
+	fmt.Println("✓ Extension uninstalled successfully.")
+}
+
+func runList(args []string) {
+	fs := newFlagSet("list")
+	filter := addFilterFlags(fs)
+	root := addRootFlags(fs)
+	parseArgs(fs, args, 0)
+
+	opts := filter.options()
+	opts.InstallRoot = root.value()
+	installed, err := extension.List(opts)
+	exitOnError(err)
+	if len(installed) == 0 {
+		fmt.Println("No extensions installed.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tVERSION\tPROFILES")
+	for _, ext := range installed {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", ext.ID, ext.Name, orDash(ext.Version), len(ext.Profiles))
+	}
+	w.Flush()
+}
+
+func runUpdate(args []string) {
+	fs := newFlagSet("update")
+	policyPath := fs.String("policy", currentConfig().Policy, "Policy file new versions must satisfy")
+	timeout := fs.Duration("timeout", 0, "Give up after this long, e.g. 30s (default: no limit)")
+	root := addRootFlags(fs)
+	log := addLogFlags(fs)
+	args = parseArgs(fs, args, -1)
+
+	opts := extension.UpdateOptions{}
+	opts.InstallRoot = root.value()
+	opts.Logger = log.setup()
+	if *policyPath != "" {
+		var err error
+		opts.Policy, err = policy.Load(*policyPath)
+		exitOnError(err)
+	}
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	results, err := extension.Update(ctx, args, opts)
+	exitOnError(err)
+	if len(results) == 0 {
+		fmt.Println("No extensions installed.")
+		return
+	}
+
+	failed, updated := false, false
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed = true
+			fmt.Printf("✗ %s: %v\n", result.Name, result.Err)
+		case result.Skipped != "":
+			fmt.Printf("- %s skipped: %s\n", result.Name, result.Skipped)
+		case result.To != "":
+			updated = true
+			fmt.Printf("✓ %s updated from %s to %s\n", result.Name, result.From, result.To)
+		default:
+			fmt.Printf("✓ %s %s is up to date\n", result.Name, result.From)
+		}
+	}
+	if updated {
+		fmt.Println("Restart the browsers to load the new versions.")
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runWatch(args []string) {
+	fs := newFlagSet("watch")
+	interval := fs.Duration("interval", extension.DefaultWatchInterval, "How often to check profiles besides change notifications (Linux)")
+	profile := addProfileFlags(fs)
+	profile.root = addRootFlags(fs)
+	parseArgs(fs, args, 0)
+
+	opts, ctx, cancel := profile.setup()
+	defer cancel()
+
+	fmt.Println("Watching installed extensions; press Ctrl+C to stop.")
+	exitOnError(extension.Watch(ctx, extension.WatchOptions{ProfileOptions: opts, Interval: *interval}))
+}
+
+func runVerify(args []string) {
+	fs := newFlagSet("verify")
+	pkg := addPackageFlags(fs)
+	method := addMethodFlag(fs)
+	root := addRootFlags(fs)
+	args = parseArgs(fs, args, 1)
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	opts, err := pkg.options(extension.ProfileOptions{InstallRoot: root.value(), Method: *method})
+	exitOnError(err)
+
+	manifest, extensionID, err := extension.Verify(ctx, args[0], opts)
+	if err != nil {
+		printManifestError(args[0], err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ %s %s passed all checks and would be installed as %s\n", manifest.Name, manifest.Version, extensionID)
+}
+
+func runValidate(args []string) {
+	fs := newFlagSet("validate")
+	args = parseArgs(fs, args, 1)
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	manifest, err := extension.Validate(ctx, fsys.OS{}, args[0])
+	if err != nil {
+		printManifestError(args[0], err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ %s %s is valid (manifest_version %d)\n", manifest.Name, manifest.Version, manifest.ManifestVersion)
+}
+
+// printManifestError prints every manifest problem, or err itself for other errors
+func printManifestError(path string, err error) {
+	var manifestErr *extension.ManifestError
+	if errors.As(err, &manifestErr) {
+		fmt.Printf("%s: %d problem(s) found\n", path, len(manifestErr.Problems))
+		for _, problem := range manifestErr.Problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+		return
+	}
+	fmt.Printf("Error: %v\n", err)
+}
+
+func runSet(args []string) {
+	var enabled, incognito, fileAccess, pinned optionalBool
+	fs := newFlagSet("set")
+	fs.Var(&enabled, "enabled", "Enable (true) or disable (false) the extension")
+	fs.Var(&incognito, "incognito", "Allow the extension in incognito windows")
+	fs.Var(&fileAccess, "file-access", "Allow the extension to access file URLs")
+	fs.Var(&pinned, "pinned", "Pin the extension to the toolbar")
+	profile := addProfileFlags(fs)
+	profile.root = addRootFlags(fs)
+	args = parseArgs(fs, args, 1)
+
+	opts, ctx, cancel := profile.setup()
+	defer cancel()
+
+	flags := browser.ExtensionFlags{
+		Enabled:    enabled.value,
+		Incognito:  incognito.value,
+		FileAccess: fileAccess.value,
+		Pinned:     pinned.value,
+	}
+	exitOnError(extension.SetFlags(ctx, args[0], flags, opts))
+	fmt.Println("✓ Extension updated successfully.")
+}
+
+func runResign(args []string) {
+	fs := newFlagSet("resign")
+	profile := addProfileFlags(fs)
+	parseArgs(fs, args, 0)
+
+	opts, ctx, cancel := profile.setup()
+	defer cancel()
+
+	exitOnError(extension.Resign(ctx, opts))
+	fmt.Println("✓ Profiles re-signed successfully.")
+}
+
+func runRestore(args []string) {
+	fs := newFlagSet("restore")
+	profile := addProfileFlags(fs)
+	parseArgs(fs, args, 0)
+
+	opts, ctx, cancel := profile.setup()
+	defer cancel()
+
+	exitOnError(extension.Restore(ctx, opts))
+	fmt.Println("✓ Profiles restored successfully.")
+}
+
+func runBrowsers(args []string) {
+	fs := newFlagSet("browsers")
+	parseArgs(fs, args, 0)
+
+	browsers := browser.DetectChromiumBrowsers(fsys.OS{})
+	if len(browsers) == 0 {
+		fmt.Println("No Chromium-based browsers found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tBROWSER\tUSER DATA\tAPPLICATION")
+	for _, b := range browsers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.Name, b.DisplayName, b.ProfilePath, orDash(b.AppPath))
+	}
+	w.Flush()
+}
+
+func runProfiles(args []string) {
+	browsers := listFlag{values: currentConfig().Browsers}
+	fs := newFlagSet("profiles")
+	fs.Var(&browsers, "browser", "Only list profiles of these browsers, e.g. chrome,edge (repeatable)")
+	parseArgs(fs, args, 0)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BROWSER\tPROFILE\tNAME\tPATH")
+	for _, b := range browser.DetectChromiumBrowsers(fsys.OS{}) {
+		if len(browsers.values) > 0 && !utils.Contains(browsers.values, b.Name) {
+			continue
+		}
+		profiles, err := browser.GetProfiles(b)
+		if err != nil {
+			continue
+		}
+		for _, profile := range profiles {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.Name, profile.Dir, orDash(profile.Name), profile.Path)
+		}
+	}
+	w.Flush()
+}
+
+// orDash returns s, or "-" if it is empty, for table output
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func runConfig(args []string) {
+	fs := newFlagSet("config")
+	asJSON := fs.Bool("json", false, "Print the settings as JSON")
+	args = parseArgs(fs, args, 1)
+	if args[0] != "show" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Built-in defaults for settings that are not set
+	defaults := map[string]string{
+		"install_root": extension.DefaultInstallRoot(fsys.OS{}),
+		"browsers":     "all",
+		"profiles":     "all",
+		"backup_dir":   filepath.Join("<profile>", browser.BackupDirName),
+		"policy":       "none",
+		"log.level":    "info",
+		"log.format":   "text",
+		"log.file":     "stderr",
+	}
+
+	settings := currentConfig().Settings()
+	for i := range settings {
+		if settings[i].Source == "" {
+			settings[i].Value, settings[i].Source = defaults[settings[i].Name], "default"
+		}
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(settings, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE\tENVIRONMENT")
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, s.Value, s.Source, s.Env)
+	}
+	w.Flush()
+
+	fmt.Println()
+	for _, file := range []struct{ kind, path string }{
+		{"System config", config.SystemPath(fsys.OS{})},
+		{"User config", config.UserPath(fsys.OS{})},
+	} {
+		status := "not found"
+		if fsys.Exists(fsys.OS{}, file.path) {
+			status = "loaded"
+		}
+		fmt.Printf("%s: %s (%s)\n", file.kind, file.path, status)
+	}
+}
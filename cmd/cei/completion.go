@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/config"
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// completeCommand is the hidden command the completion scripts call for dynamic candidates
+const completeCommand = "__complete"
+
+// completions returns the candidates of one kind: "browsers", "profiles" or
+// "extensions", the latter found in installRoot or the default install root
+func completions(fs fsys.FS, installRoot, kind string) ([]string, error) {
+	var candidates []string
+	switch kind {
+	case "browsers":
+		for _, b := range browser.DetectChromiumBrowsers(fs) {
+			candidates = append(candidates, b.Name)
+		}
+		if len(candidates) == 0 {
+			candidates = browser.Names()
+		}
+	case "profiles":
+		for _, b := range browser.DetectChromiumBrowsers(fs) {
+			profiles, _ := browser.GetProfiles(b)
+			for _, profile := range profiles {
+				if !utils.Contains(candidates, profile.Dir) {
+					candidates = append(candidates, profile.Dir)
+				}
+			}
+		}
+	case "extensions":
+		installed, err := extension.List(extension.ProfileOptions{FS: fs, InstallRoot: installRoot})
+		if err != nil {
+			return nil, err
+		}
+		for _, ext := range installed {
+			candidates = append(candidates, ext.ID)
+		}
+	default:
+		return nil, fmt.Errorf("unknown completion kind %q", kind)
+	}
+	return candidates, nil
+}
+
+func runComplete(args []string) {
+	if len(args) != 1 {
+		os.Exit(2)
+	}
+
+	// Completion must not print errors, so a broken config only loses its install root
+	installRoot := ""
+	if cfg, err := config.Load(fsys.OS{}); err == nil {
+		installRoot = cfg.InstallRoot
+	}
+	candidates, err := completions(fsys.OS{}, installRoot, args[0])
+	if err != nil {
+		os.Exit(1)
+	}
+	for _, candidate := range candidates {
+		fmt.Println(candidate)
+	}
+}
+
+func runCompletion(args []string) {
+	fs := newFlagSet("completion")
+	args = parseArgs(fs, args, 1)
+
+	script, err := completionScript(args[0])
+	exitOnError(err)
+	fmt.Print(script)
+}
+
+// completionScript returns the completion script for shell
+func completionScript(shell string) (string, error) {
+	var names, described []string
+	for _, cmd := range commands() {
+		if !cmd.hidden {
+			names = append(names, cmd.name)
+			described = append(described, fmt.Sprintf("'%s:%s'", cmd.name, cmd.summary))
+		}
+	}
+
+	switch shell {
+	case "bash":
+		return fmt.Sprintf(bashCompletion, strings.Join(names, `\n`)), nil
+	case "zsh":
+		return fmt.Sprintf(zshCompletion, strings.Join(described, "\n        ")), nil
+	case "fish":
+		var sb strings.Builder
+		sb.WriteString(fishCompletion)
+		for _, cmd := range commands() {
+			if !cmd.hidden {
+				fmt.Fprintf(&sb, "complete -c cei -n __fish_use_subcommand -a %s -d '%s'\n", cmd.name, cmd.summary)
+			}
+		}
+		fmt.Fprintf(&sb, "complete -c cei -n '__fish_seen_subcommand_from help' -a '%s'\n", strings.Join(names, " "))
+		return sb.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", shell)
+	}
+}
+
+const bashCompletion = `# bash completion for cei; load with: source <(cei completion bash)
+_cei() {
+    local IFS=$'\n'
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local commands=$'%s'
+
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "$commands" -- "$cur"))
+        return
+    fi
+
+    case "$prev" in
+        -browser|--browser)
+            COMPREPLY=($(compgen -W "$(cei __complete browsers 2>/dev/null)" -- "$cur"))
+            return ;;
+        -profile|--profile)
+            COMPREPLY=($(compgen -W "$(cei __complete profiles 2>/dev/null)" -- "$cur"))
+            COMPREPLY=("${COMPREPLY[@]// /\\ }")
+            return ;;
+        -install-root|--install-root|-dir|--dir)
+            COMPREPLY=($(compgen -d -- "$cur"))
+            return ;;
+        -method|--method)
+            COMPREPLY=($(compgen -W $'preferences\nexternal\npolicy' -- "$cur"))
+            return ;;
+    esac
+
+    case "${COMP_WORDS[1]}" in
+        uninstall|set|update)
+            COMPREPLY=($(compgen -W "$(cei __complete extensions 2>/dev/null)" -- "$cur")) ;;
+        install|verify|validate)
+            COMPREPLY=($(compgen -f -- "$cur")) ;;
+        pack)
+            COMPREPLY=($(compgen -d -- "$cur")) ;;
+        completion)
+            COMPREPLY=($(compgen -W $'bash\nzsh\nfish' -- "$cur")) ;;
+        config)
+            COMPREPLY=($(compgen -W "show" -- "$cur")) ;;
+        help)
+            COMPREPLY=($(compgen -W "$commands" -- "$cur")) ;;
+    esac
+}
+complete -F _cei cei
+`
+
+const zshCompletion = `#compdef cei
+# zsh completion for cei; load with: source <(cei completion zsh)
+
+_cei() {
+    local -a commands
+    commands=(
+        %s
+    )
+
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+
+    case "${words[CURRENT-1]}" in
+        -browser|--browser)
+            compadd -- ${(f)"$(cei __complete browsers 2>/dev/null)"}
+            return ;;
+        -profile|--profile)
+            compadd -- ${(f)"$(cei __complete profiles 2>/dev/null)"}
+            return ;;
+        -install-root|--install-root|-dir|--dir)
+            _directories
+            return ;;
+        -method|--method)
+            compadd preferences external policy
+            return ;;
+    esac
+
+    case "${words[2]}" in
+        uninstall|set|update)
+            compadd -- ${(f)"$(cei __complete extensions 2>/dev/null)"} ;;
+        install|verify|validate)
+            _files ;;
+        pack)
+            _directories ;;
+        completion)
+            compadd bash zsh fish ;;
+        config)
+            compadd show ;;
+        help)
+            _describe 'command' commands ;;
+    esac
+}
+
+if [[ "$funcstack[1]" == "_cei" ]]; then
+    _cei "$@"
+else
+    compdef _cei cei
+fi
+`
+
+const fishCompletion = `# fish completion for cei; load with: cei completion fish | source
+complete -c cei -f
+complete -c cei -l browser -o browser -x -a '(cei __complete browsers 2>/dev/null)'
+complete -c cei -l profile -o profile -x -a '(cei __complete profiles 2>/dev/null)'
+complete -c cei -l install-root -o install-root -x -a '(__fish_complete_directories)'
+complete -c cei -l dir -o dir -x -a '(__fish_complete_directories)'
+complete -c cei -l method -o method -x -a 'preferences external policy'
+complete -c cei -n '__fish_seen_subcommand_from uninstall set update' -a '(cei __complete extensions 2>/dev/null)'
+complete -c cei -n '__fish_seen_subcommand_from install verify validate' -F
+complete -c cei -n '__fish_seen_subcommand_from pack' -a '(__fish_complete_directories)'
+complete -c cei -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c cei -n '__fish_seen_subcommand_from config' -a show
+`
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatalf("completionScript(%s) error = %v", shell, err)
+		}
+		for _, want := range []string{"install", "uninstall", "restore", "__complete browsers", "__complete profiles", "__complete extensions"} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s script does not mention %q", shell, want)
+			}
+		}
+		if strings.Contains(script, "make-fixture") || strings.Contains(script, "%!") {
+			t.Errorf("%s script lists hidden commands or is malformed", shell)
+		}
+	}
+
+	if _, err := completionScript("powershell"); err == nil {
+		t.Error("completionScript(powershell) should fail")
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	fs := fsys.NewMemory()
+	root := "/home/user/extensions"
+	if _, err := fixture.Build(fs, fixture.Options{Browser: "brave", Profiles: []string{"Default", "Profile 3"}}); err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+	fs.MkdirAll("/home/user/ext", 0755)
+	fs.WriteFile("/home/user/ext/manifest.json", []byte(`{"manifest_version": 3, "name": "Completed", "version": "1.0"}`), 0644)
+	opts := extension.InstallOptions{ProfileOptions: extension.ProfileOptions{FS: fs, InstallRoot: root, Logger: logging.Discard, DeviceIDs: &system.FakeProvider{SID: fixture.DefaultSID}}}
+	if err := extension.Install(context.Background(), "/home/user/ext", opts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	tests := []struct {
+		kind string
+		want []string
+	}{
+		{"browsers", []string{"brave"}},
+		{"profiles", []string{"Default", "Profile 3"}},
+		{"extensions", []string{extension.GetExtensionID("/home/user/extensions/Completed")}},
+	}
+	for _, tt := range tests {
+		got, err := completions(fs, root, tt.kind)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("completions(%s) = %v, %v, want %v", tt.kind, got, err, tt.want)
+		}
+	}
+
+	if _, err := completions(fs, root, "colors"); err == nil {
+		t.Error("completions(colors) should fail")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+// homeFS is the real file system with the home directory moved to a fixture root
+type homeFS struct {
+	fsys.OS
+	home string
+}
+
+func (h homeFS) UserHomeDir() (string, error) {
+	return h.home, nil
+}
+
+// Getenv hides XDG_CONFIG_HOME so that Linux user data goes under the fixture root
+func (h homeFS) Getenv(key string) string {
+	if key == "XDG_CONFIG_HOME" {
+		return ""
+	}
+	return h.OS.Getenv(key)
+}
+
+// runDev dispatches hidden developer commands. They are not listed in the usage text.
+func runDev(args []string) {
+	if len(args) > 0 && args[0] == "make-fixture" {
+		runMakeFixture(args[1:])
+		return
+	}
+	fmt.Println("Usage: cei dev make-fixture --dir <path> [options]")
+	os.Exit(1)
+}
+
+func runMakeFixture(args []string) {
+	fs := flag.NewFlagSet("make-fixture", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory to use as the fake home directory")
+	browserName := fs.String("browser", "chrome", "Browser to fake (chrome, brave, vivaldi, opera, chromium)")
+	version := fs.String("version", "", "Application version directory")
+	pakVersion := fs.Int("pak-version", 5, "resources.pak format version (4 or 5)")
+	seed := fs.String("seed", "", "MAC seed as hex (default: a fixed 64-byte seed)")
+	profiles := fs.String("profiles", "Default,Profile 1", "Comma-separated profile directory names")
+	sid := fs.String("sid", fixture.DefaultSID, "User SID mixed into MACs on Windows")
+	uuid := fs.String("platform-uuid", fixture.DefaultPlatformUUID, "Platform UUID mixed into MACs on macOS")
+	noApp := fs.Bool("no-app", false, "Leave out the application directory and resources.pak (for chromium on Linux)")
+	fs.Parse(args)
+
+	if *dir == "" {
+		fmt.Println("Error: --dir is required")
+		os.Exit(1)
+	}
+	home, err := filepath.Abs(*dir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := fixture.Options{
+		Browser:       *browserName,
+		Version:       *version,
+		PakVersion:    *pakVersion,
+		Profiles:      strings.Split(*profiles, ","),
+		DeviceIDs:     &system.FakeProvider{SID: *sid, UUID: *uuid},
+		NoApplication: *noApp,
+	}
+	if *seed != "" {
+		if opts.Seed, err = hex.DecodeString(*seed); err != nil {
+			fmt.Printf("Error: invalid seed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := os.MkdirAll(home, 0755); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	result, err := fixture.Build(homeFS{home: home}, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Created fake %s\n", result.Browser.DisplayName)
+	fmt.Printf("  Application: %s\n", result.Browser.AppPath)
+	fmt.Printf("  User data:   %s\n", result.Browser.ProfilePath)
+	for _, profile := range result.Profiles {
+		fmt.Printf("  Profile:     %s\n", profile)
+	}
+	fmt.Printf("\nRun cei against it with:\n  %s cei ...\n", fixtureEnv(runtime.GOOS, home, *sid, *uuid))
+}
+
+// fixtureEnv returns the environment that points cei on goos at a fixture
+// built under home
+func fixtureEnv(goos, home, sid, uuid string) string {
+	switch goos {
+	case "windows":
+		return fmt.Sprintf("USERPROFILE=%s %s=%s", home, system.EnvSID, sid)
+	case "darwin":
+		return fmt.Sprintf("HOME=%s %s=%s", home, system.EnvPlatformUUID, uuid)
+	default:
+		return fmt.Sprintf("HOME=%s XDG_CONFIG_HOME=%s", home, filepath.Join(home, ".config"))
+	}
+}
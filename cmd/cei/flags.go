@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/config"
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/policy"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+// optionalBool is a boolean flag that records whether it was set.
+// "-name" means true, "-name=false" means false, omitted leaves it nil.
+type optionalBool struct {
+	value *bool
+}
+
+func (b *optionalBool) String() string {
+	if b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.value = &v
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+// logFlags are the logging options shared by all commands
+type logFlags struct {
+	verbose *bool
+	quiet   *bool
+	level   *string
+	format  *string
+	file    *string
+}
+
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	cfg := currentConfig()
+	return &logFlags{
+		verbose: fs.Bool("v", false, "Verbose logging, including debug messages (same as --log-level debug)"),
+		quiet:   fs.Bool("q", false, "Only log warnings and errors (same as --log-level warn)"),
+		level:   fs.String("log-level", orDefault(cfg.Log.Level, "info"), "Log level: debug, info, warn or error"),
+		format:  fs.String("log-format", orDefault(cfg.Log.Format, "text"), "Log format: text or json"),
+		file:    fs.String("log-file", cfg.Log.File, "Append logs to this file instead of stderr"),
+	}
+}
+
+// setup builds the logger, makes it the slog default and returns it.
+// Invalid options print an error and exit.
+func (l *logFlags) setup() *slog.Logger {
+	level, err := logging.ParseLevel(*l.level)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if *l.verbose || *l.quiet {
+		level = logging.Level(*l.verbose, *l.quiet)
+	}
+
+	var out io.Writer = os.Stderr
+	if *l.file != "" {
+		file, err := os.OpenFile(*l.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		out = file
+	}
+
+	logger, err := logging.New(out, *l.format, level)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	return logger
+}
+
+// listFlag collects values from a repeated or comma-separated flag. The first
+// value given on the command line replaces the default from the config.
+type listFlag struct {
+	values []string
+	set    bool
+}
+
+func (l *listFlag) String() string {
+	return strings.Join(l.values, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	if !l.set {
+		l.values, l.set = nil, true
+	}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			l.values = append(l.values, item)
+		}
+	}
+	return nil
+}
+
+// filterFlags are --browser and --profile, defaulting to the config
+type filterFlags struct {
+	browsers listFlag
+	profiles listFlag
+}
+
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	cfg := currentConfig()
+	f := &filterFlags{browsers: listFlag{values: cfg.Browsers}, profiles: listFlag{values: cfg.Profiles}}
+	fs.Var(&f.browsers, "browser", "Only use these browsers, e.g. chrome,edge (repeatable)")
+	fs.Var(&f.profiles, "profile", "Only use these profile directories or names (repeatable)")
+	return f
+}
+
+// options returns profile options with the filters and the configured backup location
+func (f *filterFlags) options() extension.ProfileOptions {
+	return extension.ProfileOptions{
+		Browsers:  f.browsers.values,
+		Profiles:  f.profiles.values,
+		BackupDir: currentConfig().BackupDir,
+	}
+}
+
+// rootFlags are --install-root and --system, defaulting to the config
+type rootFlags struct {
+	root   *string
+	system *bool
+}
+
+func addRootFlags(fs *flag.FlagSet) *rootFlags {
+	return &rootFlags{
+		root:   fs.String("install-root", currentConfig().InstallRoot, `Directory extensions are copied into, or "user" or "system" (default: per-user data directory)`),
+		system: fs.Bool("system", false, "Use the system-wide install root shared by all users (same as --install-root system)"),
+	}
+}
+
+// value returns the install root setting
+func (r *rootFlags) value() string {
+	if *r.system {
+		return extension.SystemRoot
+	}
+	return *r.root
+}
+
+// addMethodFlag registers --method, the way install, uninstall and verify register extensions
+func addMethodFlag(fs *flag.FlagSet) *string {
+	return fs.String("method", extension.MethodPreferences, "Install method: preferences (signed profile preferences), external (external extension files) or policy (managed policy files)")
+}
+
+// profileFlags are the options of commands that update browser profiles
+type profileFlags struct {
+	repair  *bool
+	sid     *string
+	uuid    *string
+	jobs    *int
+	timeout *time.Duration
+	filter  *filterFlags
+	log     *logFlags
+	// root and volumeSerial are only registered by commands that need them
+	root         *rootFlags
+	volumeSerial *string
+}
+
+func addProfileFlags(fs *flag.FlagSet) *profileFlags {
+	return &profileFlags{
+		repair:  fs.Bool("repair", false, "Restore corrupt Preferences from a backup instead of skipping the profile"),
+		sid:     fs.String("sid", "", "Override the user SID (also "+system.EnvSID+")"),
+		uuid:    fs.String("platform-uuid", "", "Override the Mac platform UUID (also "+system.EnvPlatformUUID+")"),
+		jobs:    fs.Int("jobs", extension.DefaultJobs, "Number of profiles to process concurrently"),
+		timeout: fs.Duration("timeout", 0, "Give up after this long, e.g. 30s (default: no limit)"),
+		filter:  addFilterFlags(fs),
+		log:     addLogFlags(fs),
+	}
+}
+
+// setup sets up logging and returns the profile options and a context that
+// honours --timeout
+func (p *profileFlags) setup() (extension.ProfileOptions, context.Context, context.CancelFunc) {
+	volumeSerial := ""
+	if p.volumeSerial != nil {
+		volumeSerial = *p.volumeSerial
+	}
+
+	opts := p.filter.options()
+	if p.root != nil {
+		opts.InstallRoot = p.root.value()
+	}
+	opts.Repair = *p.repair
+	opts.Jobs = *p.jobs
+	opts.Logger = p.log.setup()
+	opts.DeviceIDs = deviceIDProvider(*p.sid, volumeSerial, *p.uuid)
+	ctx, cancel := commandContext(*p.timeout)
+	return opts, ctx, cancel
+}
+
+// packageFlags are the package verification options of install and verify
+type packageFlags struct {
+	sha256       *string
+	publisherKey *string
+	policy       *string
+	updateURL    *string
+	managed      *string
+}
+
+func addPackageFlags(fs *flag.FlagSet) *packageFlags {
+	return &packageFlags{
+		sha256:       fs.String("sha256", "", "Expected SHA-256 checksum of the package"),
+		publisherKey: fs.String("publisher-key", "", "Pinned CRX publisher key (PEM/DER file or base64)"),
+		policy:       fs.String("policy", currentConfig().Policy, "Policy file restricting which extensions may be installed"),
+		updateURL:    fs.String("update-url", "", "With --method external or policy, the update URL browsers download the extension from"),
+		managed:      fs.String("managed-policy", extension.ManagedForcelist, "With --method policy, write ExtensionInstallForcelist (forcelist) or ExtensionSettings (settings); fails if another policy file sets it"),
+	}
+}
+
+// options loads the pinned key and policy into install options
+func (p *packageFlags) options(profileOpts extension.ProfileOptions) (extension.InstallOptions, error) {
+	opts := extension.InstallOptions{ProfileOptions: profileOpts, SHA256: *p.sha256, UpdateURL: *p.updateURL, ManagedPolicy: *p.managed}
+	var err error
+	if *p.publisherKey != "" {
+		if opts.PublisherKey, err = crx.LoadPublicKey(*p.publisherKey); err != nil {
+			return opts, err
+		}
+	}
+	if *p.policy != "" {
+		if opts.Policy, err = policy.Load(*p.policy); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+var (
+	configOnce   sync.Once
+	loadedConfig *config.Config
+)
+
+// currentConfig returns the settings from the config files and CEI_*
+// environment variables, loading them on first use. Invalid config exits.
+func currentConfig() *config.Config {
+	configOnce.Do(func() {
+		var err error
+		if loadedConfig, err = config.Load(fsys.OS{}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+	})
+	return loadedConfig
+}
+
+// orDefault returns value, or fallback if it is empty
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -1,37 +1,205 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
+	"time"
 
-	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
 )
 
+// command is a cei subcommand
+type command struct {
+	name string
+	// args describes the positional arguments in the usage line
+	args    string
+	summary string
+	run     func(args []string)
+	// hidden commands are left out of the usage text and completion
+	hidden bool
+}
+
+// commands returns all subcommands in the order they are listed in the usage text
+func commands() []command {
+	return []command{
+		{name: "install", args: "<zip|crx|dir>", summary: "Install an extension into every browser profile", run: runInstall},
+		{name: "uninstall", args: "<name|id>", summary: "Remove an installed extension from every browser profile", run: runUninstall},
+		{name: "list", summary: "List installed extensions and the profiles using them", run: runList},
+		{name: "update", args: "[name|id...]", summary: "Update installed extensions from their update_url", run: runUpdate},
+		{name: "watch", summary: "Re-apply installed extensions when browsers drop them", run: runWatch},
+		{name: "verify", args: "<zip|crx|dir>", summary: "Run all install checks without installing", run: runVerify},
+		{name: "validate", args: "<zip|crx|dir>", summary: "Check an extension manifest", run: runValidate},
+		{name: "set", args: "<name|id>", summary: "Change extension flags such as enabled or pinned", run: runSet},
+		{name: "pack", args: "<dir>", summary: "Pack a directory into a signed CRX3 package", run: runPack},
+		{name: "resign", summary: "Recompute all profile MACs", run: runResign},
+		{name: "restore", summary: "Restore profile preferences from the newest backup", run: runRestore},
+		{name: "serve", summary: "Serve CRX packages and their update manifest over HTTP", run: runServe},
+		{name: "server", summary: "Serve a local JSON API to list, install and uninstall extensions", run: runServer},
+		{name: "update-manifest", summary: "Write the update manifest for a directory of CRX packages", run: runUpdateManifest},
+		{name: "browsers", summary: "List detected browsers", run: runBrowsers},
+		{name: "profiles", summary: "List browser profiles", run: runProfiles},
+		{name: "config", args: "show", summary: "Print the effective configuration and where each setting comes from", run: runConfig},
+		{name: "completion", args: "<bash|zsh|fish>", summary: "Print a shell completion script", run: runCompletion},
+		{name: "version", summary: "Print the version", run: runVersion},
+		{name: "help", args: "[command]", summary: "Show help for a command", run: runHelp},
+		{name: "dev", hidden: true, run: runDev},
+		{name: completeCommand, hidden: true, run: runComplete},
+	}
+}
+
+// findCommand returns the subcommand called name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
 func main() {
-	installFlag := flag.String("i", "", "Install extension from zip file")
-	uninstallFlag := flag.Bool("u", false, "Uninstall extension")
-	flag.Parse()
-
-	if *installFlag != "" {
-		zipPath, err := filepath.Abs(*installFlag)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	switch name {
+	case "-h", "-help", "--help":
+		printUsage()
+		return
+	case "-version", "--version":
+		name = "version"
+	}
+	if strings.HasPrefix(name, "-") {
+		runLegacy(os.Args[1:])
+		return
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Printf("Error: unknown command %q\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+	cmd.run(os.Args[2:])
+}
+
+func printUsage() {
+	fmt.Println("Usage: cei <command> [flags] [arguments]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, cmd := range commands() {
+		if !cmd.hidden {
+			fmt.Printf("  %-16s %s\n", cmd.name, cmd.summary)
+		}
+	}
+	fmt.Println()
+	fmt.Println(`Run "cei help <command>" for the flags of a command.`)
+}
+
+// newFlagSet returns the flag set of a subcommand; -h prints its usage, summary and flags
+func newFlagSet(name string) *flag.FlagSet {
+	cmd, _ := findCommand(name)
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: cei %s [flags] %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nFlags:")
+			fs.PrintDefaults()
 		}
-		if err := extension.Install(zipPath); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+	}
+	return fs
+}
+
+// parseArgs parses a subcommand's flags, which may come before or after its
+// arguments, and returns the positional arguments. It exits with the usage
+// text unless there are exactly want of them; a negative want accepts any number.
+func parseArgs(fs *flag.FlagSet, args []string, want int) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
 		}
-	} else if *uninstallFlag {
-		if err := extension.Uninstall("NewEngine"); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if want >= 0 && len(positional) != want {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return positional
+}
+
+func runHelp(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		return
+	}
+	cmd, ok := findCommand(args[0])
+	if !ok || cmd.hidden {
+		fmt.Printf("Error: unknown command %q\n", args[0])
+		os.Exit(2)
+	}
+	cmd.run([]string{"-h"})
+}
+
+// runLegacy keeps the original "cei -i <zip>" and "cei -u" forms working
+func runLegacy(args []string) {
+	fmt.Fprintln(os.Stderr, `Warning: "cei -i" and "cei -u" are deprecated; use "cei install" and "cei uninstall"`)
+
+	var rest []string
+	var install string
+	uninstall := false
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-u" || arg == "--u":
+			uninstall = true
+		case (arg == "-i" || arg == "--i") && i+1 < len(args):
+			install = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "-i=") || strings.HasPrefix(arg, "--i="):
+			install = arg[strings.Index(arg, "=")+1:]
+		default:
+			rest = append(rest, arg)
 		}
+	}
+
+	if install != "" {
+		runInstall(append(rest, install))
+	} else if uninstall {
+		runUninstall(append(rest, "NewEngine"))
 	} else {
-		fmt.Println("Usage:")
-		fmt.Println("  Install extension: cei -i <path_to_zip>")
-		fmt.Println("  Uninstall extensions: cei -u")
+		printUsage()
+		os.Exit(2)
+	}
+}
+
+// deviceIDProvider returns a provider honouring command-line overrides, or nil for the default
+func deviceIDProvider(sid, volumeSerial, uuid string) system.DeviceIDProvider {
+	if sid == "" && volumeSerial == "" && uuid == "" {
+		return nil
+	}
+	return system.OverrideProvider{SID: sid, VolumeSerial: volumeSerial, UUID: uuid, Fallback: system.DefaultProvider()}
+}
+
+// commandContext is canceled on Ctrl+C and, if timeout is positive, once it elapses
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
 	}
 }
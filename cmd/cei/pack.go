@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+func runPack(args []string) {
+	fs := newFlagSet("pack")
+	keyPath := fs.String("key", "", "PEM private key to sign with (default: generate <dir>.pem)")
+	output := fs.String("output", "", "Write the package to this file (default: <dir>.crx)")
+	args = parseArgs(fs, args, 1)
+
+	dir, defaultOutput, newKeyPath, err := packPaths(args[0])
+	exitOnError(err)
+	if *output == "" {
+		*output = defaultOutput
+	}
+
+	key, keyPEM, err := packKey(*keyPath, newKeyPath)
+	exitOnError(err)
+
+	data, id, err := extension.Pack(fsys.OS{}, dir, key)
+	if err != nil {
+		printManifestError(dir, err)
+		os.Exit(1)
+	}
+
+	// A new key is only kept once the package it signs has been built
+	if keyPEM != nil {
+		exitOnError(os.WriteFile(newKeyPath, keyPEM, 0600))
+	}
+	exitOnError(os.WriteFile(*output, data, 0644))
+
+	fmt.Printf("✓ Packed %s as %s\n", *output, id)
+	if keyPEM != nil {
+		fmt.Printf("  New signing key written to %s; pass it with --key to keep the same ID\n", newKeyPath)
+	}
+}
+
+// packPaths returns the absolute directory to pack and the default package
+// and key paths next to it, named after the directory, so that "." packs the
+// working directory into ../<name>.crx
+func packPaths(arg string) (string, string, string, error) {
+	dir, err := filepath.Abs(arg)
+	if err != nil {
+		return "", "", "", err
+	}
+	parent, name := filepath.Dir(dir), filepath.Base(dir)
+	if parent == dir {
+		return "", "", "", fmt.Errorf("cannot pack the root directory %s", dir)
+	}
+	return dir, filepath.Join(parent, name+".crx"), filepath.Join(parent, name+".pem"), nil
+}
+
+// packKey loads the signing key at keyPath or, without one, generates a key
+// and returns it with its PEM encoding, for the caller to write to newPath
+// once packing succeeded
+func packKey(keyPath, newPath string) (crypto.Signer, []byte, error) {
+	if keyPath != "" {
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := crx.ParsePrivateKey(data)
+		return key, nil, err
+	}
+
+	if _, err := os.Stat(newPath); err == nil {
+		return nil, nil, fmt.Errorf("%s already exists; sign with it using --key %s", newPath, newPath)
+	}
+	key, keyPEM, err := crx.GenerateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate signing key: %v", err)
+	}
+	return key, keyPEM, nil
+}
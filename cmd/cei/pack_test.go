@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackPaths(t *testing.T) {
+	// Resolved, since the working directory is reported without symlinks
+	parent, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(parent, "ext")
+	os.Mkdir(dir, 0755)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, arg := range []string{".", dir, dir + string(filepath.Separator), filepath.Join("..", "ext")} {
+		gotDir, crxPath, pemPath, err := packPaths(arg)
+		if err != nil {
+			t.Fatalf("packPaths(%q) error = %v", arg, err)
+		}
+		if gotDir != dir || crxPath != filepath.Join(parent, "ext.crx") || pemPath != filepath.Join(parent, "ext.pem") {
+			t.Errorf("packPaths(%q) = %s, %s, %s, want %s and ext.crx, ext.pem beside it", arg, gotDir, crxPath, pemPath, dir)
+		}
+	}
+}
+
+func TestPackKeyWritesNothing(t *testing.T) {
+	newPath := filepath.Join(t.TempDir(), "ext.pem")
+	key, keyPEM, err := packKey("", newPath)
+	if err != nil || key == nil || len(keyPEM) == 0 {
+		t.Fatalf("packKey() = %v, %d bytes, %v, want a new key", key, len(keyPEM), err)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("packKey() wrote %s before packing", newPath)
+	}
+}
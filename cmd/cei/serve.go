@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/update"
+)
+
+// shutdownTimeout bounds how long serve waits for requests in flight on Ctrl+C
+const shutdownTimeout = 5 * time.Second
+
+func runServe(args []string) {
+	fs := newFlagSet("serve")
+	dir := fs.String("dir", ".", "Directory of CRX packages to serve")
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to listen on")
+	baseURL := fs.String("base-url", "", "URL clients reach the server at, used in download links (default: taken from each request)")
+	log := addLogFlags(fs)
+	parseArgs(fs, args, 0)
+	logger := log.setup()
+
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		exitOnError(fmt.Errorf("%s is not a directory", *dir))
+	}
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	server := &http.Server{Addr: *listen, Handler: update.Handler(fsys.OS{}, *dir, *baseURL, logger)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("serving update manifest", "url", "http://"+*listen+update.ManifestPath, "dir", *dir)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		exitOnError(err)
+	}
+}
+
+func runUpdateManifest(args []string) {
+	fs := newFlagSet("update-manifest")
+	dir := fs.String("dir", ".", "Directory of CRX packages")
+	baseURL := fs.String("base-url", "", "URL the packages will be downloaded from (required)")
+	output := fs.String("output", "", "Write the manifest to this file instead of stdout")
+	log := addLogFlags(fs)
+	parseArgs(fs, args, 0)
+	logger := log.setup()
+
+	if *baseURL == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	packages, err := update.Index(fsys.OS{}, *dir, logger)
+	exitOnError(err)
+	data, err := update.BuildManifest(packages, *baseURL).Encode()
+	exitOnError(err)
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	exitOnError(os.WriteFile(*output, data, 0644))
+	fmt.Printf("✓ Wrote update manifest for %d extension(s) to %s\n", len(packages), *output)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// withUmask runs fn; there is no umask on this platform, and files fn creates
+// take the access rules of their directory
+func withUmask(mask int, fn func() error) error {
+	return fn()
+}
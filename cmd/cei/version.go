@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version and commit are set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=abc1234" ./cmd/cei
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// buildVersion returns the version and commit, falling back to the module
+// version and VCS revision Go embeds in the binary
+func buildVersion() (string, string) {
+	v, c := version, commit
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && c == "" {
+				c = setting.Value
+				if len(c) > 12 {
+					c = c[:12]
+				}
+			}
+		}
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	return v, c
+}
+
+func runVersion(args []string) {
+	fs := newFlagSet("version")
+	parseArgs(fs, args, 0)
+
+	v, c := buildVersion()
+	fmt.Printf("cei %s (commit %s, %s, %s/%s)\n", v, c, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
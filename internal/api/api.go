@@ -0,0 +1,356 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+)
+
+// Paths of the endpoints Handler serves
+const (
+	StatusPath    = "/v1/status"
+	ListPath      = "/v1/list"
+	InstallPath   = "/v1/install"
+	UninstallPath = "/v1/uninstall"
+	VerifyPath    = "/v1/verify"
+)
+
+// EnvToken holds the token cei server requires, unless it is given in a file
+const EnvToken = "CEI_API_TOKEN"
+
+// maxRequestSize bounds the JSON bodies Handler reads
+const maxRequestSize = 1 << 20
+
+// Options configures Handler
+type Options struct {
+	// Token must be sent with every request as "Authorization: Bearer <token>";
+	// when empty every request is rejected
+	Token string
+	// Defaults are the options each request starts from. Requests may choose
+	// the method, browsers, profiles and package checks, but not the install
+	// root or the policy.
+	Defaults extension.InstallOptions
+	// Version is reported by StatusPath
+	Version string
+}
+
+// InstallRequest is the body of InstallPath and VerifyPath requests
+type InstallRequest struct {
+	// Path is the absolute path of the zip, CRX or directory on the machine
+	// running the server
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+	// PublisherKey is the base64 DER public key the CRX must be signed with
+	PublisherKey  string   `json:"publisher_key,omitempty"`
+	Method        string   `json:"method,omitempty"`
+	UpdateURL     string   `json:"update_url,omitempty"`
+	ManagedPolicy string   `json:"managed_policy,omitempty"`
+	Browsers      []string `json:"browsers,omitempty"`
+	Profiles      []string `json:"profiles,omitempty"`
+}
+
+// UninstallRequest is the body of UninstallPath requests
+type UninstallRequest struct {
+	// Extension is the name or ID of an installed extension
+	Extension string   `json:"extension"`
+	Method    string   `json:"method,omitempty"`
+	Browsers  []string `json:"browsers,omitempty"`
+	Profiles  []string `json:"profiles,omitempty"`
+}
+
+// Extension is an installed extension as ListPath reports it
+type Extension struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Path     string   `json:"path"`
+	Profiles []string `json:"profiles"`
+}
+
+// VerifyResponse is the answer to a VerifyPath request that passed every check
+type VerifyResponse struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// BrowserStatus describes a detected browser
+type BrowserStatus struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Profiles    int    `json:"profiles"`
+	// Running is true while the browser holds the lock on its user data directory
+	Running bool `json:"running"`
+}
+
+// StatusResponse is the answer to StatusPath requests
+type StatusResponse struct {
+	Version     string          `json:"version"`
+	InstallRoot string          `json:"install_root"`
+	Extensions  int             `json:"extensions"`
+	Browsers    []BrowserStatus `json:"browsers"`
+}
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// handler serves the endpoints; mu lets one request write profiles at a
+// time, and none read them meanwhile
+type handler struct {
+	opts Options
+	mu   sync.RWMutex
+}
+
+// Handler serves the management API: status and list with GET, install,
+// uninstall and verify with POST and a JSON body. Each endpoint runs the same
+// library call as the CLI command of that name. Installs and uninstalls are
+// serialized, so concurrent requests cannot interleave writes to a profile,
+// and a request whose client goes away is canceled like a command on Ctrl+C.
+func Handler(opts Options) http.Handler {
+	h := &handler{opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc(StatusPath, h.get(h.status))
+	mux.HandleFunc(ListPath, h.get(h.list))
+	mux.HandleFunc(InstallPath, h.post(h.install))
+	mux.HandleFunc(UninstallPath, h.post(h.uninstall))
+	mux.HandleFunc(VerifyPath, h.post(h.verify))
+	return h.authenticate(mux)
+}
+
+func (h *handler) logger() *slog.Logger {
+	if h.opts.Defaults.Logger == nil {
+		return slog.Default()
+	}
+	return h.opts.Defaults.Logger
+}
+
+// authenticate rejects requests without the bearer token
+func (h *handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer " + h.opts.Token
+		got := r.Header.Get("Authorization")
+		if h.opts.Token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			h.logger().Warn("rejected unauthenticated request", "path", r.URL.Path, "remote", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// get adapts an endpoint that only takes GET requests
+func (h *handler) get(endpoint func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		endpoint(w, r)
+	}
+}
+
+// post adapts an endpoint that only takes POST requests
+func (h *handler) post(endpoint func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		endpoint(w, r)
+	}
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	opts := h.opts.Defaults.ProfileOptions
+	fs := opts.FS
+	if fs == nil {
+		fs = fsys.OS{}
+	}
+	root, err := extension.ResolveInstallRoot(fs, opts.InstallRoot)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	installed, err := extension.List(opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := StatusResponse{Version: h.opts.Version, InstallRoot: root, Extensions: len(installed), Browsers: []BrowserStatus{}}
+	for _, b := range browser.DetectChromiumBrowsers(fs) {
+		profiles, _ := browser.GetProfilePaths(b)
+		status.Browsers = append(status.Browsers, BrowserStatus{Name: b.Name, DisplayName: b.DisplayName, Profiles: len(profiles), Running: browser.IsRunning(b)})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	opts := h.opts.Defaults.ProfileOptions
+	query := r.URL.Query()
+	opts.Browsers = orDefault(query["browser"], opts.Browsers)
+	opts.Profiles = orDefault(query["profile"], opts.Profiles)
+
+	h.mu.RLock()
+	installed, err := extension.List(opts)
+	h.mu.RUnlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	extensions := make([]Extension, len(installed))
+	for i, ext := range installed {
+		extensions[i] = Extension{ID: ext.ID, Name: ext.Name, Version: ext.Version, Path: ext.Path, Profiles: ext.Profiles}
+		if extensions[i].Profiles == nil {
+			extensions[i].Profiles = []string{}
+		}
+	}
+	writeJSON(w, http.StatusOK, extensions)
+}
+
+func (h *handler) install(w http.ResponseWriter, r *http.Request) {
+	var req InstallRequest
+	opts, ok := h.installOptions(w, r, &req)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logger().Info("install requested", logging.KeyStep, "api", "path", req.Path, "remote", r.RemoteAddr)
+	if err := extension.Install(r.Context(), req.Path, opts); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (h *handler) uninstall(w http.ResponseWriter, r *http.Request) {
+	var req UninstallRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Extension == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("extension is required"))
+		return
+	}
+	opts := h.opts.Defaults.ProfileOptions
+	opts.Method = req.Method
+	opts.Browsers = orDefault(req.Browsers, opts.Browsers)
+	opts.Profiles = orDefault(req.Profiles, opts.Profiles)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logger().Info("uninstall requested", logging.KeyStep, "api", "extension", req.Extension, "remote", r.RemoteAddr)
+	if err := extension.Uninstall(r.Context(), req.Extension, opts); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// verify writes nothing but temporary files, so it runs alongside other requests
+func (h *handler) verify(w http.ResponseWriter, r *http.Request) {
+	var req InstallRequest
+	opts, ok := h.installOptions(w, r, &req)
+	if !ok {
+		return
+	}
+
+	manifest, id, err := extension.Verify(r.Context(), req.Path, opts)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, VerifyResponse{ID: id, Name: manifest.Name, Version: manifest.Version})
+}
+
+// installOptions decodes an InstallRequest into req and returns the install
+// options it selects. It answers the request itself when it is invalid.
+func (h *handler) installOptions(w http.ResponseWriter, r *http.Request, req *InstallRequest) (extension.InstallOptions, bool) {
+	opts := h.opts.Defaults
+	if !decode(w, r, req) {
+		return opts, false
+	}
+	if req.Path == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("path is required"))
+		return opts, false
+	}
+	// A relative path would depend on the server's working directory
+	if !filepath.IsAbs(req.Path) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("path must be absolute: %s", req.Path))
+		return opts, false
+	}
+
+	opts.Method = req.Method
+	opts.Browsers = orDefault(req.Browsers, opts.Browsers)
+	opts.Profiles = orDefault(req.Profiles, opts.Profiles)
+	opts.SHA256 = req.SHA256
+	opts.UpdateURL = req.UpdateURL
+	if req.ManagedPolicy != "" {
+		opts.ManagedPolicy = req.ManagedPolicy
+	}
+	if req.PublisherKey != "" {
+		key, err := base64.StdEncoding.DecodeString(req.PublisherKey)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid publisher_key: %v", err))
+			return opts, false
+		}
+		opts.PublisherKey = key
+	}
+	return opts, true
+}
+
+// decode reads a JSON request body into v, answering the request when it cannot
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(data, '\n'))
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, ErrorResponse{Error: err.Error()})
+}
+
+// orDefault returns values, or fallback if there are none
+func orDefault(values, fallback []string) []string {
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/extension"
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+const (
+	testToken       = "secret"
+	testInstallRoot = "/home/user/extensions"
+)
+
+// writeExtension writes a zip of a minimal extension called name to /home/user/Downloads
+func writeExtension(t *testing.T, fs fsys.FS, name string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.Create("manifest.json")
+	fmt.Fprintf(f, `{"manifest_version": 3, "name": %q, "version": "1.0"}`, name)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join("/home/user/Downloads", name+".zip")
+	fs.MkdirAll(filepath.Dir(path), 0755)
+	fs.WriteFile(path, buf.Bytes(), 0644)
+	return path
+}
+
+func newTestServer(t *testing.T) (*fsys.Memory, *httptest.Server) {
+	t.Helper()
+	fs := fsys.NewMemory()
+	provider := &system.FakeProvider{SID: "S-1-5-21-1-2-3-1001", VolumeSerial: "1234-ABCD"}
+	if _, err := fixture.Build(fs, fixture.Options{Profiles: []string{"Default", "Profile 1"}, DeviceIDs: provider}); err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+	defaults := extension.InstallOptions{ProfileOptions: extension.ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: testInstallRoot, Logger: logging.Discard}}
+	server := httptest.NewServer(Handler(Options{Token: testToken, Defaults: defaults, Version: "1.2.3"}))
+	t.Cleanup(server.Close)
+	return fs, server
+}
+
+// call sends a request with the test token and decodes the JSON response into
+// out. It only reports errors, so it can run in other goroutines.
+func call(t *testing.T, server *httptest.Server, method, path string, body, out interface{}) int {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Errorf("%s %s: %v", method, path, err)
+		return 0
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("%s %s Content-Type = %q", method, path, resp.Header.Get("Content-Type"))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Errorf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHandler(t *testing.T) {
+	fs, server := newTestServer(t)
+	path := writeExtension(t, fs, "Managed")
+
+	var verified VerifyResponse
+	if code := call(t, server, http.MethodPost, VerifyPath, InstallRequest{Path: path}, &verified); code != http.StatusOK {
+		t.Fatalf("verify status = %d", code)
+	}
+	wantID := extension.GetExtensionID(filepath.Join(testInstallRoot, "Managed"))
+	if verified != (VerifyResponse{ID: wantID, Name: "Managed", Version: "1.0"}) {
+		t.Errorf("verify = %+v", verified)
+	}
+
+	if code := call(t, server, http.MethodPost, InstallPath, InstallRequest{Path: path, Profiles: []string{"Default"}}, nil); code != http.StatusOK {
+		t.Fatalf("install status = %d", code)
+	}
+
+	var extensions []Extension
+	if code := call(t, server, http.MethodGet, ListPath, nil, &extensions); code != http.StatusOK {
+		t.Fatalf("list status = %d", code)
+	}
+	if len(extensions) != 1 || extensions[0].ID != wantID || len(extensions[0].Profiles) != 1 || filepath.Base(extensions[0].Profiles[0]) != "Default" {
+		t.Errorf("list = %+v, want Managed in Default", extensions)
+	}
+	if call(t, server, http.MethodGet, ListPath+"?profile=Profile+1", nil, &extensions); len(extensions) != 1 || len(extensions[0].Profiles) != 0 {
+		t.Errorf("list of Profile 1 = %+v, want Managed without profiles", extensions)
+	}
+
+	var status StatusResponse
+	if code := call(t, server, http.MethodGet, StatusPath, nil, &status); code != http.StatusOK {
+		t.Fatalf("status status = %d", code)
+	}
+	if status.Version != "1.2.3" || status.InstallRoot != testInstallRoot || status.Extensions != 1 || len(status.Browsers) != 1 || status.Browsers[0].Profiles != 2 || status.Browsers[0].Running {
+		t.Errorf("status = %+v", status)
+	}
+
+	if code := call(t, server, http.MethodPost, UninstallPath, UninstallRequest{Extension: wantID}, nil); code != http.StatusOK {
+		t.Fatalf("uninstall status = %d", code)
+	}
+	if call(t, server, http.MethodGet, ListPath, nil, &extensions); len(extensions) != 0 {
+		t.Errorf("list after uninstall = %+v, want none", extensions)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	fs, server := newTestServer(t)
+	path := writeExtension(t, fs, "Managed")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"wrong method", http.MethodGet, InstallPath, nil, http.StatusMethodNotAllowed},
+		{"missing path", http.MethodPost, InstallPath, InstallRequest{}, http.StatusBadRequest},
+		{"relative path", http.MethodPost, InstallPath, InstallRequest{Path: "Downloads/Managed.zip"}, http.StatusBadRequest},
+		{"relative verify path", http.MethodPost, VerifyPath, InstallRequest{Path: "Managed.zip"}, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, VerifyPath, map[string]string{"path": path, "root": "/"}, http.StatusBadRequest},
+		{"invalid publisher key", http.MethodPost, VerifyPath, InstallRequest{Path: path, PublisherKey: "%"}, http.StatusBadRequest},
+		{"checksum mismatch", http.MethodPost, InstallPath, InstallRequest{Path: path, SHA256: strings.Repeat("0", 64)}, http.StatusUnprocessableEntity},
+		{"unknown extension", http.MethodPost, UninstallPath, UninstallRequest{Extension: "Missing"}, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			if code := call(t, server, tt.method, tt.path, tt.body, &errResp); code != tt.want || errResp.Error == "" {
+				t.Errorf("status = %d (%q), want %d with an error", code, errResp.Error, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	_, server := newTestServer(t)
+
+	for _, header := range []string{"", "Bearer wrong", testToken} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+StatusPath, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want %d", header, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	// Without a configured token nothing is accepted
+	empty := httptest.NewServer(Handler(Options{}))
+	defer empty.Close()
+	req, _ := http.NewRequest(http.MethodGet, empty.URL+StatusPath, nil)
+	req.Header.Set("Authorization", "Bearer ")
+	resp, err := empty.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("empty token: status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerConcurrentInstalls(t *testing.T) {
+	fs, server := newTestServer(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		path := writeExtension(t, fs, fmt.Sprintf("Extension %d", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code := call(t, server, http.MethodPost, InstallPath, InstallRequest{Path: path}, nil); code != http.StatusOK {
+				t.Errorf("install %s status = %d", path, code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Interleaved writes would lose entries or break the MACs
+	var extensions []Extension
+	call(t, server, http.MethodGet, ListPath, nil, &extensions)
+	if len(extensions) != 8 {
+		t.Fatalf("list = %d extensions, want 8", len(extensions))
+	}
+	for _, ext := range extensions {
+		if len(ext.Profiles) != 2 {
+			t.Errorf("%s is in %d profiles, want 2", ext.Name, len(ext.Profiles))
+		}
+	}
+}
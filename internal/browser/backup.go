@@ -0,0 +1,171 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// BackupDirName is the directory inside a profile that holds preference backups
+const BackupDirName = "CEI Backups"
+
+// maxBackups is the number of backups kept per preferences file
+const maxBackups = 5
+
+// Backups says where preference backups are kept. The zero value keeps them
+// in BackupDirName inside each profile.
+type Backups struct {
+	// Root, if set, holds all backups instead, mirroring each profile's full
+	// path below it so profiles of different browsers do not collide
+	Root string
+}
+
+// Dir returns the directory holding a profile's backups
+func (b Backups) Dir(profile string) string {
+	if b.Root == "" {
+		return filepath.Join(profile, BackupDirName)
+	}
+	profile = strings.TrimPrefix(profile, filepath.VolumeName(profile))
+	return filepath.Join(b.Root, profile)
+}
+
+// CorruptPreferencesError reports a preferences file that cannot be read or parsed
+type CorruptPreferencesError struct {
+	Path string
+	Err  error
+}
+
+func (e *CorruptPreferencesError) Error() string {
+	return fmt.Sprintf("corrupt preferences file %s: %v", e.Path, e.Err)
+}
+
+func (e *CorruptPreferencesError) Unwrap() error {
+	return e.Err
+}
+
+// backupFile copies a preferences file into the profile's backup directory
+// and prunes old backups. A missing file is not an error.
+func backupFile(fs fsys.FS, backups Backups, path string) error {
+	if _, err := fs.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	backupDir := backups.Dir(filepath.Dir(path))
+	if err := fs.MkdirAll(backupDir, 0755); err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	backupPath := filepath.Join(backupDir, fmt.Sprintf("%s.%d", name, utils.ToChromiumTime(Now())))
+	if err := utils.CopyRecursiveSync(fs, path, backupPath); err != nil {
+		return fmt.Errorf("failed to back up %s: %v", path, err)
+	}
+
+	existing := listBackups(fs, backupDir, name)
+	for _, old := range existing[min(len(existing), maxBackups):] {
+		fs.Remove(old)
+	}
+	return nil
+}
+
+// listBackups returns the backups of a preferences file, newest first
+func listBackups(fs fsys.FS, backupDir, name string) []string {
+	entries, err := fs.ReadDir(backupDir)
+	if err != nil {
+		return nil
+	}
+
+	type backup struct {
+		path  string
+		stamp int64
+	}
+	var backups []backup
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), name+".")
+		if !ok {
+			continue
+		}
+		stamp, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(backupDir, entry.Name()), stamp: stamp})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].stamp > backups[j].stamp })
+	paths := make([]string, len(backups))
+	for i, b := range backups {
+		paths[i] = b.path
+	}
+	return paths
+}
+
+// RepairProfile replaces corrupt preference files with the newest backup that
+// parses, falling back to Chromium's own "<name>.bad" copy.
+// It returns the names of the files it restored.
+func RepairProfile(fs fsys.FS, backups Backups, profile string) ([]string, error) {
+	var repaired []string
+	for _, name := range []string{"Preferences", "Secure Preferences"} {
+		path := filepath.Join(profile, name)
+		if _, err := loadDocument(fs, path); err == nil {
+			continue
+		}
+
+		candidates := listBackups(fs, backups.Dir(profile), name)
+		candidates = append(candidates, path+".bad")
+		if err := restoreFile(fs, path, candidates); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, name)
+	}
+	return repaired, nil
+}
+
+// RestoreProfile replaces both preference files with their newest backup that
+// parses, whether or not the current files are corrupt. Files without a backup
+// are left alone. It returns the names of the files it restored.
+func RestoreProfile(fs fsys.FS, backups Backups, profile string) ([]string, error) {
+	var restored []string
+	for _, name := range []string{"Preferences", "Secure Preferences"} {
+		candidates := listBackups(fs, backups.Dir(profile), name)
+		if len(candidates) == 0 {
+			continue
+		}
+		if err := restoreFile(fs, filepath.Join(profile, name), candidates); err != nil {
+			return restored, err
+		}
+		restored = append(restored, name)
+	}
+	if len(restored) == 0 {
+		return nil, fmt.Errorf("no backups found in %s", backups.Dir(profile))
+	}
+	return restored, nil
+}
+
+// restoreFile copies the first candidate that parses over path
+func restoreFile(fs fsys.FS, path string, candidates []string) error {
+	for _, candidate := range candidates {
+		if _, err := prefs.Load(fs, candidate); err != nil {
+			continue
+		}
+		if err := utils.CopyRecursiveSync(fs, candidate, path); err != nil {
+			return fmt.Errorf("failed to restore %s from %s: %v", path, candidate, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no usable backup found for %s", path)
+}
+
+// IsCorrupt reports whether err was caused by a corrupt preferences file
+func IsCorrupt(err error) bool {
+	var corrupt *CorruptPreferencesError
+	return errors.As(err, &corrupt)
+}
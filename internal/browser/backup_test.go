@@ -0,0 +1,150 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+func TestUpdateProfileCorruptPreferences(t *testing.T) {
+	profile := t.TempDir()
+	corrupt := []byte(`{"browser": {"window_placement": `)
+	prefsPath := filepath.Join(profile, "Preferences")
+	os.WriteFile(prefsPath, corrupt, 0644)
+
+	err := UpdateProfile(fsys.OS{}, Backups{}, profile, "abc", "C:\\ext", newTestSigner("key", "sid"))
+	if !IsCorrupt(err) {
+		t.Fatalf("UpdateProfile() error = %v, want *CorruptPreferencesError", err)
+	}
+
+	data, _ := os.ReadFile(prefsPath)
+	if string(data) != string(corrupt) {
+		t.Error("UpdateProfile() overwrote a corrupt Preferences file")
+	}
+	if _, err := os.Stat(filepath.Join(profile, "Secure Preferences")); !os.IsNotExist(err) {
+		t.Error("UpdateProfile() wrote Secure Preferences for a skipped profile")
+	}
+}
+
+func TestBackupsArePruned(t *testing.T) {
+	profile := t.TempDir()
+	originalNow := Now
+	defer func() { Now = originalNow }()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxBackups+3; i++ {
+		Now = func() time.Time { return start.Add(time.Duration(i) * time.Second) }
+		if err := UpdateProfile(fsys.OS{}, Backups{}, profile, "abc", "C:\\ext", newTestSigner("key", "sid")); err != nil {
+			t.Fatalf("UpdateProfile() error = %v", err)
+		}
+	}
+
+	backups := listBackups(fsys.OS{}, filepath.Join(profile, BackupDirName), "Preferences")
+	if len(backups) != maxBackups {
+		t.Errorf("got %d backups, want %d", len(backups), maxBackups)
+	}
+}
+
+func TestRepairProfile(t *testing.T) {
+	profile := t.TempDir()
+	originalNow := Now
+	defer func() { Now = originalNow }()
+
+	// Three saves leave two backups; the newest one is then corrupted too
+	for day := 1; day <= 3; day++ {
+		Now = func() time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+		UpdateProfile(fsys.OS{}, Backups{}, profile, "abc", "C:\\ext", newTestSigner("key", "sid"))
+	}
+
+	os.WriteFile(filepath.Join(profile, "Preferences"), []byte("{broken"), 0644)
+	backups := listBackups(fsys.OS{}, filepath.Join(profile, BackupDirName), "Preferences")
+	os.WriteFile(backups[0], []byte("{also broken"), 0644)
+
+	repaired, err := RepairProfile(fsys.OS{}, Backups{}, profile)
+	if err != nil {
+		t.Fatalf("RepairProfile() error = %v", err)
+	}
+	if len(repaired) != 1 || repaired[0] != "Preferences" {
+		t.Errorf("RepairProfile() repaired = %v, want [Preferences]", repaired)
+	}
+	if _, err := loadDocument(fsys.OS{}, filepath.Join(profile, "Preferences")); err != nil {
+		t.Errorf("Preferences still corrupt after repair: %v", err)
+	}
+}
+
+func TestRepairProfileFromBadFile(t *testing.T) {
+	profile := t.TempDir()
+	os.WriteFile(filepath.Join(profile, "Secure Preferences"), []byte("{broken"), 0644)
+	os.WriteFile(filepath.Join(profile, "Secure Preferences.bad"), []byte(`{"extensions":{}}`), 0644)
+
+	if _, err := RepairProfile(fsys.OS{}, Backups{}, profile); err != nil {
+		t.Fatalf("RepairProfile() error = %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(profile, "Secure Preferences"))
+	if string(data) != `{"extensions":{}}` {
+		t.Errorf("Secure Preferences = %s, want contents of .bad file", data)
+	}
+
+	os.WriteFile(filepath.Join(profile, "Preferences"), []byte("{broken"), 0644)
+	if _, err := RepairProfile(fsys.OS{}, Backups{}, profile); err == nil {
+		t.Error("RepairProfile() should fail when no usable backup exists")
+	}
+}
+
+func TestRestoreProfile(t *testing.T) {
+	profile := t.TempDir()
+	originalNow := Now
+	defer func() { Now = originalNow }()
+
+	// The second install backs up the state after the first one
+	signer := newTestSigner("key", "sid")
+	for day, id := range []string{"abc", "def"} {
+		Now = func() time.Time { return time.Date(2024, 1, day+1, 0, 0, 0, 0, time.UTC) }
+		if err := UpdateProfile(fsys.OS{}, Backups{}, profile, id, "C:\\ext", signer); err != nil {
+			t.Fatalf("UpdateProfile() error = %v", err)
+		}
+	}
+
+	restored, err := RestoreProfile(fsys.OS{}, Backups{}, profile)
+	if err != nil {
+		t.Fatalf("RestoreProfile() error = %v", err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("RestoreProfile() restored = %v, want both files", restored)
+	}
+	ids, _ := InstalledExtensions(fsys.OS{}, profile)
+	if len(ids) != 1 || ids[0] != "abc" {
+		t.Errorf("extensions after restore = %v, want [abc]", ids)
+	}
+
+	if _, err := RestoreProfile(fsys.OS{}, Backups{}, t.TempDir()); err == nil {
+		t.Error("RestoreProfile() should fail without backups")
+	}
+}
+
+func TestBackupsRoot(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "User Data", "Default")
+	backups := Backups{Root: t.TempDir()}
+	os.MkdirAll(profile, 0755)
+
+	want := filepath.Join(backups.Root, strings.TrimPrefix(profile, filepath.VolumeName(profile)))
+	if dir := backups.Dir(profile); dir != want {
+		t.Errorf("Dir() = %s, want %s", dir, want)
+	}
+
+	signer := newTestSigner("key", "sid")
+	UpdateProfile(fsys.OS{}, backups, profile, "abc", "C:\\ext", signer)
+	if err := UpdateProfile(fsys.OS{}, backups, profile, "def", "C:\\ext", signer); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(profile, BackupDirName)); !os.IsNotExist(err) {
+		t.Error("UpdateProfile() wrote backups into the profile")
+	}
+	if _, err := RestoreProfile(fsys.OS{}, backups, profile); err != nil {
+		t.Errorf("RestoreProfile() error = %v", err)
+	}
+}
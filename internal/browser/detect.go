@@ -3,7 +3,11 @@ package browser
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
 )
 
 // Browser represents a Chromium-based browser
@@ -12,93 +16,256 @@ type Browser struct {
 	DisplayName string
 	ProfilePath string
 	AppPath     string
+	Scheme      MACScheme
+	// FS is the file system the browser was detected on; nil means the real one
+	FS fsys.FS
 }
 
-// DetectChromiumBrowsers detects all installed Chromium-based browsers
-func DetectChromiumBrowsers() []Browser {
-	var browsers []Browser
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return browsers
+func (b Browser) files() fsys.FS {
+	if b.FS == nil {
+		return fsys.OS{}
 	}
+	return b.FS
+}
+
+type browserConfig struct {
+	name        string
+	displayName string
+	// profileDirs maps GOOS to the user data directory
+	profileDirs map[string]string
+	// appDirs maps GOOS to the candidate application directories, which hold
+	// resources.pak directly (Linux) or below a directory per version
+	appDirs map[string][]string
+	// externalDirs maps GOOS to the directory read for external extension files
+	externalDirs map[string]string
+	// policyDirs maps GOOS to the directory read for managed policy files
+	policyDirs map[string]string
+}
+
+// macApp returns the directory holding the version directories of a macOS
+// app bundle's framework, for the system-wide and per-user Applications
+// folders
+func macApp(homeDir, app, framework string) []string {
+	versions := filepath.Join(app+".app", "Contents", "Frameworks", framework+".framework", "Versions")
+	return []string{filepath.Join("/Applications", versions), filepath.Join(homeDir, "Applications", versions)}
+}
 
+// knownBrowsers lists where each supported browser keeps its user data and
+// application on each OS. configHome is the XDG config directory Linux
+// browsers keep their user data in.
+func knownBrowsers(homeDir, configHome string) []browserConfig {
 	localAppData := filepath.Join(homeDir, "AppData", "Local")
+	appSupport := filepath.Join(homeDir, "Library", "Application Support")
 
-	// Define Chromium-based browsers to detect
-	browserConfigs := []struct {
-		name        string
-		displayName string
-		profileDir  string
-		appDirs     []string
-	}{
+	return []browserConfig{
 		{
 			name:        "chrome",
 			displayName: "Google Chrome",
-			profileDir:  filepath.Join(localAppData, "Google", "Chrome", "User Data"),
-			appDirs: []string{
-				"C:\\Program Files\\Google\\Chrome\\Application",
-				"C:\\Program Files (x86)\\Google\\Chrome\\Application",
-				filepath.Join(localAppData, "Google", "Chrome", "Application"),
+			profileDirs: map[string]string{
+				"windows": filepath.Join(localAppData, "Google", "Chrome", "User Data"),
+				"darwin":  filepath.Join(appSupport, "Google", "Chrome"),
+				"linux":   filepath.Join(configHome, "google-chrome"),
+			},
+			appDirs: map[string][]string{
+				"windows": {
+					"C:\\Program Files\\Google\\Chrome\\Application",
+					"C:\\Program Files (x86)\\Google\\Chrome\\Application",
+					filepath.Join(localAppData, "Google", "Chrome", "Application"),
+				},
+				"darwin": macApp(homeDir, "Google Chrome", "Google Chrome Framework"),
+				"linux":  {"/opt/google/chrome"},
+			},
+			externalDirs: map[string]string{
+				"linux":  "/usr/share/google-chrome/extensions",
+				"darwin": filepath.Join(appSupport, "Google", "Chrome", "External Extensions"),
+			},
+			policyDirs: map[string]string{
+				"linux": "/etc/opt/chrome/policies/managed",
 			},
 		},
 		{
 			name:        "edge",
 			displayName: "Microsoft Edge",
-			profileDir:  filepath.Join(localAppData, "Microsoft", "Edge", "User Data"),
-			appDirs: []string{
-				"C:\\Program Files\\Microsoft\\Edge\\Application",
-				"C:\\Program Files (x86)\\Microsoft\\Edge\\Application",
+			profileDirs: map[string]string{
+				"windows": filepath.Join(localAppData, "Microsoft", "Edge", "User Data"),
+				"darwin":  filepath.Join(appSupport, "Microsoft Edge"),
+				"linux":   filepath.Join(configHome, "microsoft-edge"),
+			},
+			appDirs: map[string][]string{
+				"windows": {
+					"C:\\Program Files\\Microsoft\\Edge\\Application",
+					"C:\\Program Files (x86)\\Microsoft\\Edge\\Application",
+				},
+				"darwin": macApp(homeDir, "Microsoft Edge", "Microsoft Edge Framework"),
+				"linux":  {"/opt/microsoft/msedge"},
+			},
+			externalDirs: map[string]string{
+				"linux":  "/opt/microsoft/msedge/extensions",
+				"darwin": filepath.Join(appSupport, "Microsoft Edge", "External Extensions"),
+			},
+			policyDirs: map[string]string{
+				"linux": "/etc/opt/edge/policies/managed",
 			},
 		},
 		{
 			name:        "brave",
 			displayName: "Brave Browser",
-			profileDir:  filepath.Join(localAppData, "BraveSoftware", "Brave-Browser", "User Data"),
-			appDirs: []string{
-				"C:\\Program Files\\BraveSoftware\\Brave-Browser\\Application",
-				"C:\\Program Files (x86)\\BraveSoftware\\Brave-Browser\\Application",
-				filepath.Join(localAppData, "BraveSoftware", "Brave-Browser", "Application"),
+			profileDirs: map[string]string{
+				"windows": filepath.Join(localAppData, "BraveSoftware", "Brave-Browser", "User Data"),
+				"darwin":  filepath.Join(appSupport, "BraveSoftware", "Brave-Browser"),
+				"linux":   filepath.Join(configHome, "BraveSoftware", "Brave-Browser"),
+			},
+			appDirs: map[string][]string{
+				"windows": {
+					"C:\\Program Files\\BraveSoftware\\Brave-Browser\\Application",
+					"C:\\Program Files (x86)\\BraveSoftware\\Brave-Browser\\Application",
+					filepath.Join(localAppData, "BraveSoftware", "Brave-Browser", "Application"),
+				},
+				"darwin": macApp(homeDir, "Brave Browser", "Brave Browser Framework"),
+				"linux":  {"/opt/brave.com/brave"},
+			},
+			externalDirs: map[string]string{
+				"linux":  "/opt/brave.com/brave/extensions",
+				"darwin": filepath.Join(appSupport, "BraveSoftware", "Brave-Browser", "External Extensions"),
+			},
+			policyDirs: map[string]string{
+				"linux": "/etc/brave/policies/managed",
 			},
 		},
 		{
 			name:        "opera",
 			displayName: "Opera",
-			profileDir:  filepath.Join(homeDir, "AppData", "Roaming", "Opera Software", "Opera Stable"),
-			appDirs: []string{
-				"C:\\Program Files\\Opera",
-				"C:\\Program Files (x86)\\Opera",
-				filepath.Join(localAppData, "Programs", "Opera"),
+			profileDirs: map[string]string{
+				"windows": filepath.Join(homeDir, "AppData", "Roaming", "Opera Software", "Opera Stable"),
+				"darwin":  filepath.Join(appSupport, "com.operasoftware.Opera"),
+				"linux":   filepath.Join(configHome, "opera"),
+			},
+			appDirs: map[string][]string{
+				"windows": {
+					"C:\\Program Files\\Opera",
+					"C:\\Program Files (x86)\\Opera",
+					filepath.Join(localAppData, "Programs", "Opera"),
+				},
+				"darwin": macApp(homeDir, "Opera", "Opera Framework"),
+				"linux":  {"/usr/lib/x86_64-linux-gnu/opera", "/usr/lib/opera"},
 			},
 		},
 		{
 			name:        "vivaldi",
 			displayName: "Vivaldi",
-			profileDir:  filepath.Join(localAppData, "Vivaldi", "User Data"),
-			appDirs: []string{
-				"C:\\Program Files\\Vivaldi\\Application",
-				"C:\\Program Files (x86)\\Vivaldi\\Application",
-				filepath.Join(localAppData, "Vivaldi", "Application"),
+			profileDirs: map[string]string{
+				"windows": filepath.Join(localAppData, "Vivaldi", "User Data"),
+				"darwin":  filepath.Join(appSupport, "Vivaldi"),
+				"linux":   filepath.Join(configHome, "vivaldi"),
+			},
+			appDirs: map[string][]string{
+				"windows": {
+					"C:\\Program Files\\Vivaldi\\Application",
+					"C:\\Program Files (x86)\\Vivaldi\\Application",
+					filepath.Join(localAppData, "Vivaldi", "Application"),
+				},
+				"darwin": macApp(homeDir, "Vivaldi", "Vivaldi Framework"),
+				"linux":  {"/opt/vivaldi"},
+			},
+			externalDirs: map[string]string{
+				"linux":  "/opt/vivaldi/extensions",
+				"darwin": filepath.Join(appSupport, "Vivaldi", "External Extensions"),
 			},
 		},
 		{
 			name:        "chromium",
 			displayName: "Chromium",
-			profileDir:  filepath.Join(localAppData, "Chromium", "User Data"),
-			appDirs: []string{
-				"C:\\Program Files\\Chromium\\Application",
-				"C:\\Program Files (x86)\\Chromium\\Application",
-				filepath.Join(localAppData, "Chromium", "Application"),
+			profileDirs: map[string]string{
+				"windows": filepath.Join(localAppData, "Chromium", "User Data"),
+				"darwin":  filepath.Join(appSupport, "Chromium"),
+				"linux":   filepath.Join(configHome, "chromium"),
+			},
+			appDirs: map[string][]string{
+				"windows": {
+					"C:\\Program Files\\Chromium\\Application",
+					"C:\\Program Files (x86)\\Chromium\\Application",
+					filepath.Join(localAppData, "Chromium", "Application"),
+				},
+				"darwin": macApp(homeDir, "Chromium", "Chromium Framework"),
+				"linux":  {"/usr/lib/chromium", "/usr/lib/chromium-browser"},
+			},
+			externalDirs: map[string]string{
+				"linux":  "/usr/share/chromium/extensions",
+				"darwin": filepath.Join(appSupport, "Chromium", "External Extensions"),
+			},
+			policyDirs: map[string]string{
+				"linux": "/etc/chromium/policies/managed",
 			},
 		},
 	}
+}
+
+// userDirs returns the home directory of fs and the XDG config directory,
+// $XDG_CONFIG_HOME or ~/.config
+func userDirs(fs fsys.FS) (string, string, error) {
+	homeDir, err := fs.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	configHome := fs.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(configHome) {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return homeDir, configHome, nil
+}
+
+// Names returns the names of all supported browsers, such as "chrome"
+func Names() []string {
+	var names []string
+	for _, config := range knownBrowsers("", "") {
+		names = append(names, config.name)
+	}
+	return names
+}
+
+// Locate returns the user-data directory and candidate application directories
+// of a supported browser on this OS, for the home directory of fs
+func Locate(fs fsys.FS, name string) (profileDir string, appDirs []string, ok bool) {
+	return locate(fs, name, runtime.GOOS)
+}
+
+func locate(fs fsys.FS, name, goos string) (string, []string, bool) {
+	homeDir, configHome, err := userDirs(fs)
+	if err != nil {
+		return "", nil, false
+	}
+	for _, config := range knownBrowsers(homeDir, configHome) {
+		if config.name == name && config.profileDirs[goos] != "" {
+			return config.profileDirs[goos], config.appDirs[goos], true
+		}
+	}
+	return "", nil, false
+}
+
+// DetectChromiumBrowsers detects all installed Chromium-based browsers
+func DetectChromiumBrowsers(fs fsys.FS) []Browser {
+	return detectBrowsers(fs, runtime.GOOS)
+}
+
+// detectBrowsers returns the browsers whose user data directory for goos exists
+func detectBrowsers(fs fsys.FS, goos string) []Browser {
+	var browsers []Browser
+	homeDir, configHome, err := userDirs(fs)
+	if err != nil {
+		return browsers
+	}
 
-	for _, config := range browserConfigs {
+	for _, config := range knownBrowsers(homeDir, configHome) {
+		profileDir := config.profileDirs[goos]
+		if profileDir == "" {
+			continue
+		}
 		// Check if profile directory exists
-		if _, err := os.Stat(config.profileDir); err == nil {
+		if _, err := fs.Stat(profileDir); err == nil {
 			// Find app directory
 			var appPath string
-			for _, dir := range config.appDirs {
-				if _, err := os.Stat(dir); err == nil {
+			for _, dir := range config.appDirs[goos] {
+				if _, err := fs.Stat(dir); err == nil {
 					appPath = dir
 					break
 				}
@@ -107,8 +274,10 @@ func DetectChromiumBrowsers() []Browser {
 			browsers = append(browsers, Browser{
 				Name:        config.name,
 				DisplayName: config.displayName,
-				ProfilePath: config.profileDir,
+				ProfilePath: profileDir,
 				AppPath:     appPath,
+				Scheme:      schemeFor(config.name, goos),
+				FS:          fs,
 			})
 		}
 	}
@@ -116,19 +285,44 @@ func DetectChromiumBrowsers() []Browser {
 	return browsers
 }
 
+// lockFiles are kept in the user data directory while a browser runs:
+// SingletonLock on Linux and macOS, lockfile on Windows
+var lockFiles = []string{"SingletonLock", "lockfile"}
+
+// IsRunning reports whether a browser appears to be running, from the lock it
+// keeps in its user data directory. A browser that crashed may leave the lock
+// behind until it is started and closed again.
+func IsRunning(browser Browser) bool {
+	// SingletonLock is a symlink to a host and process that does not exist as
+	// a file, so it is looked for among the directory entries
+	entries, err := browser.files().ReadDir(browser.ProfilePath)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		for _, name := range lockFiles {
+			if entry.Name() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // GetProfilePaths returns all profile directories for a browser
 func GetProfilePaths(browser Browser) ([]string, error) {
-	if _, err := os.Stat(browser.ProfilePath); os.IsNotExist(err) {
+	fs := browser.files()
+	if _, err := fs.Stat(browser.ProfilePath); os.IsNotExist(err) {
 		return nil, err
 	}
 
 	var profiles []string
 	defaultProfile := filepath.Join(browser.ProfilePath, "Default")
-	if _, err := os.Stat(defaultProfile); err == nil {
+	if _, err := fs.Stat(defaultProfile); err == nil {
 		profiles = append(profiles, defaultProfile)
 	}
 
-	entries, err := os.ReadDir(browser.ProfilePath)
+	entries, err := fs.ReadDir(browser.ProfilePath)
 	if err != nil {
 		return profiles, nil
 	}
@@ -141,3 +335,34 @@ func GetProfilePaths(browser Browser) ([]string, error) {
 
 	return profiles, nil
 }
+
+// Profile describes one profile directory of a browser
+type Profile struct {
+	// Dir is the directory name, such as "Default" or "Profile 1"
+	Dir string
+	// Path is the full path of the profile directory
+	Path string
+	// Name is the name shown in the browser, from Local State; it may be empty
+	Name string
+}
+
+// GetProfiles returns the profiles of a browser with their display names
+func GetProfiles(browser Browser) ([]Profile, error) {
+	paths, err := GetProfilePaths(browser)
+	if err != nil {
+		return nil, err
+	}
+
+	// Local State is optional; without it profiles have no display name
+	localState, _ := prefs.Load(browser.files(), filepath.Join(browser.ProfilePath, "Local State"))
+
+	profiles := make([]Profile, len(paths))
+	for i, path := range paths {
+		profile := Profile{Dir: filepath.Base(path), Path: path}
+		if localState != nil {
+			profile.Name, _ = localState.String("profile.info_cache." + profile.Dir + ".name")
+		}
+		profiles[i] = profile
+	}
+	return profiles, nil
+}
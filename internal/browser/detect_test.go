@@ -4,10 +4,12 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
 )
 
 func TestDetectChromiumBrowsers(t *testing.T) {
-	browsers := DetectChromiumBrowsers()
+	browsers := DetectChromiumBrowsers(fsys.OS{})
 
 	// Should return a slice (may be nil or empty on Linux or systems without browsers)
 	// This is acceptable behavior
@@ -86,6 +88,135 @@ func TestGetProfilePathsWithTestData(t *testing.T) {
 func BenchmarkDetectChromiumBrowsers(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		DetectChromiumBrowsers()
+		DetectChromiumBrowsers(fsys.OS{})
+	}
+}
+
+func TestGetProfiles(t *testing.T) {
+	fs := fsys.NewMemory()
+	browser := Browser{Name: "test", ProfilePath: "/data", FS: fs}
+	fs.MkdirAll("/data/Default", 0755)
+	fs.MkdirAll("/data/Profile 2", 0755)
+	fs.MkdirAll("/data/System Profile", 0755)
+	fs.WriteFile("/data/Local State", []byte(`{"profile": {"info_cache": {"Default": {"name": "Work"}}}}`), 0644)
+
+	profiles, err := GetProfiles(browser)
+	if err != nil {
+		t.Fatalf("GetProfiles() error = %v", err)
+	}
+
+	want := []Profile{
+		{Dir: "Default", Path: filepath.Join("/data", "Default"), Name: "Work"},
+		{Dir: "Profile 2", Path: filepath.Join("/data", "Profile 2")},
+	}
+	if len(profiles) != len(want) {
+		t.Fatalf("GetProfiles() = %v, want %v", profiles, want)
+	}
+	for i := range want {
+		if profiles[i] != want[i] {
+			t.Errorf("GetProfiles()[%d] = %+v, want %+v", i, profiles[i], want[i])
+		}
+	}
+}
+
+func TestIsRunning(t *testing.T) {
+	fs := fsys.NewMemory()
+	browser := Browser{Name: "test", ProfilePath: "/data", FS: fs}
+	fs.MkdirAll("/data/Default", 0755)
+
+	if IsRunning(browser) {
+		t.Error("IsRunning() = true without a lock")
+	}
+	for _, name := range lockFiles {
+		fs.WriteFile("/data/"+name, nil, 0644)
+		if !IsRunning(browser) {
+			t.Errorf("IsRunning() = false with %s", name)
+		}
+		fs.Remove("/data/" + name)
+	}
+	if IsRunning(Browser{ProfilePath: "/missing", FS: fs}) {
+		t.Error("IsRunning() = true for a missing user data directory")
+	}
+}
+
+func TestDetectBrowsersPerOS(t *testing.T) {
+	tests := []struct {
+		goos     string
+		env      map[string]string
+		userData string
+		appDir   string
+		pak      string
+	}{
+		{
+			goos:     "windows",
+			userData: filepath.Join("/home/user", "AppData", "Local", "Google", "Chrome", "User Data"),
+			appDir:   filepath.Join("/home/user", "AppData", "Local", "Google", "Chrome", "Application"),
+			pak:      filepath.Join("120.0.6099.110", "resources.pak"),
+		},
+		{
+			goos:     "darwin",
+			userData: filepath.Join("/home/user", "Library", "Application Support", "Google", "Chrome"),
+			appDir:   "/Applications/Google Chrome.app/Contents/Frameworks/Google Chrome Framework.framework/Versions",
+			pak:      filepath.Join("120.0.6099.110", "Resources", "resources.pak"),
+		},
+		{
+			goos:     "linux",
+			userData: filepath.Join("/home/user", ".config", "google-chrome"),
+			appDir:   "/opt/google/chrome",
+			pak:      "resources.pak",
+		},
+		{
+			goos:     "linux",
+			env:      map[string]string{"XDG_CONFIG_HOME": "/home/user/cfg"},
+			userData: filepath.Join("/home/user", "cfg", "google-chrome"),
+			appDir:   "/opt/google/chrome",
+			pak:      "resources.pak",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos, func(t *testing.T) {
+			fs := fsys.NewMemory()
+			for key, value := range tt.env {
+				fs.Env[key] = value
+			}
+			fs.MkdirAll(tt.userData, 0755)
+			fs.MkdirAll(filepath.Dir(filepath.Join(tt.appDir, tt.pak)), 0755)
+			fs.WriteFile(filepath.Join(tt.appDir, tt.pak), []byte("pak"), 0644)
+
+			browsers := detectBrowsers(fs, tt.goos)
+			if len(browsers) != 1 || browsers[0].Name != "chrome" {
+				t.Fatalf("detectBrowsers() = %+v, want only chrome", browsers)
+			}
+			if browsers[0].ProfilePath != tt.userData || browsers[0].AppPath != tt.appDir {
+				t.Errorf("detectBrowsers() found %s and %s, want %s and %s", browsers[0].ProfilePath, browsers[0].AppPath, tt.userData, tt.appDir)
+			}
+			if path, err := findResourcesPak(fs, browsers[0]); err != nil || path != filepath.Join(tt.appDir, tt.pak) {
+				t.Errorf("findResourcesPak() = %s, %v, want %s", path, err, filepath.Join(tt.appDir, tt.pak))
+			}
+
+			// The layouts of the other systems are not looked at
+			for _, other := range []string{"windows", "darwin", "linux"} {
+				if other != tt.goos && len(detectBrowsers(fs, other)) != 0 {
+					t.Errorf("detectBrowsers(%s) found the %s layout", other, tt.goos)
+				}
+			}
+		})
+	}
+}
+
+func TestFindResourcesPakPicksNewestVersion(t *testing.T) {
+	fs := fsys.NewMemory()
+	appDir := "/home/user/AppData/Local/Google/Chrome/Application"
+
+	// Until the browser restarts, an update leaves the old version beside the new one
+	for _, version := range []string{"9.0.0.0", "120.0.6099.71", "120.0.6099.109", "119.0.6045.199"} {
+		fs.MkdirAll(filepath.Join(appDir, version), 0755)
+		fs.WriteFile(filepath.Join(appDir, version, "resources.pak"), []byte(version), 0644)
+	}
+
+	path, err := findResourcesPak(fs, Browser{Name: "chrome", DisplayName: "Google Chrome", AppPath: appDir})
+	if want := filepath.Join(appDir, "120.0.6099.109", "resources.pak"); err != nil || path != want {
+		t.Errorf("findResourcesPak() = %s, %v, want %s", path, err, want)
 	}
 }
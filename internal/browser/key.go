@@ -1,58 +1,77 @@
 package browser
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
-	"os"
 	"path/filepath"
 	"regexp"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
 )
 
-// GetKey extracts the encryption key from browser's resources.pak
-func GetKey(browser Browser) ([]byte, error) {
-	if browser.AppPath == "" {
-		return nil, fmt.Errorf("browser application path not found for %s", browser.DisplayName)
+// findResourcesPak returns the resources.pak of a browser: directly in the
+// application directory on Linux, in its version directory on Windows, and in
+// the Resources directory of the framework version on macOS
+func findResourcesPak(fs fsys.FS, browser Browser) (string, error) {
+	if path := filepath.Join(browser.AppPath, "resources.pak"); fsys.Exists(fs, path) {
+		return path, nil
 	}
 
-	entries, err := os.ReadDir(browser.AppPath)
+	entries, err := fs.ReadDir(browser.AppPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read browser directory '%s': %v", browser.AppPath, err)
+		return "", fmt.Errorf("failed to read browser directory '%s': %v", browser.AppPath, err)
 	}
 
+	// After an update the old version directory stays until the browser
+	// restarts, so the newest one holds the current resources.pak
 	var versionDir string
 	versionRegex := regexp.MustCompile(`^\d`)
 	for _, entry := range entries {
-		if entry.IsDir() && versionRegex.MatchString(entry.Name()) {
+		if entry.IsDir() && versionRegex.MatchString(entry.Name()) && (versionDir == "" || utils.CompareVersions(entry.Name(), versionDir) > 0) {
 			versionDir = entry.Name()
-			break
 		}
 	}
-
 	if versionDir == "" {
-		return nil, fmt.Errorf("browser version directory not found for %s in '%s'", browser.DisplayName, browser.AppPath)
+		return "", fmt.Errorf("browser version directory not found for %s in '%s'", browser.DisplayName, browser.AppPath)
 	}
 
-	resourcesPath := filepath.Join(browser.AppPath, versionDir, "resources.pak")
-	if _, err := os.Stat(resourcesPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("resources.pak file not found for %s at '%s'", browser.DisplayName, resourcesPath)
+	for _, path := range []string{
+		filepath.Join(browser.AppPath, versionDir, "resources.pak"),
+		filepath.Join(browser.AppPath, versionDir, "Resources", "resources.pak"),
+	} {
+		if fsys.Exists(fs, path) {
+			return path, nil
+		}
 	}
+	return "", fmt.Errorf("resources.pak file not found for %s in '%s'", browser.DisplayName, filepath.Join(browser.AppPath, versionDir))
+}
 
-	file, err := os.Open(resourcesPath)
-	if err != nil {
+// GetKey extracts the encryption key from browser's resources.pak. It gives up
+// between steps once ctx is done.
+func GetKey(ctx context.Context, browser Browser) ([]byte, error) {
+	if browser.AppPath == "" {
+		return nil, fmt.Errorf("browser application path not found for %s", browser.DisplayName)
+	}
+
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	fileInfo, err := file.Stat()
+	fs := browser.files()
+	resourcesPath, err := findResourcesPak(fs, browser)
 	if err != nil {
 		return nil, err
 	}
 
-	buffer := make([]byte, fileInfo.Size())
-	_, err = file.Read(buffer)
+	buffer, err := fs.ReadFile(resourcesPath)
 	if err != nil {
 		return nil, err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	offset := 0
 	version := binary.LittleEndian.Uint32(buffer[offset:])
@@ -61,7 +80,7 @@ func GetKey(browser Browser) ([]byte, error) {
 	var resourceCount uint32
 	if version == 4 {
 		resourceCount = binary.LittleEndian.Uint32(buffer[offset:])
-		offset += 4
+		offset += 5 // count and encoding byte
 	} else if version == 5 {
 		offset += 4 // skip encoding
 		resourceCount = uint32(binary.LittleEndian.Uint16(buffer[offset:]))
@@ -92,7 +111,7 @@ func GetKey(browser Browser) ([]byte, error) {
 		// Reset and try again with a more lenient search
 		offset = 4
 		if version == 4 {
-			offset = 8
+			offset = 9
 		} else if version == 5 {
 			offset = 12
 		}
@@ -1,226 +1,384 @@
 package browser
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
 	"github.com/yinxulai/chromium-extension-installer/internal/utils"
 )
 
-// UpdateProfile updates browser profile preferences to add an extension
-func UpdateProfile(profile, extensionID, extensionPath string, key []byte, sid string) error {
-	prefsPath := filepath.Join(profile, "Preferences")
-	securePrefsPath := filepath.Join(profile, "Secure Preferences")
+// Now returns the current time used for install_time; tests may replace it
+var Now = time.Now
 
-	// Read Preferences as raw map to preserve all existing data
-	prefs := make(map[string]interface{})
-	if data, err := os.ReadFile(prefsPath); err == nil {
-		json.Unmarshal(data, &prefs)
-	}
+// DisableReasonUserAction is Chromium's disable_reasons bit for a user-disabled extension
+const DisableReasonUserAction = 1
 
-	// Navigate/create extensions structure in prefs
-	if prefs["extensions"] == nil {
-		prefs["extensions"] = make(map[string]interface{})
+// extensionSettingsTemplate is the extensions.settings entry written for a new extension
+const extensionSettingsTemplate = `{"active_permissions":{"api":["browsingData","contentSettings","tabs","webRequest","webRequestBlocking"],"explicit_host":["*://*/*","<all_urls>","chrome://favicon/*","http://*/*","https://*/*"],"scriptable_host":["<all_urls>"]},"creation_flags":38,"from_bookmark":false,"from_webstore":false,"granted_permissions":{"api":["browsingData","contentSettings","tabs","webRequest","webRequestBlocking"],"explicit_host":["*://*/*","<all_urls>","chrome://favicon/*","http://*/*","https://*/*"],"scriptable_host":["<all_urls>"]},"install_time":"","location":4,"never_activated_since_loaded":true,"newAllowFileAccess":true,"path":"","state":1,"was_installed_by_default":false,"was_installed_by_oem":false}`
+
+// ExtensionFlags holds per-extension settings that can be changed after install.
+// Nil fields are left unchanged.
+type ExtensionFlags struct {
+	Enabled    *bool
+	Incognito  *bool
+	FileAccess *bool
+	Pinned     *bool
+}
+
+// UpdateProfile updates browser profile preferences to add an extension
+func UpdateProfile(fs fsys.FS, backups Backups, profile, extensionID, extensionPath string, signer *Signer) error {
+	prefsDoc, securePrefsDoc, err := loadProfile(fs, profile)
+	if err != nil {
+		return err
 	}
-	extensions := prefs["extensions"].(map[string]interface{})
 
-	// Handle install_signature
-	if extensions["install_signature"] == nil {
-		extensions["install_signature"] = make(map[string]interface{})
+	// Add extension ID to install_signature and toolbar if not exists
+	for _, path := range []string{"extensions.install_signature.ids", "extensions.toolbar"} {
+		ids, err := prefsDoc.StringList(path)
+		if err != nil {
+			return err
+		}
+		if !utils.Contains(ids, extensionID) {
+			if err := prefsDoc.Set(path, append(ids, extensionID)); err != nil {
+				return err
+			}
+		}
 	}
-	installSig := extensions["install_signature"].(map[string]interface{})
-	if installSig["ids"] == nil {
-		installSig["ids"] = []interface{}{}
+
+	settingsPath := "extensions.settings." + extensionID
+
+	// Keep the original install time on upgrades
+	installTime, err := securePrefsDoc.String(settingsPath + ".install_time")
+	if err != nil {
+		return err
 	}
-	
-	// Add extension ID if not exists
-	ids := installSig["ids"].([]interface{})
-	found := false
-	for _, id := range ids {
-		if id.(string) == extensionID {
-			found = true
-			break
-		}
+	if installTime == "" {
+		installTime = strconv.FormatInt(utils.ToChromiumTime(Now()), 10)
 	}
-	if !found {
-		installSig["ids"] = append(ids, extensionID)
+
+	// Create extension data
+	extensionData, err := prefs.Parse([]byte(extensionSettingsTemplate))
+	if err != nil {
+		return err
 	}
+	extensionData.Root().Set("install_time", installTime)
+	extensionData.Root().Set("path", extensionPath)
 
-	// Handle toolbar
-	if extensions["toolbar"] == nil {
-		extensions["toolbar"] = []interface{}{}
+	if err := securePrefsDoc.Set(settingsPath, extensionData.Root()); err != nil {
+		return err
 	}
-	toolbar := extensions["toolbar"].([]interface{})
-	found = false
-	for _, id := range toolbar {
-		if id.(string) == extensionID {
-			found = true
-			break
-		}
+	if err := signPref(securePrefsDoc, settingsPath, signer); err != nil {
+		return err
 	}
-	if !found {
-		extensions["toolbar"] = append(toolbar, extensionID)
+
+	return saveProfile(fs, backups, profile, prefsDoc, securePrefsDoc, signer)
+}
+
+// RemoveFromProfile removes extension from browser profile preferences
+func RemoveFromProfile(fs fsys.FS, backups Backups, profile, extensionID string, signer *Signer) error {
+	prefsDoc, securePrefsDoc, err := loadProfile(fs, profile)
+	if err != nil {
+		return err
 	}
 
-	// Read Secure Preferences as raw map to preserve all existing data
-	securePrefs := make(map[string]interface{})
-	if data, err := os.ReadFile(securePrefsPath); err == nil {
-		json.Unmarshal(data, &securePrefs)
+	// Remove from Preferences
+	for _, path := range []string{"extensions.install_signature.ids", "extensions.toolbar"} {
+		if err := removeFromList(prefsDoc, path, extensionID); err != nil {
+			return err
+		}
 	}
 
-	// Navigate/create extensions structure in secure prefs
-	if securePrefs["extensions"] == nil {
-		securePrefs["extensions"] = make(map[string]interface{})
+	// Remove from Secure Preferences
+	settingsPath := "extensions.settings." + extensionID
+	if err := securePrefsDoc.Delete(settingsPath); err != nil {
+		return err
 	}
-	secureExtensions := securePrefs["extensions"].(map[string]interface{})
-	
-	if secureExtensions["settings"] == nil {
-		secureExtensions["settings"] = make(map[string]interface{})
+	if err := securePrefsDoc.Delete("protection.macs." + settingsPath); err != nil {
+		return err
 	}
-	settings := secureExtensions["settings"].(map[string]interface{})
 
-	// Create extension data
-	escapedPath := strings.ReplaceAll(extensionPath, "\\", "\\\\")
-	extensionData := fmt.Sprintf(`{"active_permissions":{"api":["browsingData","contentSettings","tabs","webRequest","webRequestBlocking"],"explicit_host":["*://*/*","\u003Call_urls>","chrome://favicon/*","http://*/*","https://*/*"],"scriptable_host":["\u003Call_urls>"]},"creation_flags":38,"from_bookmark":false,"from_webstore":false,"granted_permissions":{"api":["browsingData","contentSettings","tabs","webRequest","webRequestBlocking"],"explicit_host":["*://*/*","\u003Call_urls>","chrome://favicon/*","http://*/*","https://*/*"],"scriptable_host":["\u003Call_urls>"]},"install_time":"13188169127141243","location":4,"never_activated_since_loaded":true,"newAllowFileAccess":true,"path":"%s","state":1,"was_installed_by_default":false,"was_installed_by_oem":false}`, escapedPath)
+	pinned, _, err := securePrefsDoc.Get("extensions.pinned_extensions")
+	if err != nil {
+		return err
+	}
+	if pinned != nil {
+		if err := removeFromList(securePrefsDoc, "extensions.pinned_extensions", extensionID); err != nil {
+			return err
+		}
+		if err := signPref(securePrefsDoc, "extensions.pinned_extensions", signer); err != nil {
+			return err
+		}
+	}
 
-	var extDataMap map[string]interface{}
-	json.Unmarshal([]byte(extensionData), &extDataMap)
-	settings[extensionID] = extDataMap
+	return saveProfile(fs, backups, profile, prefsDoc, securePrefsDoc, signer)
+}
 
-	// Calculate HMAC
-	message := fmt.Sprintf("%sextensions.settings.%s%s", sid, extensionID, extensionData)
-	hash := strings.ToUpper(utils.GetHMACSHA256(key, message))
+// SetExtensionFlags updates an installed extension's flags and re-signs every changed tracked pref
+func SetExtensionFlags(fs fsys.FS, backups Backups, profile, extensionID string, flags ExtensionFlags, signer *Signer) error {
+	prefsDoc, securePrefsDoc, err := loadProfile(fs, profile)
+	if err != nil {
+		return err
+	}
 
-	// Navigate/create protection structure
-	if securePrefs["protection"] == nil {
-		securePrefs["protection"] = make(map[string]interface{})
+	settingsPath := "extensions.settings." + extensionID
+	settings, err := securePrefsDoc.Object(settingsPath, false)
+	if err != nil {
+		return err
 	}
-	protection := securePrefs["protection"].(map[string]interface{})
-	
-	if protection["macs"] == nil {
-		protection["macs"] = make(map[string]interface{})
+	if settings == nil {
+		return fmt.Errorf("extension %s is not installed in profile %s", extensionID, profile)
 	}
-	macs := protection["macs"].(map[string]interface{})
-	
-	if macs["extensions"] == nil {
-		macs["extensions"] = make(map[string]interface{})
+
+	if flags.Enabled != nil {
+		if *flags.Enabled {
+			settings.Set("state", 1)
+			settings.Delete("disable_reasons")
+		} else {
+			settings.Set("state", 0)
+			settings.Set("disable_reasons", DisableReasonUserAction)
+		}
 	}
-	macsExtensions := macs["extensions"].(map[string]interface{})
-	
-	if macsExtensions["settings"] == nil {
-		macsExtensions["settings"] = make(map[string]interface{})
+
+	if flags.Incognito != nil {
+		if *flags.Incognito {
+			settings.Set("incognito", true)
+		} else {
+			settings.Delete("incognito")
+		}
 	}
-	macsSettings := macsExtensions["settings"].(map[string]interface{})
-	
-	macsSettings[extensionID] = hash
 
-	// Calculate super_mac
-	macsJSON, _ := json.Marshal(macs)
-	superMacMessage := fmt.Sprintf("%s%s", sid, string(macsJSON))
-	protection["super_mac"] = strings.ToUpper(utils.GetHMACSHA256(key, superMacMessage))
+	if flags.FileAccess != nil {
+		settings.Set("newAllowFileAccess", *flags.FileAccess)
+	}
 
-	// Write files
-	prefsData, _ := json.MarshalIndent(prefs, "", "  ")
-	if err := os.WriteFile(prefsPath, prefsData, 0644); err != nil {
+	if err := signPref(securePrefsDoc, settingsPath, signer); err != nil {
 		return err
 	}
 
-	securePrefsData, _ := json.MarshalIndent(securePrefs, "", "  ")
-	if err := os.WriteFile(securePrefsPath, securePrefsData, 0644); err != nil {
-		return err
+	if flags.Pinned != nil {
+		// pinned_extensions is an atomic tracked pref; the legacy toolbar list is kept in sync
+		lists := []struct {
+			doc  *prefs.Document
+			path string
+		}{
+			{securePrefsDoc, "extensions.pinned_extensions"},
+			{prefsDoc, "extensions.toolbar"},
+		}
+		for _, list := range lists {
+			if err := removeFromList(list.doc, list.path, extensionID); err != nil {
+				return err
+			}
+			if *flags.Pinned {
+				ids, _ := list.doc.StringList(list.path)
+				if err := list.doc.Set(list.path, append(ids, extensionID)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := signPref(securePrefsDoc, "extensions.pinned_extensions", signer); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return saveProfile(fs, backups, profile, prefsDoc, securePrefsDoc, signer)
 }
 
-// RemoveFromProfile removes extension from browser profile preferences
-func RemoveFromProfile(profile, extensionID string, key []byte, sid string) error {
-	prefsPath := filepath.Join(profile, "Preferences")
-	securePrefsPath := filepath.Join(profile, "Secure Preferences")
+// ResignProfile recomputes every MAC in protection.macs of both preference files,
+// covering split prefs such as extensions.settings.<id> and atomic ones such as
+// homepage, then recomputes super_mac. It returns the number of MACs written.
+func ResignProfile(fs fsys.FS, backups Backups, profile string, signer *Signer) (int, error) {
+	prefsDoc, securePrefsDoc, err := loadProfile(fs, profile)
+	if err != nil {
+		return 0, err
+	}
 
-	// Read Preferences as raw map to preserve all existing data
-	prefs := make(map[string]interface{})
-	if data, err := os.ReadFile(prefsPath); err == nil {
-		json.Unmarshal(data, &prefs)
+	count := 0
+	for _, doc := range []*prefs.Document{prefsDoc, securePrefsDoc} {
+		macs, err := doc.Object("protection.macs", false)
+		if err != nil {
+			return 0, err
+		}
+		if macs == nil {
+			continue
+		}
+		n, err := resignMACs(doc, macs, "", signer)
+		if err != nil {
+			return 0, err
+		}
+		count += n
 	}
 
-	// Remove from Preferences
-	if prefs["extensions"] != nil {
-		extensions := prefs["extensions"].(map[string]interface{})
-		
-		if extensions["install_signature"] != nil {
-			installSig := extensions["install_signature"].(map[string]interface{})
-			if installSig["ids"] != nil {
-				ids := installSig["ids"].([]interface{})
-				newIds := []interface{}{}
-				for _, id := range ids {
-					if id.(string) != extensionID {
-						newIds = append(newIds, id)
-					}
-				}
-				installSig["ids"] = newIds
-			}
+	return count, saveProfile(fs, backups, profile, prefsDoc, securePrefsDoc, signer)
+}
+
+// resignMACs walks a protection.macs subtree; every string leaf at path P is
+// the MAC of the pref stored at P in the same document
+func resignMACs(doc *prefs.Document, macs *prefs.Object, prefix string, signer *Signer) (int, error) {
+	count := 0
+	for _, name := range macs.Keys() {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
 		}
-		
-		if extensions["toolbar"] != nil {
-			toolbar := extensions["toolbar"].([]interface{})
-			newToolbar := []interface{}{}
-			for _, id := range toolbar {
-				if id.(string) != extensionID {
-					newToolbar = append(newToolbar, id)
-				}
+
+		value, _ := macs.Get(name)
+		switch v := value.(type) {
+		case string:
+			prefValue, _, err := doc.Get(path)
+			if err != nil {
+				return 0, err
+			}
+			macs.Set(name, signer.MAC(path, prefValue))
+			count++
+		case *prefs.Object:
+			n, err := resignMACs(doc, v, path, signer)
+			if err != nil {
+				return 0, err
 			}
-			extensions["toolbar"] = newToolbar
+			count += n
+		default:
+			return 0, fmt.Errorf("protection.macs.%s has an unexpected type", path)
 		}
 	}
+	return count, nil
+}
 
-	// Read Secure Preferences as raw map to preserve all existing data
-	securePrefs := make(map[string]interface{})
-	if data, err := os.ReadFile(securePrefsPath); err == nil {
-		json.Unmarshal(data, &securePrefs)
+// InstalledExtensions returns the IDs of the extensions in a profile's
+// extensions.settings, from Secure Preferences and Preferences, in file order
+func InstalledExtensions(fs fsys.FS, profile string) ([]string, error) {
+	prefsDoc, securePrefsDoc, err := loadProfile(fs, profile)
+	if err != nil {
+		return nil, err
 	}
 
-	// Remove from Secure Preferences
-	if securePrefs["extensions"] != nil {
-		extensions := securePrefs["extensions"].(map[string]interface{})
-		if extensions["settings"] != nil {
-			settings := extensions["settings"].(map[string]interface{})
-			delete(settings, extensionID)
-		}
-	}
-
-	if securePrefs["protection"] != nil {
-		protection := securePrefs["protection"].(map[string]interface{})
-		if protection["macs"] != nil {
-			macs := protection["macs"].(map[string]interface{})
-			if macs["extensions"] != nil {
-				macsExtensions := macs["extensions"].(map[string]interface{})
-				if macsExtensions["settings"] != nil {
-					macsSettings := macsExtensions["settings"].(map[string]interface{})
-					delete(macsSettings, extensionID)
-				}
+	var ids []string
+	for _, doc := range []*prefs.Document{securePrefsDoc, prefsDoc} {
+		settings, err := doc.Object("extensions.settings", false)
+		if err != nil {
+			return nil, err
+		}
+		if settings == nil {
+			continue
+		}
+		for _, id := range settings.Keys() {
+			if !utils.Contains(ids, id) {
+				ids = append(ids, id)
 			}
-			
-			// Recalculate super_mac
-			macsJSON, _ := json.Marshal(macs)
-			superMacMessage := fmt.Sprintf("%s%s", sid, string(macsJSON))
-			protection["super_mac"] = strings.ToUpper(utils.GetHMACSHA256(key, superMacMessage))
+		}
+	}
+	return ids, nil
+}
+
+// ExtensionState reports whether a profile's extensions.settings registers
+// extensionID at extensionPath and whether that entry's MAC is valid for
+// signer. Chromium drops entries whose MAC does not match, for example after
+// an update changed the browser's seed.
+func ExtensionState(fs fsys.FS, profile, extensionID, extensionPath string, signer *Signer) (registered, signed bool, err error) {
+	_, securePrefsDoc, err := loadProfile(fs, profile)
+	if err != nil {
+		return false, false, err
+	}
+
+	settingsPath := "extensions.settings." + extensionID
+	value, ok, err := securePrefsDoc.Get(settingsPath)
+	if err != nil || !ok {
+		return false, false, err
+	}
+	if path, _ := securePrefsDoc.String(settingsPath + ".path"); path != extensionPath {
+		return false, false, nil
+	}
+	if !signer.Tracks(settingsPath) {
+		return true, true, nil
+	}
+	mac, _ := securePrefsDoc.String("protection.macs." + settingsPath)
+	return true, mac == signer.MAC(settingsPath, value), nil
+}
+
+// loadProfile reads a profile's Preferences and Secure Preferences.
+// Missing files start out as empty documents.
+func loadProfile(fs fsys.FS, profile string) (*prefs.Document, *prefs.Document, error) {
+	prefsDoc, err := loadDocument(fs, filepath.Join(profile, "Preferences"))
+	if err != nil {
+		return nil, nil, err
+	}
+	securePrefsDoc, err := loadDocument(fs, filepath.Join(profile, "Secure Preferences"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return prefsDoc, securePrefsDoc, nil
+}
+
+// loadDocument reads a preferences file; anything but a missing file that
+// cannot be read or parsed is reported as a *CorruptPreferencesError
+func loadDocument(fs fsys.FS, path string) (*prefs.Document, error) {
+	doc, err := prefs.Load(fs, path)
+	if os.IsNotExist(err) {
+		return prefs.New(), nil
+	}
+	if err != nil {
+		return nil, &CorruptPreferencesError{Path: path, Err: err}
+	}
+	return doc, nil
+}
+
+// saveProfile recomputes super_mac, backs up the current files and writes both preference files
+func saveProfile(fs fsys.FS, backups Backups, profile string, prefsDoc, securePrefsDoc *prefs.Document, signer *Signer) error {
+	if err := updateSuperMAC(securePrefsDoc, signer, true); err != nil {
+		return err
+	}
+	if err := updateSuperMAC(prefsDoc, signer, false); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"Preferences", "Secure Preferences"} {
+		if err := backupFile(fs, backups, filepath.Join(profile, name)); err != nil {
+			return err
 		}
 	}
 
-	// Write files
-	prefsData, _ := json.MarshalIndent(prefs, "", "  ")
-	if err := os.WriteFile(prefsPath, prefsData, 0644); err != nil {
+	if err := prefsDoc.Save(fs, filepath.Join(profile, "Preferences")); err != nil {
 		return err
 	}
+	return securePrefsDoc.Save(fs, filepath.Join(profile, "Secure Preferences"))
+}
 
-	securePrefsData, _ := json.MarshalIndent(securePrefs, "", "  ")
-	if err := os.WriteFile(securePrefsPath, securePrefsData, 0644); err != nil {
+// updateSuperMAC recomputes protection.super_mac from protection.macs. Unless
+// create is set, it is only written where the document already carries one.
+func updateSuperMAC(doc *prefs.Document, signer *Signer, create bool) error {
+	macs, err := doc.Object("protection.macs", false)
+	if err != nil || macs == nil {
 		return err
 	}
+	if !create {
+		if _, ok, err := doc.Get("protection.super_mac"); err != nil || !ok {
+			return err
+		}
+	}
+	return doc.Set("protection.super_mac", signer.SuperMAC(macs))
+}
 
-	return nil
+// signPref stores the MAC of the pref at path under protection.macs.<path>,
+// if the browser tracks it
+func signPref(doc *prefs.Document, path string, signer *Signer) error {
+	if !signer.Tracks(path) {
+		return nil
+	}
+	value, _, err := doc.Get(path)
+	if err != nil {
+		return err
+	}
+	return doc.Set("protection.macs."+path, signer.MAC(path, value))
+}
+
+func removeFromList(doc *prefs.Document, path, item string) error {
+	items, err := doc.StringList(path)
+	if err != nil || items == nil {
+		return err
+	}
+	return doc.Set(path, utils.RemoveString(items, item))
 }
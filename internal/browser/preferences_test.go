@@ -0,0 +1,310 @@
+package browser
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
+)
+
+func readSettings(t *testing.T, profile, extensionID string) map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(profile, "Secure Preferences"))
+	if err != nil {
+		t.Fatalf("Failed to read Secure Preferences: %v", err)
+	}
+	var securePrefs map[string]interface{}
+	if err := json.Unmarshal(data, &securePrefs); err != nil {
+		t.Fatalf("Failed to parse Secure Preferences: %v", err)
+	}
+	settings := securePrefs["extensions"].(map[string]interface{})["settings"].(map[string]interface{})
+	return settings[extensionID].(map[string]interface{})
+}
+
+func loadSecurePrefs(t *testing.T, profile string) *prefs.Document {
+	t.Helper()
+	doc, err := prefs.Load(fsys.OS{}, filepath.Join(profile, "Secure Preferences"))
+	if err != nil {
+		t.Fatalf("Failed to load Secure Preferences: %v", err)
+	}
+	return doc
+}
+
+// assertMAC checks that the MAC stored for path matches its current value
+func assertMAC(t *testing.T, doc *prefs.Document, path string, signer *Signer) {
+	t.Helper()
+	value, _, _ := doc.Get(path)
+	mac, _ := doc.String("protection.macs." + path)
+	if want := signer.MAC(path, value); mac != want {
+		t.Errorf("MAC for %s = %q, want %q", path, mac, want)
+	}
+}
+
+func assertSuperMAC(t *testing.T, doc *prefs.Document, signer *Signer) {
+	t.Helper()
+	macs, _ := doc.Object("protection.macs", false)
+	superMac, _ := doc.String("protection.super_mac")
+	if want := signer.SuperMAC(macs); superMac != want {
+		t.Errorf("super_mac = %q, want %q", superMac, want)
+	}
+}
+
+func TestUpdateProfileInstallTime(t *testing.T) {
+	profile := t.TempDir()
+	extensionID := "abcdefghijklmnopabcdefghijklmnop"
+	signer := newTestSigner("test-key", "S-1-5-21")
+
+	originalNow := Now
+	defer func() { Now = originalNow }()
+
+	Now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC) }
+	if err := UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", signer); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+	if got := readSettings(t, profile, extensionID)["install_time"]; got != "13348638245000006" {
+		t.Errorf("install_time = %v, want 13348638245000006", got)
+	}
+
+	// An upgrade keeps the original install time
+	Now = func() time.Time { return time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC) }
+	if err := UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", signer); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+	if got := readSettings(t, profile, extensionID)["install_time"]; got != "13348638245000006" {
+		t.Errorf("install_time after upgrade = %v, want 13348638245000006", got)
+	}
+}
+
+func TestUpdateProfileMAC(t *testing.T) {
+	profile := t.TempDir()
+	extensionID := "abcdefghijklmnopabcdefghijklmnop"
+	signer := newTestSigner("test-key", "S-1-5-21")
+
+	if err := UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", signer); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+
+	doc := loadSecurePrefs(t, profile)
+	assertMAC(t, doc, "extensions.settings."+extensionID, signer)
+	assertSuperMAC(t, doc, signer)
+
+	settings, _, _ := doc.Get("extensions.settings." + extensionID)
+	if !strings.Contains(prefs.SerializeForMAC(settings), `"explicit_host":["*://*/*","\u003Call_urls>"`) {
+		t.Errorf("serialized settings do not match Chromium format: %s", prefs.SerializeForMAC(settings))
+	}
+}
+
+func TestUpdateProfileSignsTrackedPrefsOnly(t *testing.T) {
+	profile := t.TempDir()
+	extensionID := "abcdefghijklmnopabcdefghijklmnop"
+	signer := &Signer{Key: []byte("test-key"), Scheme: ChromiumScheme{Tracked: []string{"homepage"}}}
+
+	if err := UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", signer); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+	doc := loadSecurePrefs(t, profile)
+	if _, ok, _ := doc.Get("protection.macs.extensions.settings." + extensionID); ok {
+		t.Error("UpdateProfile() signed extensions.settings, which the scheme does not track")
+	}
+	if registered, signed, _ := ExtensionState(fsys.OS{}, profile, extensionID, "C:\\ext", signer); !registered || !signed {
+		t.Errorf("ExtensionState() = %v, %v, want an untracked entry to count as signed", registered, signed)
+	}
+}
+
+func TestExtensionState(t *testing.T) {
+	profile := t.TempDir()
+	extensionID := "abcdefghijklmnopabcdefghijklmnop"
+	signer := newTestSigner("test-key", "S-1-5-21")
+
+	state := func(path string, signer *Signer) (bool, bool) {
+		t.Helper()
+		registered, signed, err := ExtensionState(fsys.OS{}, profile, extensionID, path, signer)
+		if err != nil {
+			t.Fatalf("ExtensionState() error = %v", err)
+		}
+		return registered, signed
+	}
+
+	if registered, _ := state("C:\\ext", signer); registered {
+		t.Error("ExtensionState() registered = true before install")
+	}
+	UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", signer)
+	if registered, signed := state("C:\\ext", signer); !registered || !signed {
+		t.Errorf("ExtensionState() = %v, %v after install, want true, true", registered, signed)
+	}
+	if registered, _ := state("C:\\other", signer); registered {
+		t.Error("ExtensionState() registered = true for another path")
+	}
+	if registered, signed := state("C:\\ext", newTestSigner("new-seed", "S-1-5-21")); !registered || signed {
+		t.Errorf("ExtensionState() with another seed = %v, %v, want true, false", registered, signed)
+	}
+}
+
+func TestUpdateProfilePreservesExistingData(t *testing.T) {
+	profile := t.TempDir()
+	extensionID := "abcdefghijklmnopabcdefghijklmnop"
+	original := `{"zeta":1,"browser":{"window_placement":{"top":10,"left":20}},"extensions":{"toolbar":["other"],"alerts":{"initialized":true}},"alpha":[1.50,"x"]}`
+	os.WriteFile(filepath.Join(profile, "Preferences"), []byte(original), 0644)
+
+	if err := UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", newTestSigner("key", "sid")); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(profile, "Preferences"))
+	expected := `{"zeta":1,"browser":{"window_placement":{"top":10,"left":20}},"extensions":{"toolbar":["other","` + extensionID + `"],"alerts":{"initialized":true},"install_signature":{"ids":["` + extensionID + `"]}},"alpha":[1.50,"x"]}`
+	if string(data) != expected {
+		t.Errorf("Preferences = %s, want %s", data, expected)
+	}
+}
+
+func TestUpdateProfileUnexpectedShape(t *testing.T) {
+	profile := t.TempDir()
+	os.WriteFile(filepath.Join(profile, "Preferences"), []byte(`{"extensions":{"toolbar":"oops"}}`), 0644)
+
+	if err := UpdateProfile(fsys.OS{}, Backups{}, profile, "abc", "C:\\ext", newTestSigner("key", "sid")); err == nil {
+		t.Error("UpdateProfile() should return an error for an unexpected value type")
+	}
+}
+
+func TestSetExtensionFlags(t *testing.T) {
+	profile := t.TempDir()
+	extensionID := "abcdefghijklmnopabcdefghijklmnop"
+	signer := newTestSigner("test-key", "S-1-5-21")
+
+	if err := UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", signer); err != nil {
+		t.Fatalf("UpdateProfile() error = %v", err)
+	}
+
+	yes, no := true, false
+	flags := ExtensionFlags{Enabled: &no, Incognito: &yes, FileAccess: &no, Pinned: &yes}
+	if err := SetExtensionFlags(fsys.OS{}, Backups{}, profile, extensionID, flags, signer); err != nil {
+		t.Fatalf("SetExtensionFlags() error = %v", err)
+	}
+
+	settings := readSettings(t, profile, extensionID)
+	if settings["state"] != float64(0) || settings["disable_reasons"] != float64(DisableReasonUserAction) {
+		t.Errorf("state = %v, disable_reasons = %v, want 0 and %d", settings["state"], settings["disable_reasons"], DisableReasonUserAction)
+	}
+	if settings["incognito"] != true {
+		t.Errorf("incognito = %v, want true", settings["incognito"])
+	}
+	if settings["newAllowFileAccess"] != false {
+		t.Errorf("newAllowFileAccess = %v, want false", settings["newAllowFileAccess"])
+	}
+
+	doc := loadSecurePrefs(t, profile)
+	pinned, _ := doc.StringList("extensions.pinned_extensions")
+	if !reflect.DeepEqual(pinned, []string{extensionID}) {
+		t.Errorf("pinned_extensions = %v, want [%s]", pinned, extensionID)
+	}
+	assertMAC(t, doc, "extensions.settings."+extensionID, signer)
+	assertMAC(t, doc, "extensions.pinned_extensions", signer)
+	assertSuperMAC(t, doc, signer)
+
+	// Re-enable and unpin
+	flags = ExtensionFlags{Enabled: &yes, Pinned: &no}
+	if err := SetExtensionFlags(fsys.OS{}, Backups{}, profile, extensionID, flags, signer); err != nil {
+		t.Fatalf("SetExtensionFlags() error = %v", err)
+	}
+	settings = readSettings(t, profile, extensionID)
+	if _, ok := settings["disable_reasons"]; ok || settings["state"] != float64(1) {
+		t.Errorf("state = %v, disable_reasons = %v, want enabled", settings["state"], settings["disable_reasons"])
+	}
+	if settings["incognito"] != true {
+		t.Error("incognito changed although it was not requested")
+	}
+
+	if err := SetExtensionFlags(fsys.OS{}, Backups{}, profile, "missing", flags, signer); err == nil {
+		t.Error("SetExtensionFlags() should fail for an extension that is not installed")
+	}
+}
+
+func TestRemoveFromProfile(t *testing.T) {
+	profile := t.TempDir()
+	extensionID := "abcdefghijklmnopabcdefghijklmnop"
+	signer := newTestSigner("test-key", "S-1-5-21")
+
+	yes := true
+	UpdateProfile(fsys.OS{}, Backups{}, profile, extensionID, "C:\\ext", signer)
+	SetExtensionFlags(fsys.OS{}, Backups{}, profile, extensionID, ExtensionFlags{Pinned: &yes}, signer)
+
+	if err := RemoveFromProfile(fsys.OS{}, Backups{}, profile, extensionID, signer); err != nil {
+		t.Fatalf("RemoveFromProfile() error = %v", err)
+	}
+
+	doc := loadSecurePrefs(t, profile)
+	if _, ok, _ := doc.Get("extensions.settings." + extensionID); ok {
+		t.Error("extension settings were not removed")
+	}
+	if _, ok, _ := doc.Get("protection.macs.extensions.settings." + extensionID); ok {
+		t.Error("extension MAC was not removed")
+	}
+	if pinned, _ := doc.StringList("extensions.pinned_extensions"); len(pinned) != 0 {
+		t.Errorf("pinned_extensions = %v, want empty", pinned)
+	}
+	assertMAC(t, doc, "extensions.pinned_extensions", signer)
+	assertSuperMAC(t, doc, signer)
+}
+
+func TestResignProfile(t *testing.T) {
+	profile := t.TempDir()
+	signer := newTestSigner("test-key", "S-1-5-21")
+
+	securePrefs := `{"extensions":{"settings":{"aaa":{"state":1},"bbb":{"state":0}}},"homepage":"https://example.com","protection":{"macs":{"extensions":{"settings":{"aaa":"STALE","bbb":"STALE"}},"homepage":"STALE","session":{"restore_on_startup":"STALE"}},"super_mac":"STALE"}}`
+	prefsFile := `{"browser":{"show_home_button":true},"protection":{"macs":{"browser":{"show_home_button":"STALE"}}}}`
+	os.WriteFile(filepath.Join(profile, "Secure Preferences"), []byte(securePrefs), 0644)
+	os.WriteFile(filepath.Join(profile, "Preferences"), []byte(prefsFile), 0644)
+
+	count, err := ResignProfile(fsys.OS{}, Backups{}, profile, signer)
+	if err != nil {
+		t.Fatalf("ResignProfile() error = %v", err)
+	}
+	if count != 5 {
+		t.Errorf("ResignProfile() count = %d, want 5", count)
+	}
+
+	doc := loadSecurePrefs(t, profile)
+	for _, path := range []string{"extensions.settings.aaa", "extensions.settings.bbb", "homepage", "session.restore_on_startup"} {
+		assertMAC(t, doc, path, signer)
+	}
+	assertSuperMAC(t, doc, signer)
+
+	// An unset tracked pref is signed over an empty value
+	if mac, _ := doc.String("protection.macs.session.restore_on_startup"); mac != signer.MAC("session.restore_on_startup", nil) {
+		t.Errorf("MAC for unset pref = %s", mac)
+	}
+
+	prefsDoc, _ := prefs.Load(fsys.OS{}, filepath.Join(profile, "Preferences"))
+	assertMAC(t, prefsDoc, "browser.show_home_button", signer)
+	if _, ok, _ := prefsDoc.Get("protection.super_mac"); ok {
+		t.Error("ResignProfile() added a super_mac to Preferences")
+	}
+}
+
+func TestInstalledExtensions(t *testing.T) {
+	profile := t.TempDir()
+	signer := newTestSigner("test-key", "S-1-5-21")
+	os.WriteFile(filepath.Join(profile, "Preferences"), []byte(`{"extensions": {"settings": {"zzz": {}, "abc": {}}}}`), 0644)
+	UpdateProfile(fsys.OS{}, Backups{}, profile, "abc", "C:\\ext", signer)
+	UpdateProfile(fsys.OS{}, Backups{}, profile, "def", "C:\\ext", signer)
+
+	ids, err := InstalledExtensions(fsys.OS{}, profile)
+	if err != nil {
+		t.Fatalf("InstalledExtensions() error = %v", err)
+	}
+	want := []string{"abc", "def", "zzz"}
+	if len(ids) != len(want) {
+		t.Fatalf("InstalledExtensions() = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("InstalledExtensions()[%d] = %s, want %s", i, ids[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package browser
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// MACScheme describes how a browser signs its tracked preferences
+type MACScheme interface {
+	// Seed returns the HMAC key for the browser
+	Seed(ctx context.Context, b Browser) ([]byte, error)
+	// DeviceID derives the machine-specific ID mixed into every MAC
+	DeviceID(ctx context.Context, provider system.DeviceIDProvider) (string, error)
+	// Message builds the HMAC input for a pref path and its serialized value.
+	// super_mac uses an empty path.
+	Message(deviceID, path, value string) string
+	// TrackedPrefs lists the prefs the browser protects with a MAC. A split
+	// pref such as extensions.settings covers every entry below it.
+	TrackedPrefs() []string
+}
+
+// ChromiumTrackedPrefs are the prefs Chromium tracks on every desktop OS
+var ChromiumTrackedPrefs = []string{
+	"browser.show_home_button",
+	"default_search_provider_data.template_url_data",
+	"extensions.pinned_extensions",
+	"extensions.settings",
+	"extensions.ui.developer_mode",
+	"google.services.account_id",
+	"google.services.last_account_id",
+	"homepage",
+	"homepage_is_newtabpage",
+	"media.storage_id_salt",
+	"pinned_tabs",
+	"safebrowsing.incidents_sent",
+	"search_provider_overrides",
+	"session.restore_on_startup",
+	"session.startup_urls",
+}
+
+// chromeCleanupPrefs are tracked by Google Chrome on Windows for its cleanup tool
+var chromeCleanupPrefs = []string{
+	"software_reporter.prompt_seed",
+	"software_reporter.prompt_version",
+	"software_reporter.reporting",
+}
+
+// ChromiumScheme is the scheme shared by Chromium-based browsers:
+// HMAC-SHA256 keyed by the seed over device ID + pref path + serialized value
+type ChromiumScheme struct {
+	SeedFunc     func(ctx context.Context, b Browser) ([]byte, error)
+	DeviceIDFunc func(ctx context.Context, provider system.DeviceIDProvider) (string, error)
+	// Tracked lists the tracked prefs; nil means ChromiumTrackedPrefs
+	Tracked []string
+}
+
+// Seed returns the HMAC key for the browser
+func (s ChromiumScheme) Seed(ctx context.Context, b Browser) ([]byte, error) {
+	return s.SeedFunc(ctx, b)
+}
+
+// DeviceID derives the machine-specific ID
+func (s ChromiumScheme) DeviceID(ctx context.Context, provider system.DeviceIDProvider) (string, error) {
+	return s.DeviceIDFunc(ctx, provider)
+}
+
+// Message concatenates device ID, path and value
+func (s ChromiumScheme) Message(deviceID, path, value string) string {
+	return deviceID + path + value
+}
+
+// TrackedPrefs returns the tracked prefs
+func (s ChromiumScheme) TrackedPrefs() []string {
+	if s.Tracked == nil {
+		return ChromiumTrackedPrefs
+	}
+	return s.Tracked
+}
+
+// PakSeed reads the seed from the browser's resources.pak
+func PakSeed(ctx context.Context, b Browser) ([]byte, error) {
+	return GetKey(ctx, b)
+}
+
+// EmptySeed is the seed of unbranded Chromium builds
+func EmptySeed(context.Context, Browser) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// WindowsDeviceID returns the machine SID, as Chromium uses on Windows
+func WindowsDeviceID(ctx context.Context, provider system.DeviceIDProvider) (string, error) {
+	sid, err := provider.UserSID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return system.MachineSID(sid)
+}
+
+// MacDeviceID returns the IOPlatformUUID, as Chromium uses on macOS
+func MacDeviceID(ctx context.Context, provider system.DeviceIDProvider) (string, error) {
+	return provider.PlatformUUID(ctx)
+}
+
+// EmptyDeviceID is used on platforms where Chromium mixes no device ID into MACs
+func EmptyDeviceID(context.Context, system.DeviceIDProvider) (string, error) {
+	return "", nil
+}
+
+// deviceIDFuncs derive the device ID per OS; other OSes use EmptyDeviceID
+var deviceIDFuncs = map[string]func(ctx context.Context, provider system.DeviceIDProvider) (string, error){
+	"windows": WindowsDeviceID,
+	"darwin":  MacDeviceID,
+}
+
+// browserScheme is a built-in browser's seed source and the prefs it tracks
+// besides ChromiumTrackedPrefs, per OS
+type browserScheme struct {
+	seed    func(ctx context.Context, b Browser) ([]byte, error)
+	tracked map[string][]string
+}
+
+// browserSchemes holds the built-in scheme of every supported browser
+var browserSchemes = map[string]browserScheme{
+	"chrome":   {seed: PakSeed, tracked: map[string][]string{"windows": chromeCleanupPrefs}},
+	"edge":     {seed: PakSeed},
+	"brave":    {seed: PakSeed},
+	"opera":    {seed: PakSeed},
+	"vivaldi":  {seed: PakSeed},
+	"chromium": {seed: EmptySeed},
+}
+
+// DefaultScheme returns the built-in MAC scheme for a browser on the current OS
+func DefaultScheme(name string) MACScheme {
+	return schemeFor(name, runtime.GOOS)
+}
+
+// schemeFor returns the built-in scheme of a browser on goos. Unknown
+// browsers are treated as branded Chromium builds.
+func schemeFor(name, goos string) MACScheme {
+	entry, ok := browserSchemes[name]
+	if !ok {
+		entry = browserScheme{seed: PakSeed}
+	}
+	deviceID := deviceIDFuncs[goos]
+	if deviceID == nil {
+		deviceID = EmptyDeviceID
+	}
+	tracked := append(append([]string{}, ChromiumTrackedPrefs...), entry.tracked[goos]...)
+	return ChromiumScheme{SeedFunc: entry.seed, DeviceIDFunc: deviceID, Tracked: tracked}
+}
+
+// Signer computes MACs for one browser with a resolved seed and device ID
+type Signer struct {
+	Key      []byte
+	DeviceID string
+	Scheme   MACScheme
+}
+
+// NewSigner resolves the browser's scheme into a Signer, taking machine
+// identifiers from provider
+func NewSigner(ctx context.Context, b Browser, provider system.DeviceIDProvider) (*Signer, error) {
+	scheme := b.Scheme
+	if scheme == nil {
+		scheme = DefaultScheme(b.Name)
+	}
+
+	key, err := scheme.Seed(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceID, err := scheme.DeviceID(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signer{Key: key, DeviceID: deviceID, Scheme: scheme}, nil
+}
+
+// Tracks reports whether the pref at path is tracked, directly or as an entry
+// of a split pref
+func (s *Signer) Tracks(path string) bool {
+	for _, tracked := range s.Scheme.TrackedPrefs() {
+		if path == tracked || strings.HasPrefix(path, tracked+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// MAC computes the MAC Chromium stores for a tracked pref at path
+func (s *Signer) MAC(path string, value interface{}) string {
+	message := s.Scheme.Message(s.DeviceID, path, prefs.SerializeForMAC(value))
+	return strings.ToUpper(utils.GetHMACSHA256(s.Key, message))
+}
+
+// SuperMAC computes the MAC over the whole protection.macs tree
+func (s *Signer) SuperMAC(macs *prefs.Object) string {
+	message := s.Scheme.Message(s.DeviceID, "", prefs.SerializeForMAC(macs))
+	return strings.ToUpper(utils.GetHMACSHA256(s.Key, message))
+}
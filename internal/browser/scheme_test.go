@@ -0,0 +1,179 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+func newTestSigner(key, deviceID string) *Signer {
+	return &Signer{Key: []byte(key), DeviceID: deviceID, Scheme: ChromiumScheme{}}
+}
+
+// prefixScheme is a custom scheme with a different message format
+type prefixScheme struct {
+	ChromiumScheme
+}
+
+func (prefixScheme) Message(deviceID, path, value string) string {
+	return "custom|" + deviceID + "|" + path + "|" + value
+}
+
+func TestSchemeFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		goos        string
+		emptySeed   bool
+		emptyDevice bool
+	}{
+		{name: "chrome", goos: "windows", emptySeed: false, emptyDevice: false},
+		{name: "edge", goos: "windows", emptySeed: false, emptyDevice: false},
+		{name: "chromium", goos: "windows", emptySeed: true, emptyDevice: false},
+		{name: "chrome", goos: "darwin", emptySeed: false, emptyDevice: false},
+		{name: "chrome", goos: "linux", emptySeed: false, emptyDevice: true},
+		{name: "chromium", goos: "linux", emptySeed: true, emptyDevice: true},
+		{name: "unknown", goos: "linux", emptySeed: false, emptyDevice: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.goos, func(t *testing.T) {
+			scheme := schemeFor(tt.name, tt.goos).(ChromiumScheme)
+
+			seed, err := scheme.Seed(context.Background(), Browser{DisplayName: "Test"})
+			if tt.emptySeed {
+				if err != nil || len(seed) != 0 {
+					t.Errorf("Seed() = %v, %v, want empty seed", seed, err)
+				}
+			} else if err == nil {
+				// PakSeed needs an application path, so it fails for a bare Browser
+				t.Error("Seed() should read resources.pak")
+			}
+
+			if tt.emptyDevice {
+				if id, err := scheme.DeviceID(context.Background(), nil); id != "" || err != nil {
+					t.Errorf("DeviceID() = %q, %v, want empty", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	scheme := prefixScheme{ChromiumScheme{
+		SeedFunc:     func(context.Context, Browser) ([]byte, error) { return []byte("seed"), nil },
+		DeviceIDFunc: func(context.Context, system.DeviceIDProvider) (string, error) { return "device", nil },
+	}}
+
+	signer, err := NewSigner(context.Background(), Browser{Name: "custom", Scheme: scheme}, nil)
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+
+	want := utils.GetHMACSHA256([]byte("seed"), `custom|device|homepage|"x"`)
+	if mac := signer.MAC("homepage", "x"); mac != strings.ToUpper(want) {
+		t.Errorf("MAC() = %s, want %s", mac, strings.ToUpper(want))
+	}
+
+	macs := prefs.NewObject()
+	macs.Set("homepage", "ABC")
+	want = utils.GetHMACSHA256([]byte("seed"), `custom|device||{"homepage":"ABC"}`)
+	if mac := signer.SuperMAC(macs); mac != strings.ToUpper(want) {
+		t.Errorf("SuperMAC() = %s, want %s", mac, strings.ToUpper(want))
+	}
+
+	failing := ChromiumScheme{
+		SeedFunc:     func(context.Context, Browser) ([]byte, error) { return nil, nil },
+		DeviceIDFunc: WindowsDeviceID,
+	}
+	if _, err := NewSigner(context.Background(), Browser{Scheme: failing}, &system.FakeProvider{Err: errors.New("no whoami")}); err == nil {
+		t.Error("NewSigner() should return the device ID error")
+	}
+}
+
+func TestWindowsDeviceID(t *testing.T) {
+	provider := &system.FakeProvider{SID: "S-1-5-21-1004336348-1177238915-682003330-1001"}
+	scheme := schemeFor("chrome", "windows")
+
+	deviceID, err := scheme.DeviceID(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("DeviceID() error = %v", err)
+	}
+	if deviceID != "S-1-5-21-1004336348-1177238915-682003330" {
+		t.Errorf("DeviceID() = %q, want machine SID", deviceID)
+	}
+}
+
+// TestBuiltinSchemeMACs checks every built-in scheme against MACs computed
+// independently as HMAC-SHA256(seed, device ID + "homepage" + "\"https://example.com/\"")
+func TestBuiltinSchemeMACs(t *testing.T) {
+	const (
+		userSID  = "S-1-5-21-1004336348-1177238915-682003330-1001"
+		platform = "6B8C4A0E-2F3D-5C1B-9A7E-0D4F8E2C1B3A"
+	)
+	// The MAC depends on the seed source and the OS only
+	want := map[string]map[string]string{
+		"pak": {
+			"windows": "71C4747C4ED30AA02501ECA7604465F67FD9B3E64009F5D99CA22E68839E6C4E",
+			"darwin":  "75B49DD4D82DBAD5AFD3CAE0C39B9F135EF5A23DAF9CD003EB9DE8ED91108D24",
+			"linux":   "42421BB8B4226A3BBBBBB2336FFF146D033E390E48E82F90E44525754BCB455C",
+		},
+		"empty": {
+			"windows": "CFC336CAA69C0888B5FFA78D3EDF4A6DBDB0D921A62DA79D6D336D66E5CF9F06",
+			"darwin":  "57F1A71670C99326F5BAA786C4B3ECABAD780860F518CD60CEC69D6B7656B7A0",
+			"linux":   "26BEA34DD19E345063FFB7291B7D81C1AA0E985844E33718F431C0F881580B70",
+		},
+	}
+
+	provider := &system.FakeProvider{SID: userSID, UUID: platform}
+	for name := range browserSchemes {
+		for _, goos := range []string{"windows", "darwin", "linux"} {
+			t.Run(name+"/"+goos, func(t *testing.T) {
+				scheme := schemeFor(name, goos)
+				deviceID, err := scheme.DeviceID(context.Background(), provider)
+				if err != nil {
+					t.Fatalf("DeviceID() error = %v", err)
+				}
+
+				// resources.pak is replaced by a fixed seed
+				source, key := "empty", []byte{}
+				if _, err := scheme.Seed(context.Background(), Browser{}); err != nil {
+					source, key = "pak", []byte("test seed")
+				}
+				signer := &Signer{Key: key, DeviceID: deviceID, Scheme: scheme}
+				if mac := signer.MAC("homepage", "https://example.com/"); mac != want[source][goos] {
+					t.Errorf("MAC() = %s, want %s", mac, want[source][goos])
+				}
+			})
+		}
+	}
+}
+
+func TestTrackedPrefs(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		path    string
+		tracked bool
+	}{
+		{"chrome", "linux", "homepage", true},
+		{"chrome", "linux", "extensions.settings.abcdefghijklmnopabcdefghijklmnop", true},
+		{"chrome", "linux", "extensions.toolbar", false},
+		{"chrome", "linux", "extensions.settingsx", false},
+		{"chrome", "windows", "software_reporter.prompt_seed", true},
+		{"chrome", "linux", "software_reporter.prompt_seed", false},
+		{"edge", "windows", "software_reporter.prompt_seed", false},
+		{"brave", "windows", "extensions.pinned_extensions", true},
+	}
+
+	for _, tt := range tests {
+		signer := &Signer{Scheme: schemeFor(tt.name, tt.goos)}
+		if got := signer.Tracks(tt.path); got != tt.tracked {
+			t.Errorf("%s/%s Tracks(%q) = %v, want %v", tt.name, tt.goos, tt.path, got, tt.tracked)
+		}
+	}
+}
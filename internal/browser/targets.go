@@ -0,0 +1,45 @@
+package browser
+
+import (
+	"runtime"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+// Target is a browser directory that extensions are registered in by
+// dropping files into it, rather than by editing profiles
+type Target struct {
+	Name        string
+	DisplayName string
+	Dir         string
+}
+
+// ExternalTargets returns the external extension directory (for <id>.json
+// files) of every supported browser that reads such files on this OS.
+// Windows registers external extensions in the registry instead, so it has none.
+func ExternalTargets(fs fsys.FS) []Target {
+	return targets(fs, runtime.GOOS, func(config browserConfig) map[string]string { return config.externalDirs })
+}
+
+// PolicyTargets returns the managed policy directory of every supported
+// browser that reads JSON policy files on this OS. Only Linux has them;
+// Windows and macOS take policies from the registry and configuration profiles.
+func PolicyTargets(fs fsys.FS) []Target {
+	return targets(fs, runtime.GOOS, func(config browserConfig) map[string]string { return config.policyDirs })
+}
+
+// targets returns the directory dirs gives for goos of each supported browser that has one
+func targets(fs fsys.FS, goos string, dirs func(browserConfig) map[string]string) []Target {
+	homeDir, configHome, err := userDirs(fs)
+	if err != nil {
+		return nil
+	}
+
+	var result []Target
+	for _, config := range knownBrowsers(homeDir, configHome) {
+		if dir := dirs(config)[goos]; dir != "" {
+			result = append(result, Target{Name: config.name, DisplayName: config.displayName, Dir: dir})
+		}
+	}
+	return result
+}
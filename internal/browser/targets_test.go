@@ -0,0 +1,44 @@
+package browser
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+func TestTargets(t *testing.T) {
+	fs := fsys.NewMemory()
+	external := func(config browserConfig) map[string]string { return config.externalDirs }
+	policy := func(config browserConfig) map[string]string { return config.policyDirs }
+
+	tests := []struct {
+		name  string
+		goos  string
+		dirs  func(browserConfig) map[string]string
+		count int
+		first string
+	}{
+		{"external on windows", "windows", external, 0, ""},
+		{"external on linux", "linux", external, 5, "/usr/share/google-chrome/extensions"},
+		{"external on macOS", "darwin", external, 5, filepath.Join("/home/user", "Library", "Application Support", "Google", "Chrome", "External Extensions")},
+		{"policy on linux", "linux", policy, 4, "/etc/opt/chrome/policies/managed"},
+		{"policy on macOS", "darwin", policy, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := targets(fs, tt.goos, tt.dirs)
+			if len(got) != tt.count {
+				t.Fatalf("targets() = %v, want %d", got, tt.count)
+			}
+			if tt.count > 0 && (got[0].Name != "chrome" || got[0].Dir != tt.first) {
+				t.Errorf("targets()[0] = %+v, want chrome in %s", got[0], tt.first)
+			}
+			for _, target := range got {
+				if target.Name == "opera" {
+					t.Error("targets() includes opera, which reads neither kind of file")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Package config loads defaults for cei from config files and CEI_* environment variables
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+)
+
+// EnvConfig names a config file that replaces the per-user one
+const EnvConfig = "CEI_CONFIG"
+
+// Config holds the settings that can be given in config files and the environment.
+// Empty fields are not set and leave the built-in default in place.
+type Config struct {
+	// InstallRoot is the directory extensions are copied into
+	InstallRoot string `json:"install_root,omitempty"`
+	// Browsers limits commands to these browser names, such as "chrome"
+	Browsers []string `json:"browsers,omitempty"`
+	// Profiles limits commands to these profile directories or display names
+	Profiles []string `json:"profiles,omitempty"`
+	// BackupDir holds preference backups instead of each profile
+	BackupDir string `json:"backup_dir,omitempty"`
+	// Policy is the path of the install policy file
+	Policy string `json:"policy,omitempty"`
+	Log    Log    `json:"log"`
+
+	// Sources maps each setting that is set to where it came from
+	Sources map[string]string `json:"-"`
+}
+
+// Log holds the logging settings
+type Log struct {
+	// Level is debug, info, warn or error
+	Level string `json:"level,omitempty"`
+	// Format is text or json
+	Format string `json:"format,omitempty"`
+	// File receives the log instead of stderr
+	File string `json:"file,omitempty"`
+}
+
+// setting describes one setting: its name in config files and `config show`,
+// its environment variable, and how to read and write it
+type setting struct {
+	name string
+	env  string
+	get  func(c *Config) string
+	set  func(c *Config, value string)
+}
+
+// settings lists every setting in the order `config show` prints them
+var settings = []setting{
+	{"install_root", "CEI_INSTALL_ROOT", func(c *Config) string { return c.InstallRoot }, func(c *Config, v string) { c.InstallRoot = v }},
+	{"browsers", "CEI_BROWSERS", func(c *Config) string { return strings.Join(c.Browsers, ",") }, func(c *Config, v string) { c.Browsers = splitList(v) }},
+	{"profiles", "CEI_PROFILES", func(c *Config) string { return strings.Join(c.Profiles, ",") }, func(c *Config, v string) { c.Profiles = splitList(v) }},
+	{"backup_dir", "CEI_BACKUP_DIR", func(c *Config) string { return c.BackupDir }, func(c *Config, v string) { c.BackupDir = v }},
+	{"policy", "CEI_POLICY", func(c *Config) string { return c.Policy }, func(c *Config, v string) { c.Policy = v }},
+	{"log.level", "CEI_LOG_LEVEL", func(c *Config) string { return c.Log.Level }, func(c *Config, v string) { c.Log.Level = v }},
+	{"log.format", "CEI_LOG_FORMAT", func(c *Config) string { return c.Log.Format }, func(c *Config, v string) { c.Log.Format = v }},
+	{"log.file", "CEI_LOG_FILE", func(c *Config) string { return c.Log.File }, func(c *Config, v string) { c.Log.File = v }},
+}
+
+// Setting is one entry of the effective configuration
+type Setting struct {
+	Name   string `json:"name"`
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Settings returns every setting with its value and source, in a fixed order.
+// Settings that are not set have an empty value and source.
+func (c *Config) Settings() []Setting {
+	result := make([]Setting, len(settings))
+	for i, s := range settings {
+		result[i] = Setting{Name: s.name, Env: s.env, Value: s.get(c), Source: c.Sources[s.name]}
+	}
+	return result
+}
+
+// SystemPath returns the system-wide config file location
+func SystemPath(fs fsys.FS) string {
+	return systemPath(fs, runtime.GOOS)
+}
+
+func systemPath(fs fsys.FS, goos string) string {
+	switch goos {
+	case "windows":
+		programData := fs.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "cei", "config.json")
+	case "darwin":
+		return "/Library/Application Support/cei/config.json"
+	default:
+		return "/etc/cei/config.json"
+	}
+}
+
+// UserPath returns the per-user config file location; CEI_CONFIG overrides it
+func UserPath(fs fsys.FS) string {
+	return userPath(fs, runtime.GOOS)
+}
+
+func userPath(fs fsys.FS, goos string) string {
+	if path := fs.Getenv(EnvConfig); path != "" {
+		return path
+	}
+
+	home, _ := fs.UserHomeDir()
+	switch goos {
+	case "windows":
+		appData := fs.Getenv("APPDATA")
+		if appData == "" {
+			appData = filepath.Join(home, "AppData", "Roaming")
+		}
+		return filepath.Join(appData, "cei", "config.json")
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "cei", "config.json")
+	default:
+		configHome := fs.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		return filepath.Join(configHome, "cei", "config.json")
+	}
+}
+
+// Load returns the configuration from, in increasing precedence, the
+// system-wide file, the per-user file and CEI_* environment variables.
+// Missing files are skipped; unreadable or malformed ones are an error.
+func Load(fs fsys.FS) (*Config, error) {
+	config := &Config{Sources: map[string]string{}}
+
+	for _, path := range []string{SystemPath(fs), UserPath(fs)} {
+		if err := config.mergeFile(fs, path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := fs.Getenv(s.env); value != "" {
+			s.set(config, value)
+			config.Sources[s.name] = "env " + s.env
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// mergeFile applies the settings a config file sets
+func (c *Config) mergeFile(fs fsys.FS, path string) error {
+	data, err := fs.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+
+	var file Config
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("invalid config %s: %v", path, err)
+	}
+
+	for _, s := range settings {
+		if value := s.get(&file); value != "" {
+			s.set(c, value)
+			c.Sources[s.name] = path
+		}
+	}
+	return nil
+}
+
+// validate checks the settings whose values are fixed
+func (c *Config) validate() error {
+	if c.Log.Level != "" {
+		if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+			return fmt.Errorf("log.level (from %s): %v", c.Sources["log.level"], err)
+		}
+	}
+	if c.Log.Format != "" && c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("log.format (from %s): unknown format %q (want text or json)", c.Sources["log.format"], c.Log.Format)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
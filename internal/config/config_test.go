@@ -0,0 +1,130 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+func TestPaths(t *testing.T) {
+	fs := fsys.NewMemory()
+	fs.Env["APPDATA"] = "/home/user/AppData/Roaming"
+
+	tests := []struct {
+		goos       string
+		system     string
+		user       string
+		configHome string
+	}{
+		{goos: "windows", system: filepath.Join(`C:\ProgramData`, "cei", "config.json"), user: filepath.Join("/home/user/AppData/Roaming", "cei", "config.json")},
+		{goos: "darwin", system: "/Library/Application Support/cei/config.json", user: filepath.Join("/home/user", "Library", "Application Support", "cei", "config.json")},
+		{goos: "linux", system: "/etc/cei/config.json", user: filepath.Join("/home/user", ".config", "cei", "config.json")},
+		{goos: "linux", system: "/etc/cei/config.json", user: filepath.Join("/xdg", "cei", "config.json"), configHome: "/xdg"},
+	}
+
+	for _, tt := range tests {
+		fs.Env["XDG_CONFIG_HOME"] = tt.configHome
+		if got := systemPath(fs, tt.goos); got != tt.system {
+			t.Errorf("systemPath(%s) = %s, want %s", tt.goos, got, tt.system)
+		}
+		if got := userPath(fs, tt.goos); got != tt.user {
+			t.Errorf("userPath(%s) = %s, want %s", tt.goos, got, tt.user)
+		}
+	}
+
+	fs.Env[EnvConfig] = "/srv/cei.json"
+	if got := userPath(fs, "linux"); got != "/srv/cei.json" {
+		t.Errorf("userPath() with %s = %s", EnvConfig, got)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	fs := fsys.NewMemory()
+	fs.Env[EnvConfig] = "/home/user/cei.json"
+	fs.MkdirAll(filepath.Dir(SystemPath(fs)), 0755)
+	fs.WriteFile(SystemPath(fs), []byte(`{
+		"install_root": "/opt/extensions",
+		"browsers": ["chrome", "edge"],
+		"policy": "/etc/cei/policy.json",
+		"log": {"level": "warn", "format": "json"}
+	}`), 0644)
+	fs.WriteFile("/home/user/cei.json", []byte(`{"browsers": ["brave"], "log": {"level": "debug"}}`), 0644)
+	fs.Env["CEI_LOG_LEVEL"] = "error"
+	fs.Env["CEI_PROFILES"] = "Default, Profile 2"
+
+	config, err := Load(fs)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := &Config{
+		InstallRoot: "/opt/extensions",
+		Browsers:    []string{"brave"},
+		Profiles:    []string{"Default", "Profile 2"},
+		Policy:      "/etc/cei/policy.json",
+		Log:         Log{Level: "error", Format: "json"},
+		Sources: map[string]string{
+			"install_root": SystemPath(fs),
+			"browsers":     "/home/user/cei.json",
+			"profiles":     "env CEI_PROFILES",
+			"policy":       SystemPath(fs),
+			"log.level":    "env CEI_LOG_LEVEL",
+			"log.format":   SystemPath(fs),
+		},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("Load() = %+v, want %+v", config, want)
+	}
+
+	settings := config.Settings()
+	if settings[0].Name != "install_root" || settings[0].Value != "/opt/extensions" || settings[3].Source != "" {
+		t.Errorf("Settings() = %+v", settings)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "malformed", file: `{"browsers": `, wantErr: "invalid config"},
+		{name: "unknown key", file: `{"install_dir": "/x"}`, wantErr: "install_dir"},
+		{name: "bad level", file: `{"log": {"level": "loud"}}`, wantErr: "log.level"},
+		{name: "bad format from env", env: map[string]string{"CEI_LOG_FORMAT": "xml"}, wantErr: "env CEI_LOG_FORMAT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := fsys.NewMemory()
+			fs.Env[EnvConfig] = "/home/user/cei.json"
+			if tt.file != "" {
+				fs.WriteFile("/home/user/cei.json", []byte(tt.file), 0644)
+			}
+			for key, value := range tt.env {
+				fs.Env[key] = value
+			}
+
+			_, err := Load(fs)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadNothing(t *testing.T) {
+	config, err := Load(fsys.NewMemory())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for _, s := range config.Settings() {
+		if s.Value != "" || s.Source != "" {
+			t.Errorf("setting %s = %q from %q, want unset", s.Name, s.Value, s.Source)
+		}
+	}
+}
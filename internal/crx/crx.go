@@ -0,0 +1,47 @@
+package crx
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Magic is the CRX file signature
+const Magic = "Cr24"
+
+// File represents a parsed CRX3 package
+type File struct {
+	Version uint32
+	Header  []byte
+	Archive []byte
+}
+
+// IsCRX reports whether data starts with the CRX magic number
+func IsCRX(data []byte) bool {
+	return len(data) >= 4 && string(data[:4]) == Magic
+}
+
+// Parse splits a CRX3 package into its header and zip archive
+func Parse(data []byte) (*File, error) {
+	if !IsCRX(data) {
+		return nil, fmt.Errorf("not a CRX file: bad magic number")
+	}
+	if len(data) < 12 {
+		return nil, fmt.Errorf("CRX file is truncated")
+	}
+
+	version := binary.LittleEndian.Uint32(data[4:])
+	if version != 3 {
+		return nil, fmt.Errorf("unsupported CRX version: %d", version)
+	}
+
+	headerSize := binary.LittleEndian.Uint32(data[8:])
+	if uint64(headerSize) > uint64(len(data)-12) {
+		return nil, fmt.Errorf("CRX header size %d exceeds file size", headerSize)
+	}
+
+	return &File{
+		Version: version,
+		Header:  data[12 : 12+headerSize],
+		Archive: data[12+headerSize:],
+	}, nil
+}
@@ -0,0 +1,49 @@
+package crx
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func buildCRX(version uint32, header, archive []byte) []byte {
+	data := []byte(Magic)
+	data = binary.LittleEndian.AppendUint32(data, version)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(header)))
+	data = append(data, header...)
+	return append(data, archive...)
+}
+
+func TestParse(t *testing.T) {
+	data := buildCRX(3, []byte("header"), []byte("PK\x03\x04archive"))
+
+	file, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if string(file.Header) != "header" {
+		t.Errorf("Header = %q, want %q", file.Header, "header")
+	}
+	if string(file.Archive) != "PK\x03\x04archive" {
+		t.Errorf("Archive = %q, want %q", file.Archive, "PK\x03\x04archive")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Bad magic", data: []byte("PK\x03\x04")},
+		{name: "Truncated", data: []byte("Cr24\x03\x00")},
+		{name: "CRX2", data: buildCRX(2, nil, nil)},
+		{name: "Header too large", data: append(buildCRX(3, nil, nil)[:8], 0xff, 0xff, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data); err == nil {
+				t.Error("Parse() should return error")
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package crx
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadPublicKey reads a DER-encoded SubjectPublicKeyInfo from a PEM or DER file,
+// or decodes it from base64 as found in a manifest "key" field
+func LoadPublicKey(value string) ([]byte, error) {
+	data, err := os.ReadFile(value)
+	if err != nil {
+		data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("publisher key is neither a readable file nor base64: %v", err)
+		}
+	} else if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	if _, err := x509.ParsePKIXPublicKey(data); err != nil {
+		return nil, fmt.Errorf("invalid publisher key: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,35 @@
+package crx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPublicKey(t *testing.T) {
+	signer := newECDSASigner(t)
+
+	pemPath := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(pemPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: signer.publicKey}), 0644)
+
+	derPath := filepath.Join(t.TempDir(), "key.der")
+	os.WriteFile(derPath, signer.publicKey, 0644)
+
+	for _, value := range []string{pemPath, derPath, base64.StdEncoding.EncodeToString(signer.publicKey)} {
+		key, err := LoadPublicKey(value)
+		if err != nil {
+			t.Errorf("LoadPublicKey(%q) error = %v", value, err)
+			continue
+		}
+		if !bytes.Equal(key, signer.publicKey) {
+			t.Errorf("LoadPublicKey(%q) returned wrong key", value)
+		}
+	}
+
+	if _, err := LoadPublicKey("not-a-key"); err == nil {
+		t.Error("LoadPublicKey() should reject invalid input")
+	}
+}
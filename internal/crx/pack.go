@@ -0,0 +1,108 @@
+package crx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+)
+
+// Pack returns a CRX3 package of a zip archive signed with key, which also
+// determines the extension ID. RSA keys produce a sha256_with_rsa proof and
+// ECDSA keys a sha256_with_ecdsa proof.
+func Pack(archive []byte, key crypto.Signer) ([]byte, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %v", err)
+	}
+
+	field := fieldSHA256WithRSA
+	switch key.(type) {
+	case *rsa.PrivateKey:
+	case *ecdsa.PrivateKey:
+		field = fieldSHA256WithECDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+
+	keyHash := sha256.Sum256(publicKey)
+	signedData := appendField(nil, fieldCrxID, keyHash[:16])
+	digest := sha256.Sum256(SignedMessage(signedData, archive))
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign package: %v", err)
+	}
+
+	proof := appendField(nil, fieldProofPublicKey, publicKey)
+	proof = appendField(proof, fieldProofSignature, signature)
+	header := appendField(nil, field, proof)
+	header = appendField(header, fieldSignedHeaderData, signedData)
+
+	data := []byte(Magic)
+	data = binary.LittleEndian.AppendUint32(data, 3)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(header)))
+	data = append(data, header...)
+	return append(data, archive...), nil
+}
+
+// KeyID returns the extension ID of packages signed with key
+func KeyID(key crypto.Signer) (string, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("invalid signing key: %v", err)
+	}
+	return ID(publicKey), nil
+}
+
+// GenerateKey returns a new 2048-bit RSA signing key and its PEM encoding
+// (PKCS#8, as Chrome writes its .pem files)
+func GenerateKey() (*rsa.PrivateKey, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey decodes a PEM signing key: PKCS#8 as written by Chrome and
+// GenerateKey, PKCS#1 RSA or SEC 1 EC
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in private key")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in private key", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
@@ -0,0 +1,99 @@
+package crx
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestPack(t *testing.T) {
+	rsaKey, keyPEM, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := []byte("PK\x03\x04 archive contents")
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+	}{
+		{"RSA", rsaKey},
+		{"ECDSA", ecKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Pack(archive, tt.key)
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+
+			developerKey, err := Verify(data, nil)
+			if err != nil {
+				t.Fatalf("Verify() of a packed CRX error = %v", err)
+			}
+			publicKey, _ := x509.MarshalPKIXPublicKey(tt.key.Public())
+			if !bytes.Equal(developerKey, publicKey) {
+				t.Error("Verify() returned a different developer key")
+			}
+			if id, _ := KeyID(tt.key); id != ID(publicKey) {
+				t.Errorf("KeyID() = %s, want %s", id, ID(publicKey))
+			}
+
+			file, _ := Parse(data)
+			if !bytes.Equal(file.Archive, archive) {
+				t.Error("Pack() changed the archive")
+			}
+		})
+	}
+
+	parsed, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() error = %v", err)
+	}
+	if id, _ := KeyID(parsed); id != mustKeyID(t, rsaKey) {
+		t.Error("ParsePrivateKey() returned a different key than GenerateKey()")
+	}
+}
+
+func mustKeyID(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	id, err := KeyID(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	rsaKey, _, _ := GenerateKey()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"PKCS#1 RSA", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), false},
+		{"SEC 1 EC", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}), false},
+		{"public key", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1}}), true},
+		{"corrupt", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}}), true},
+		{"not PEM", []byte("key"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePrivateKey(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("ParsePrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package crx
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Minimal protobuf wire-format support for the CRX3 header messages.
+// Only varint and length-delimited fields are needed.
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+type protoField struct {
+	number int
+	value  []byte
+}
+
+// decodeFields returns every length-delimited field of a protobuf message.
+// Varint fields are skipped; other wire types are rejected.
+func decodeFields(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("malformed protobuf tag")
+		}
+		data = data[n:]
+
+		switch tag & 7 {
+		case wireVarint:
+			_, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("malformed protobuf varint")
+			}
+			data = data[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, fmt.Errorf("malformed protobuf length")
+			}
+			data = data[n:]
+			fields = append(fields, protoField{number: int(tag >> 3), value: data[:length]})
+			data = data[length:]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", tag&7)
+		}
+	}
+	return fields, nil
+}
+
+// appendField appends a length-delimited field to a protobuf message
+func appendField(buf []byte, number int, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(number)<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
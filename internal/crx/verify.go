@@ -0,0 +1,196 @@
+package crx
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// CrxFileHeader and SignedData field numbers from Chromium's crx3.proto
+const (
+	fieldSHA256WithRSA    = 2
+	fieldSHA256WithECDSA  = 3
+	fieldSignedHeaderData = 10000
+	fieldCrxID            = 1
+	fieldProofPublicKey   = 1
+	fieldProofSignature   = 2
+)
+
+const signatureContext = "CRX3 SignedData\x00"
+
+// Proof is a public key and its signature over the signed data
+type Proof struct {
+	Algorithm string
+	PublicKey []byte
+	Signature []byte
+}
+
+// Header is the decoded CRX3 file header
+type Header struct {
+	Proofs           []Proof
+	SignedHeaderData []byte
+	CrxID            []byte
+}
+
+// ParseHeader decodes a CRX3 CrxFileHeader message
+func ParseHeader(data []byte) (*Header, error) {
+	fields, err := decodeFields(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRX header: %v", err)
+	}
+
+	header := &Header{}
+	for _, field := range fields {
+		switch field.number {
+		case fieldSHA256WithRSA, fieldSHA256WithECDSA:
+			proof, err := parseProof(field.value)
+			if err != nil {
+				return nil, err
+			}
+			proof.Algorithm = "sha256_with_rsa"
+			if field.number == fieldSHA256WithECDSA {
+				proof.Algorithm = "sha256_with_ecdsa"
+			}
+			header.Proofs = append(header.Proofs, proof)
+		case fieldSignedHeaderData:
+			header.SignedHeaderData = field.value
+		}
+	}
+
+	signedFields, err := decodeFields(header.SignedHeaderData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRX signed data: %v", err)
+	}
+	for _, field := range signedFields {
+		if field.number == fieldCrxID {
+			header.CrxID = field.value
+		}
+	}
+
+	return header, nil
+}
+
+func parseProof(data []byte) (Proof, error) {
+	fields, err := decodeFields(data)
+	if err != nil {
+		return Proof{}, fmt.Errorf("invalid CRX proof: %v", err)
+	}
+
+	var proof Proof
+	for _, field := range fields {
+		switch field.number {
+		case fieldProofPublicKey:
+			proof.PublicKey = field.value
+		case fieldProofSignature:
+			proof.Signature = field.value
+		}
+	}
+	return proof, nil
+}
+
+// SignedMessage returns the bytes covered by every CRX3 proof
+func SignedMessage(signedHeaderData, archive []byte) []byte {
+	message := []byte(signatureContext)
+	message = binary.LittleEndian.AppendUint32(message, uint32(len(signedHeaderData)))
+	message = append(message, signedHeaderData...)
+	return append(message, archive...)
+}
+
+// Verify checks every proof in a CRX3 package and returns the developer public key.
+// The package must carry a valid proof from the key its crx_id was derived from.
+// If pinnedKey is set, the package must also carry a valid proof from that key.
+func Verify(data []byte, pinnedKey []byte) ([]byte, error) {
+	file, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := ParseHeader(file.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(header.CrxID) != 16 {
+		return nil, fmt.Errorf("CRX signed data has no valid crx_id")
+	}
+	if len(header.Proofs) == 0 {
+		return nil, fmt.Errorf("CRX file has no signatures")
+	}
+
+	digest := sha256.Sum256(SignedMessage(header.SignedHeaderData, file.Archive))
+
+	var developerKey []byte
+	pinnedFound := false
+	for _, proof := range header.Proofs {
+		if err := verifyProof(proof, digest[:]); err != nil {
+			return nil, err
+		}
+
+		keyHash := sha256.Sum256(proof.PublicKey)
+		if bytes.Equal(keyHash[:16], header.CrxID) {
+			developerKey = proof.PublicKey
+		}
+		if pinnedKey != nil && bytes.Equal(proof.PublicKey, pinnedKey) {
+			pinnedFound = true
+		}
+	}
+
+	if developerKey == nil {
+		return nil, fmt.Errorf("no CRX signature matches crx_id %s", hex.EncodeToString(header.CrxID))
+	}
+	if pinnedKey != nil && !pinnedFound {
+		return nil, fmt.Errorf("CRX file is not signed by the pinned publisher key")
+	}
+
+	return developerKey, nil
+}
+
+func verifyProof(proof Proof, digest []byte) error {
+	publicKey, err := x509.ParsePKIXPublicKey(proof.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid %s public key: %v", proof.Algorithm, err)
+	}
+
+	switch proof.Algorithm {
+	case "sha256_with_rsa":
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("sha256_with_rsa proof carries a non-RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, proof.Signature); err != nil {
+			return fmt.Errorf("sha256_with_rsa signature verification failed: %v", err)
+		}
+	case "sha256_with_ecdsa":
+		ecKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("sha256_with_ecdsa proof carries a non-ECDSA key")
+		}
+		if !ecdsa.VerifyASN1(ecKey, digest, proof.Signature) {
+			return fmt.Errorf("sha256_with_ecdsa signature verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported proof algorithm %q", proof.Algorithm)
+	}
+
+	return nil
+}
+
+// ID returns the extension ID derived from a DER-encoded public key
+func ID(publicKey []byte) string {
+	hash := sha256.Sum256(publicKey)
+	id := make([]byte, 32)
+	for i, c := range hex.EncodeToString(hash[:16]) {
+		if c >= '0' && c <= '9' {
+			id[i] = byte('a' + (c - '0'))
+		} else {
+			id[i] = byte('a' + 10 + (c - 'a'))
+		}
+	}
+	return string(id)
+}
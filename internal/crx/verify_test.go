@@ -0,0 +1,154 @@
+package crx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+type testSigner struct {
+	key       crypto.Signer
+	publicKey []byte
+}
+
+func newRSASigner(t *testing.T) testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return testSigner{key: key, publicKey: der}
+}
+
+func newECDSASigner(t *testing.T) testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return testSigner{key: key, publicKey: der}
+}
+
+// buildSignedCRX signs archive with every signer; the first signer is the developer key
+func buildSignedCRX(t *testing.T, archive []byte, signers ...testSigner) []byte {
+	t.Helper()
+	return buildSignedCRXWithID(t, archive, signers[0].publicKey, signers...)
+}
+
+func buildSignedCRXWithID(t *testing.T, archive, developerKey []byte, signers ...testSigner) []byte {
+	t.Helper()
+	keyHash := sha256.Sum256(developerKey)
+	signedData := appendField(nil, fieldCrxID, keyHash[:16])
+	digest := sha256.Sum256(SignedMessage(signedData, archive))
+
+	var header []byte
+	for _, signer := range signers {
+		signature, err := signer.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof := appendField(nil, fieldProofPublicKey, signer.publicKey)
+		proof = appendField(proof, fieldProofSignature, signature)
+
+		field := fieldSHA256WithRSA
+		if _, ok := signer.key.(*ecdsa.PrivateKey); ok {
+			field = fieldSHA256WithECDSA
+		}
+		header = appendField(header, field, proof)
+	}
+	header = appendField(header, fieldSignedHeaderData, signedData)
+
+	data := []byte(Magic)
+	data = binary.LittleEndian.AppendUint32(data, 3)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(header)))
+	data = append(data, header...)
+	return append(data, archive...)
+}
+
+func TestVerify(t *testing.T) {
+	rsaSigner := newRSASigner(t)
+	ecSigner := newECDSASigner(t)
+	archive := []byte("PK\x03\x04 archive contents")
+
+	t.Run("RSA developer key", func(t *testing.T) {
+		data := buildSignedCRX(t, archive, rsaSigner)
+		key, err := Verify(data, nil)
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if string(key) != string(rsaSigner.publicKey) {
+			t.Error("Verify() returned wrong developer key")
+		}
+	})
+
+	t.Run("ECDSA developer key with RSA co-signer", func(t *testing.T) {
+		data := buildSignedCRX(t, archive, ecSigner, rsaSigner)
+		if _, err := Verify(data, nil); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	})
+
+	t.Run("Pinned key present", func(t *testing.T) {
+		data := buildSignedCRX(t, archive, rsaSigner, ecSigner)
+		if _, err := Verify(data, ecSigner.publicKey); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	})
+
+	t.Run("Pinned key absent", func(t *testing.T) {
+		data := buildSignedCRX(t, archive, rsaSigner)
+		_, err := Verify(data, ecSigner.publicKey)
+		if err == nil || !strings.Contains(err.Error(), "pinned") {
+			t.Fatalf("Verify() error = %v, want pinned key error", err)
+		}
+	})
+
+	t.Run("Tampered archive", func(t *testing.T) {
+		data := buildSignedCRX(t, archive, rsaSigner, ecSigner)
+		data[len(data)-1] ^= 0xff
+		if _, err := Verify(data, nil); err == nil {
+			t.Fatal("Verify() should reject a tampered archive")
+		}
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		keyHash := sha256.Sum256(rsaSigner.publicKey)
+		header := appendField(nil, fieldSignedHeaderData, appendField(nil, fieldCrxID, keyHash[:16]))
+		data := []byte(Magic)
+		data = binary.LittleEndian.AppendUint32(data, 3)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(header)))
+		data = append(append(data, header...), archive...)
+		if _, err := Verify(data, nil); err == nil {
+			t.Fatal("Verify() should reject an unsigned CRX")
+		}
+	})
+
+	t.Run("No proof matches crx_id", func(t *testing.T) {
+		data := buildSignedCRXWithID(t, archive, ecSigner.publicKey, rsaSigner)
+		_, err := Verify(data, nil)
+		if err == nil || !strings.Contains(err.Error(), "crx_id") {
+			t.Fatalf("Verify() error = %v, want crx_id error", err)
+		}
+	})
+}
+
+func TestID(t *testing.T) {
+	id := ID([]byte("public key"))
+	if len(id) != 32 {
+		t.Fatalf("ID() length = %d, want 32", len(id))
+	}
+	for _, c := range id {
+		if c < 'a' || c > 'p' {
+			t.Errorf("ID() returned invalid character %c, must be a-p", c)
+		}
+	}
+}
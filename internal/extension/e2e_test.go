@@ -0,0 +1,237 @@
+package extension
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readPrefs(t *testing.T, fs fsys.FS, path string) *prefs.Document {
+	doc, err := prefs.Load(fs, path)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", path, err)
+	}
+	return doc
+}
+
+func assertSigned(t *testing.T, doc *prefs.Document, path string, signer *browser.Signer) {
+	value, _, _ := doc.Get(path)
+	if mac, _ := doc.String("protection.macs." + path); mac != signer.MAC(path, value) {
+		t.Errorf("MAC of %s = %q, want %q", path, mac, signer.MAC(path, value))
+	}
+}
+
+func assertSuperMAC(t *testing.T, doc *prefs.Document, signer *browser.Signer) {
+	macs, _ := doc.Object("protection.macs", false)
+	if superMAC, _ := doc.String("protection.super_mac"); superMAC != signer.SuperMAC(macs) {
+		t.Errorf("super_mac = %q, want %q", superMAC, signer.SuperMAC(macs))
+	}
+}
+
+func TestInstallUninstallInMemory(t *testing.T) {
+	fs := fsys.NewMemory()
+	provider := &system.FakeProvider{SID: "S-1-5-21-1-2-3-1001", VolumeSerial: "1234-ABCD"}
+	chrome, err := fixture.Build(fs, fixture.Options{Profiles: []string{"Default"}, DeviceIDs: provider})
+	if err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+	profile, signer := chrome.Profiles[0], chrome.Signer
+
+	fs.MkdirAll("/home/user/Downloads", 0755)
+	fs.WriteFile("/home/user/Downloads/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "E2E Test", "version": "1.0", "background": {"service_worker": "background.js"}}`,
+		"background.js": "chrome.runtime.onInstalled.addListener(() => {});",
+	}), 0644)
+
+	opts := ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: testInstallRoot}
+
+	if err := Install(context.Background(), "/home/user/Downloads/ext.zip", InstallOptions{ProfileOptions: opts}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	extensionPath := filepath.Join(testInstallRoot, "E2E Test")
+	extensionID := GetExtensionID(extensionPath)
+
+	if !fsys.Exists(fs, filepath.Join(extensionPath, "background.js")) {
+		t.Error("Install() did not copy the extension files")
+	}
+	if entries, _ := fs.ReadDir(fs.TempDir()); len(entries) != 0 {
+		t.Errorf("Install() left %d temporary entries behind", len(entries))
+	}
+
+	prefsDoc := readPrefs(t, fs, filepath.Join(profile, "Preferences"))
+	for _, path := range []string{"extensions.install_signature.ids", "extensions.toolbar"} {
+		if ids, _ := prefsDoc.StringList(path); !utils.Contains(ids, extensionID) {
+			t.Errorf("%s = %v, want it to contain %s", path, ids, extensionID)
+		}
+	}
+	if show, _, _ := prefsDoc.Get("browser.show_home_button"); show != true {
+		t.Error("Install() lost existing preferences")
+	}
+	assertSigned(t, prefsDoc, "browser.show_home_button", signer)
+
+	securePrefsDoc := readPrefs(t, fs, filepath.Join(profile, "Secure Preferences"))
+	settingsPath := "extensions.settings." + extensionID
+	if path, _ := securePrefsDoc.String(settingsPath + ".path"); path != extensionPath {
+		t.Errorf("%s.path = %q, want %q", settingsPath, path, extensionPath)
+	}
+	assertSigned(t, securePrefsDoc, settingsPath, signer)
+	assertSuperMAC(t, securePrefsDoc, signer)
+
+	if err := Uninstall(context.Background(), "E2E Test", opts); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+
+	if fsys.Exists(fs, extensionPath) {
+		t.Error("Uninstall() did not remove the extension files")
+	}
+
+	prefsDoc = readPrefs(t, fs, filepath.Join(profile, "Preferences"))
+	if ids, _ := prefsDoc.StringList("extensions.install_signature.ids"); len(ids) != 0 {
+		t.Errorf("install_signature.ids = %v, want empty", ids)
+	}
+	if ids, _ := prefsDoc.StringList("extensions.toolbar"); len(ids) != 0 {
+		t.Errorf("toolbar = %v, want empty", ids)
+	}
+
+	securePrefsDoc = readPrefs(t, fs, filepath.Join(profile, "Secure Preferences"))
+	for _, path := range []string{settingsPath, "protection.macs." + settingsPath} {
+		if _, ok, _ := securePrefsDoc.Get(path); ok {
+			t.Errorf("Uninstall() left %s behind", path)
+		}
+	}
+	assertSigned(t, securePrefsDoc, "session.restore_on_startup", signer)
+	assertSuperMAC(t, securePrefsDoc, signer)
+}
+
+func TestVerifyWritesNothing(t *testing.T) {
+	fs := fsys.NewMemory()
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Verified", "version": "1.0"}`,
+	}), 0644)
+	before := fs.Files()
+
+	manifest, extensionID, err := Verify(context.Background(), "/home/user/ext.zip", InstallOptions{ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot}})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if manifest.Name != "Verified" {
+		t.Errorf("Verify() manifest name = %q, want Verified", manifest.Name)
+	}
+	if want := GetExtensionID(filepath.Join(testInstallRoot, "Verified")); extensionID != want {
+		t.Errorf("Verify() ID = %s, want %s", extensionID, want)
+	}
+	if after := fs.Files(); len(after) != len(before) {
+		t.Errorf("Verify() left files behind: %v", after)
+	}
+}
+
+func TestUninstallByIDAndRestore(t *testing.T) {
+	fs, opts := newListFS(t)
+	extensionPath := filepath.Join(testInstallRoot, "Listed")
+	extensionID := GetExtensionID(extensionPath)
+	userDataDir, _, _ := browser.Locate(fs, "chrome")
+	profile := filepath.Join(userDataDir, "Profile 1")
+
+	if err := Uninstall(context.Background(), extensionID, opts); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if ids, _ := browser.InstalledExtensions(fs, profile); utils.Contains(ids, extensionID) {
+		t.Fatal("Uninstall() by ID left the extension in the profile")
+	}
+
+	if err := Restore(context.Background(), opts); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if ids, _ := browser.InstalledExtensions(fs, profile); !utils.Contains(ids, extensionID) {
+		t.Error("Restore() did not bring back the preferences from before the uninstall")
+	}
+}
+
+func TestInstallKeyedExtensionUsesKeyID(t *testing.T) {
+	fs := fsys.NewMemory()
+	provider := &system.FakeProvider{SID: fixture.DefaultSID}
+	chrome, err := fixture.Build(fs, fixture.Options{Profiles: []string{"Default"}, DeviceIDs: provider})
+	if err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+	dir, extensionID := newKeyedExtension(t, fs, "")
+	opts := ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: testInstallRoot}
+
+	// Chromium derives the ID of an unpacked extension from its manifest key
+	if err := Install(context.Background(), dir, InstallOptions{ProfileOptions: opts}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	extensionPath := filepath.Join(testInstallRoot, "External")
+	securePrefsDoc := readPrefs(t, fs, filepath.Join(chrome.Profiles[0], "Secure Preferences"))
+	if path, _ := securePrefsDoc.String("extensions.settings." + extensionID + ".path"); path != extensionPath {
+		t.Errorf("extensions.settings.%s.path = %q, want %q", extensionID, path, extensionPath)
+	}
+	if _, ok, _ := securePrefsDoc.Get("extensions.settings." + GetExtensionID(extensionPath)); ok {
+		t.Error("Install() registered the keyed extension under its path-derived ID")
+	}
+
+	installed, err := List(opts)
+	if err != nil || len(installed) != 1 || installed[0].ID != extensionID || len(installed[0].Profiles) != 1 {
+		t.Fatalf("List() = %+v, %v, want %s installed in one profile", installed, err, extensionID)
+	}
+
+	if err := Uninstall(context.Background(), extensionID, opts); err != nil {
+		t.Fatalf("Uninstall() by ID error = %v", err)
+	}
+	if fsys.Exists(fs, extensionPath) {
+		t.Error("Uninstall() by ID did not remove the extension files")
+	}
+}
+
+func TestInstallRejectsEscapingName(t *testing.T) {
+	fs := fsys.NewMemory()
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "../../Escaped", "version": "1.0"}`,
+	}), 0644)
+	opts := ProfileOptions{FS: fs, InstallRoot: testInstallRoot}
+
+	err := Install(context.Background(), "/home/user/ext.zip", InstallOptions{ProfileOptions: opts})
+	var manifestErr *ManifestError
+	if !errors.As(err, &manifestErr) {
+		t.Fatalf("Install() error = %v, want *ManifestError", err)
+	}
+	if fsys.Exists(fs, filepath.Join(testInstallRoot, "../../Escaped")) {
+		t.Error("Install() wrote outside the install root")
+	}
+
+	// A name that leaves the root is not looked up either
+	fs.MkdirAll(filepath.Join(testInstallRoot, "../Outside"), 0755)
+	if err := Uninstall(context.Background(), "../Outside", opts); err == nil {
+		t.Error("Uninstall() accepted a name outside the install root")
+	}
+	if !fsys.Exists(fs, filepath.Join(testInstallRoot, "../Outside")) {
+		t.Error("Uninstall() removed a directory outside the install root")
+	}
+}
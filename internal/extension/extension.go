@@ -1,248 +1,467 @@
 package extension
 
 import (
-	"encoding/hex"
-	"encoding/json"
+	"context"
 	"fmt"
-	"os"
+	"log/slog"
 	"path/filepath"
+	"runtime"
+	"sync"
 
 	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/policy"
 	"github.com/yinxulai/chromium-extension-installer/internal/system"
 	"github.com/yinxulai/chromium-extension-installer/internal/types"
 	"github.com/yinxulai/chromium-extension-installer/internal/utils"
 )
 
-// GetExtensionID generates the extension ID from the file path
+// GetExtensionID returns the ID Chromium gives an unpacked extension loaded
+// from filePath whose manifest has no key
 func GetExtensionID(filePath string) string {
-	// Convert string to UTF-16LE
-	utf16Bytes := utils.EncodeUTF16LE(filePath)
-
-	// Calculate SHA256 hash
-	hash := utils.HashSHA256(utf16Bytes)
-	digest := hex.EncodeToString(hash[:])
-
-	// Convert to extension ID format
-	extensionID := ""
-	for i := 0; i < 32; i++ {
-		char := digest[i]
-		if char >= '0' && char <= '9' {
-			extensionID += string(rune('a' + (char - '0')))
-		} else {
-			extensionID += string(rune('a' + (char - 'a')))
+	return extensionID(filePath, runtime.GOOS)
+}
+
+// extensionID hashes filePath as Chromium stores paths on goos: UTF-16LE with
+// an upper-case drive letter on Windows, and as is elsewhere. The ID is the
+// first half of the SHA-256 digest with each hex digit mapped to a-p, as for
+// packed extensions.
+func extensionID(filePath, goos string) string {
+	if goos != "windows" {
+		return crx.ID([]byte(filePath))
+	}
+	if len(filePath) >= 2 && filePath[1] == ':' && filePath[0] >= 'a' && filePath[0] <= 'z' {
+		filePath = string(filePath[0]-'a'+'A') + filePath[1:]
+	}
+	return crx.ID(utils.EncodeUTF16LE(filePath))
+}
+
+// unpackedID returns the ID Chromium gives the unpacked extension at
+// extensionPath: derived from the manifest key if there is one, as for
+// packed extensions, and from the path otherwise
+func unpackedID(extensionPath string, manifest *types.Manifest) (string, error) {
+	if manifest != nil && manifest.Key != "" {
+		return keyID(manifest, nil)
+	}
+	return GetExtensionID(extensionPath), nil
+}
+
+// installedID returns the ID of the extension installed at extensionPath,
+// falling back to the path-derived ID if its manifest cannot be read
+func installedID(fs fsys.FS, extensionPath string) string {
+	manifest, _ := LoadManifest(fs, extensionPath)
+	if id, err := unpackedID(extensionPath, manifest); err == nil {
+		return id
+	}
+	return GetExtensionID(extensionPath)
+}
+
+// findExtension returns the install path and ID of an installed extension,
+// given its directory name or its ID
+func findExtension(opts ProfileOptions, nameOrID string) (string, string, error) {
+	fs := opts.files()
+	root, err := opts.installRoot()
+	if err != nil {
+		return "", "", err
+	}
+	// Only plain names are looked up, so nothing outside root is found
+	if validateName(nameOrID) == nil {
+		extensionPath := filepath.Join(root, nameOrID)
+		if info, err := fs.Stat(extensionPath); err == nil && info.IsDir() {
+			return extensionPath, installedID(fs, extensionPath), nil
 		}
 	}
 
-	return extensionID
+	entries, _ := fs.ReadDir(root)
+	for _, entry := range entries {
+		extensionPath := filepath.Join(root, entry.Name())
+		if entry.IsDir() && installedID(fs, extensionPath) == nameOrID {
+			return extensionPath, nameOrID, nil
+		}
+	}
+	return "", "", fmt.Errorf("extension not found")
 }
 
-// Install installs a Chrome extension from a zip file
-func Install(zipfilePath string) error {
-	tempPath := filepath.Join(os.TempDir(), "tempExtensions")
-	if err := os.MkdirAll(tempPath, 0755); err != nil {
-		return err
+// prepare verifies a package, unpacks it into tempPath, validates its manifest
+// and checks the policy. It returns the manifest, the CRX developer key (nil
+// for other packages) and the path and ID the extension is installed under;
+// see externalLocation and policyID for the other methods.
+func prepare(ctx context.Context, path, tempPath string, opts InstallOptions) (*types.Manifest, []byte, string, string, error) {
+	method, err := opts.method()
+	if err != nil {
+		return nil, nil, "", "", err
 	}
-	defer os.RemoveAll(tempPath)
 
-	// Extract zip file
-	if err := utils.UnzipFile(zipfilePath, tempPath); err != nil {
-		return fmt.Errorf("failed to extract zip: %v", err)
+	fs := opts.files()
+	info, err := fs.Stat(path)
+	if err != nil {
+		return nil, nil, "", "", err
 	}
 
-	// Read manifest.json
-	manifestPath := filepath.Join(tempPath, "manifest.json")
-	manifestData, err := os.ReadFile(manifestPath)
+	var publisherKey []byte
+	if info.IsDir() {
+		if publisherKey, err = VerifyPackage(path, opts); err != nil {
+			return nil, nil, "", "", err
+		}
+		err = utils.CopyRecursiveSync(fs, path, tempPath)
+	} else {
+		// The package is read once, so the bytes extracted are the bytes
+		// verified even if the file is replaced meanwhile
+		var data []byte
+		if data, err = fs.ReadFile(path); err != nil {
+			return nil, nil, "", "", err
+		}
+		if publisherKey, err = verifyBytes(data, opts); err != nil {
+			return nil, nil, "", "", err
+		}
+		err = unpackBytes(ctx, fs, data, tempPath)
+	}
 	if err != nil {
-		return fmt.Errorf("manifest.json not found: %v", err)
+		return nil, nil, "", "", fmt.Errorf("failed to extract zip: %w", err)
 	}
+	opts.logger().Debug("package verified", logging.KeyStep, "verify", "package", path, "signed", publisherKey != nil)
 
-	var manifest types.Manifest
-	if err := json.Unmarshal(manifestData, &manifest); err != nil {
-		return fmt.Errorf("failed to parse manifest.json: %v", err)
+	// Read and validate manifest.json
+	manifest, err := LoadManifest(fs, tempPath)
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	if err := ValidateManifest(fs, tempPath, manifest); err != nil {
+		return nil, nil, "", "", err
 	}
 
-	extensionName := manifest.Name
+	root, err := opts.installRoot()
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	var extensionPath, extensionID string
+	switch method {
+	case MethodExternal:
+		extensionPath, extensionID, err = externalLocation(root, manifest, publisherKey, opts)
+	case MethodPolicy:
+		extensionID, err = policyID(manifest, publisherKey, opts)
+	default:
+		extensionPath = filepath.Join(root, manifest.Name)
+		extensionID, err = unpackedID(extensionPath, manifest)
+	}
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+
+	// Enforce local policy before anything is written
+	if opts.Policy != nil {
+		candidate := policy.Candidate{ID: extensionID, Manifest: manifest, PublisherKey: publisherKey}
+		if err := opts.Policy.Check(candidate); err != nil {
+			return nil, nil, "", "", err
+		}
+	}
+	return manifest, publisherKey, extensionPath, extensionID, nil
+}
 
-	// Copy extension to AppData
-	appDataPath := filepath.Join(os.Getenv("APPDATA"), "BrowserExtensions")
-	extensionPath := filepath.Join(appDataPath, extensionName)
+// Verify runs every check Install performs before writing anything: checksum
+// and signatures, manifest validation and policy. It returns the manifest and
+// the ID the extension would be installed under.
+func Verify(ctx context.Context, path string, opts InstallOptions) (*types.Manifest, string, error) {
+	fs := opts.files()
+	tempPath, err := fs.MkdirTemp("", "cei-verify-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer fs.RemoveAll(tempPath)
 
-	if err := os.MkdirAll(extensionPath, 0755); err != nil {
+	manifest, _, _, extensionID, err := prepare(ctx, path, tempPath, opts)
+	return manifest, extensionID, err
+}
+
+// Install installs a Chrome extension from a zip file, CRX package or unpacked directory.
+// If ctx is done, it stops between steps and profiles, removes its temporary
+// files and, when no profile references them yet, the copied extension files.
+func Install(ctx context.Context, zipfilePath string, opts InstallOptions) (err error) {
+	fs := opts.files()
+	tempPath, err := fs.MkdirTemp("", "cei-install-")
+	if err != nil {
+		return err
+	}
+	defer fs.RemoveAll(tempPath)
+
+	manifest, publisherKey, extensionPath, extensionID, err := prepare(ctx, zipfilePath, tempPath, opts)
+	if err != nil {
+		return err
+	}
+	switch opts.Method {
+	case MethodExternal:
+		return installExternal(ctx, zipfilePath, manifest, extensionPath, extensionID, opts)
+	case MethodPolicy:
+		return installManaged(ctx, manifest, extensionID, opts)
+	}
+	extensionName := manifest.Name
+
+	// Copy extension into the install root
+	existed := fsys.Exists(fs, extensionPath)
+	installed := false
+	defer func() {
+		if err != nil && !existed && !installed {
+			fs.RemoveAll(extensionPath)
+		}
+	}()
+	if err := fs.MkdirAll(extensionPath, 0755); err != nil {
 		return err
 	}
 
-	entries, err := os.ReadDir(tempPath)
+	entries, err := fs.ReadDir(tempPath)
 	if err != nil {
 		return err
 	}
 
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("install interrupted: %w", err)
+		}
 		src := filepath.Join(tempPath, entry.Name())
 		dest := filepath.Join(extensionPath, entry.Name())
-		if err := utils.CopyRecursiveSync(src, dest); err != nil {
+		if err := utils.CopyRecursiveSync(fs, src, dest); err != nil {
 			return err
 		}
 	}
 
-	extensionID := GetExtensionID(extensionPath)
+	logger := opts.logger().With(logging.KeyExtensionID, extensionID)
+	logger.Info("extension files copied", logging.KeyStep, "copy", "name", extensionName, "path", extensionPath)
+	logVolumeSerial(ctx, logger, opts.deviceIDs(), runtime.GOOS)
 
-	// Get SID and volume serial number
-	sid, err := system.GetStringSID()
+	// Detect all Chromium-based browsers
+	browsers, err := detectBrowsers(opts.ProfileOptions)
 	if err != nil {
-		return fmt.Errorf("failed to get SID: %v", err)
+		return err
 	}
 
-	volumeSerial, err := system.GetVolumeSerialNumber()
+	logBrowsers(logger, browsers)
+
+	profileOpts := opts.ProfileOptions
+	profileOpts.Logger = logger
+	var mu sync.Mutex
+	profiles := []string{}
+	successCount, err := runProfiles(ctx, browsers, profileOpts, profileAction{
+		step: "install",
+		update: func(profile string, signer *browser.Signer) ([]interface{}, error) {
+			if err := browser.UpdateProfile(fs, opts.backups(), profile, extensionID, extensionPath, signer); err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			profiles = append(profiles, profile)
+			mu.Unlock()
+			return nil, nil
+		},
+	})
+	installed = successCount > 0
 	if err != nil {
-		return fmt.Errorf("failed to get volume serial number: %v", err)
+		return fmt.Errorf("install interrupted: %w", err)
 	}
 
-	fmt.Printf("Extension ID: %s\n", extensionID)
-	fmt.Printf("Volume Serial: %s\n", volumeSerial)
-	fmt.Printf("SID: %s\n", sid)
+	if successCount == 0 {
+		return fmt.Errorf("failed to install extension to any browser")
+	}
+	if err := savePublisherKey(fs, extensionPath, publisherKey); err != nil {
+		return err
+	}
+	if err := saveProfiles(fs, extensionPath, profiles); err != nil {
+		return err
+	}
 
-	// Detect all Chromium-based browsers
-	browsers := browser.DetectChromiumBrowsers()
-	if len(browsers) == 0 {
-		return fmt.Errorf("no Chromium-based browsers found")
+	logger.Info("extension installed", logging.KeyStep, "install", "browsers", successCount)
+	return nil
+}
+
+// logVolumeSerial logs the volume serial number on Windows, the only OS that
+// has one. It is informational, so failing to read it does not stop an install.
+func logVolumeSerial(ctx context.Context, logger *slog.Logger, provider system.DeviceIDProvider, goos string) {
+	if goos != "windows" {
+		return
+	}
+	volumeSerial, err := provider.VolumeSerialNumber(ctx)
+	if err != nil {
+		logger.Debug("volume serial number unavailable", logging.KeyStep, "device", logging.KeyError, err)
+		return
 	}
+	logger.Debug("volume serial number", logging.KeyStep, "device", "volume_serial", logging.Redact(volumeSerial))
+}
 
-	fmt.Printf("\nDetected %d Chromium-based browser(s):\n", len(browsers))
-	for _, b := range browsers {
-		fmt.Printf("  - %s\n", b.DisplayName)
+// Uninstall removes a Chrome extension, given its directory name or ID
+func Uninstall(ctx context.Context, extensionName string, opts ProfileOptions) error {
+	method, err := opts.method()
+	if err != nil {
+		return err
+	}
+	switch method {
+	case MethodExternal:
+		return uninstallExternal(ctx, extensionName, opts)
+	case MethodPolicy:
+		return uninstallManaged(ctx, extensionName, opts)
 	}
-	fmt.Println()
 
-	successCount := 0
-	// Install to each detected browser
-	for _, b := range browsers {
-		fmt.Printf("Installing to %s...\n", b.DisplayName)
+	fs := opts.files()
+	extensionPath, extensionID, err := findExtension(opts, extensionName)
+	if err != nil {
+		return err
+	}
 
-		// Get encryption key for this browser
-		key, err := browser.GetKey(b)
-		if err != nil {
-			fmt.Printf("  Warning: failed to get key for %s: %v\n", b.DisplayName, err)
-			continue
-		}
+	logger := opts.logger().With(logging.KeyExtensionID, extensionID)
+	opts.Logger = logger
 
-		// Get profiles for this browser
-		profiles, err := browser.GetProfilePaths(b)
-		if err != nil {
-			fmt.Printf("  Warning: failed to get profiles for %s: %v\n", b.DisplayName, err)
-			continue
-		}
+	// Remove extension files
+	if err := fs.RemoveAll(extensionPath); err != nil {
+		return err
+	}
+	if err := savePublisherKey(fs, extensionPath, nil); err != nil {
+		return err
+	}
+	if err := saveProfiles(fs, extensionPath, nil); err != nil {
+		return err
+	}
 
-		if len(profiles) == 0 {
-			fmt.Printf("  Warning: no profiles found for %s\n", b.DisplayName)
-			continue
-		}
+	// Detect all Chromium-based browsers
+	browsers, err := detectBrowsers(opts)
+	if err != nil {
+		return err
+	}
 
-		// Update each profile
-		profileSuccessCount := 0
-		for _, profile := range profiles {
-			if err := browser.UpdateProfile(profile, extensionID, extensionPath, key, sid); err != nil {
-				fmt.Printf("  Warning: failed to update profile %s: %v\n", profile, err)
-			} else {
-				profileSuccessCount++
-			}
-		}
+	logBrowsers(logger, browsers)
 
-		if profileSuccessCount > 0 {
-			fmt.Printf("  ✓ Successfully installed to %d profile(s)\n", profileSuccessCount)
-			successCount++
-		} else {
-			fmt.Printf("  ✗ Failed to install to any profile\n")
-		}
+	successCount, err := runProfiles(ctx, browsers, opts, profileAction{
+		step: "uninstall",
+		update: func(profile string, signer *browser.Signer) ([]interface{}, error) {
+			return nil, browser.RemoveFromProfile(fs, opts.backups(), profile, extensionID, signer)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("uninstall interrupted: %w", err)
 	}
 
 	if successCount == 0 {
-		return fmt.Errorf("failed to install extension to any browser")
+		return fmt.Errorf("failed to uninstall extension from any browser")
 	}
 
-	fmt.Printf("\n✓ Extension installed successfully to %d browser(s).\n", successCount)
+	logger.Info("extension uninstalled", logging.KeyStep, "uninstall", "browsers", successCount)
 	return nil
 }
 
-// Uninstall removes a Chrome extension
-func Uninstall(extensionName string) error {
-	appDataPath := filepath.Join(os.Getenv("APPDATA"), "BrowserExtensions")
-	extensionPath := filepath.Join(appDataPath, extensionName)
-
-	if _, err := os.Stat(extensionPath); os.IsNotExist(err) {
-		return fmt.Errorf("extension not found")
+// SetFlags changes per-extension flags of an installed extension, given its
+// directory name or ID, in every browser profile
+func SetFlags(ctx context.Context, extensionName string, flags browser.ExtensionFlags, opts ProfileOptions) error {
+	fs := opts.files()
+	_, extensionID, err := findExtension(opts, extensionName)
+	if err != nil {
+		return err
 	}
 
-	extensionID := GetExtensionID(extensionPath)
+	logger := opts.logger().With(logging.KeyExtensionID, extensionID)
+	opts.Logger = logger
 
-	// Remove extension files
-	if err := os.RemoveAll(extensionPath); err != nil {
+	// Detect all Chromium-based browsers
+	browsers, err := detectBrowsers(opts)
+	if err != nil {
 		return err
 	}
-
-	// Get SID
-	sid, err := system.GetStringSID()
+	logBrowsers(logger, browsers)
+
+	successCount, err := runProfiles(ctx, browsers, opts, profileAction{
+		step: "set",
+		update: func(profile string, signer *browser.Signer) ([]interface{}, error) {
+			return nil, browser.SetExtensionFlags(fs, opts.backups(), profile, extensionID, flags, signer)
+		},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get SID: %v", err)
+		return fmt.Errorf("update interrupted: %w", err)
 	}
 
+	if successCount == 0 {
+		return fmt.Errorf("failed to update extension in any browser")
+	}
+
+	logger.Info("extension updated", logging.KeyStep, "set", "browsers", successCount)
+	return nil
+}
+
+// withRepair runs update on a profile. If the profile's preferences are corrupt
+// and repair is enabled, they are restored from a backup and update is retried;
+// otherwise the profile is left untouched. It returns the names of repaired files.
+func withRepair(profile string, opts ProfileOptions, update func() error) ([]string, error) {
+	err := update()
+	if err == nil || !browser.IsCorrupt(err) {
+		return nil, err
+	}
+	if !opts.Repair {
+		return nil, fmt.Errorf("%w; profile skipped, use --repair to restore it from a backup", err)
+	}
+
+	repaired, repairErr := browser.RepairProfile(opts.files(), opts.backups(), profile)
+	if repairErr != nil {
+		return nil, fmt.Errorf("%v (repair failed: %v)", err, repairErr)
+	}
+	return repaired, update()
+}
+
+// Resign recomputes every tracked preference MAC in every browser profile
+func Resign(ctx context.Context, opts ProfileOptions) error {
+	fs := opts.files()
+
 	// Detect all Chromium-based browsers
-	browsers := browser.DetectChromiumBrowsers()
-	if len(browsers) == 0 {
-		return fmt.Errorf("no Chromium-based browsers found")
+	browsers, err := detectBrowsers(opts)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("Detected %d Chromium-based browser(s):\n", len(browsers))
-	for _, b := range browsers {
-		fmt.Printf("  - %s\n", b.DisplayName)
+	logBrowsers(opts.logger(), browsers)
+
+	successCount, err := runProfiles(ctx, browsers, opts, profileAction{
+		step: "resign",
+		update: func(profile string, signer *browser.Signer) ([]interface{}, error) {
+			count, err := browser.ResignProfile(fs, opts.backups(), profile, signer)
+			return []interface{}{"macs", count}, err
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("re-signing interrupted: %w", err)
 	}
-	fmt.Println()
 
-	successCount := 0
-	// Uninstall from each detected browser
-	for _, b := range browsers {
-		fmt.Printf("Uninstalling from %s...\n", b.DisplayName)
+	if successCount == 0 {
+		return fmt.Errorf("failed to re-sign any browser")
+	}
 
-		// Get encryption key for this browser
-		key, err := browser.GetKey(b)
-		if err != nil {
-			fmt.Printf("  Warning: failed to get key for %s: %v\n", b.DisplayName, err)
-			continue
-		}
+	opts.logger().Info("profiles re-signed", logging.KeyStep, "resign", "browsers", successCount)
+	return nil
+}
 
-		// Get profiles for this browser
-		profiles, err := browser.GetProfilePaths(b)
-		if err != nil {
-			fmt.Printf("  Warning: failed to get profiles for %s: %v\n", b.DisplayName, err)
-			continue
-		}
+// Restore replaces the preference files of every profile with their newest
+// backup, undoing the last change made by this tool
+func Restore(ctx context.Context, opts ProfileOptions) error {
+	fs := opts.files()
 
-		if len(profiles) == 0 {
-			fmt.Printf("  Warning: no profiles found for %s\n", b.DisplayName)
-			continue
-		}
+	// Detect all Chromium-based browsers
+	browsers, err := detectBrowsers(opts)
+	if err != nil {
+		return err
+	}
 
-		// Update each profile
-		profileSuccessCount := 0
-		for _, profile := range profiles {
-			if err := browser.RemoveFromProfile(profile, extensionID, key, sid); err != nil {
-				fmt.Printf("  Warning: failed to update profile %s: %v\n", profile, err)
-			} else {
-				profileSuccessCount++
-			}
-		}
+	logBrowsers(opts.logger(), browsers)
 
-		if profileSuccessCount > 0 {
-			fmt.Printf("  ✓ Successfully uninstalled from %d profile(s)\n", profileSuccessCount)
-			successCount++
-		} else {
-			fmt.Printf("  ✗ Failed to uninstall from any profile\n")
-		}
+	successCount, err := runProfiles(ctx, browsers, opts, profileAction{
+		step:     "restore",
+		unsigned: true,
+		update: func(profile string, _ *browser.Signer) ([]interface{}, error) {
+			restored, err := browser.RestoreProfile(fs, opts.backups(), profile)
+			return []interface{}{"files", restored}, err
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("restore interrupted: %w", err)
 	}
 
 	if successCount == 0 {
-		return fmt.Errorf("failed to uninstall extension from any browser")
+		return fmt.Errorf("failed to restore any browser")
 	}
 
-	fmt.Printf("\n✓ Extension uninstalled successfully from %d browser(s).\n", successCount)
+	opts.logger().Info("profiles restored", logging.KeyStep, "restore", "browsers", successCount)
 	return nil
 }
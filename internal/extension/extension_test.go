@@ -1,7 +1,21 @@
 package extension
 
 import (
-"testing"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/policy"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
 )
 
 func TestGetExtensionID(t *testing.T) {
@@ -67,7 +81,7 @@ func TestGetExtensionIDUniqueness(t *testing.T) {
 }
 
 func TestInstallNonExistentZip(t *testing.T) {
-	err := Install("/nonexistent/path/to/extension.zip")
+	err := Install(context.Background(), "/nonexistent/path/to/extension.zip", InstallOptions{})
 	if err == nil {
 		t.Error("Install() should return error for non-existent zip file")
 	}
@@ -80,3 +94,82 @@ func BenchmarkGetExtensionID(b *testing.B) {
 		GetExtensionID(path)
 	}
 }
+
+func TestInstallPolicyViolation(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "BrowserExtensions")
+
+	dir := writeExtension(t, `{"manifest_version": 3, "name": "Test", "version": "1.0", "permissions": ["debugger"]}`)
+	opts := InstallOptions{ProfileOptions: ProfileOptions{InstallRoot: root}, Policy: &policy.Policy{DeniedPermissions: []string{"debugger"}}}
+
+	err := Install(context.Background(), dir, opts)
+	var violation *policy.Violation
+	if !errors.As(err, &violation) {
+		t.Fatalf("Install() error = %v, want *policy.Violation", err)
+	}
+
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Error("Install() wrote extension files despite a policy violation")
+	}
+}
+
+func TestInstallWithoutBrowsers(t *testing.T) {
+	t.Setenv("APPDATA", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", os.Getenv("HOME"))
+
+	dir := writeExtension(t, `{"manifest_version": 3, "name": "Test", "version": "1.0"}`)
+
+	// Reading the volume serial fails outside Windows; that alone must not stop the install
+	provider := &system.FakeProvider{Err: errors.New("vol failed")}
+	err := Install(context.Background(), dir, InstallOptions{ProfileOptions: ProfileOptions{DeviceIDs: provider}})
+	if err == nil || err.Error() != "no Chromium-based browsers found" {
+		t.Fatalf("Install() error = %v, want no browsers found", err)
+	}
+}
+
+func TestExtensionIDKnownValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		filePath string
+		goos     string
+		want     string
+	}{
+		// Chromium's own test vector for the digest-to-ID mapping
+		{"bytes", "test", "linux", "jpignaibiiemhngfjkcpokkamffknabf"},
+		{"linux path", "/home/user/extensions/Test", "linux", "kkfioonnikhhfnllhidapkinpldjkgdd"},
+		{"windows path", `C:\Extensions\Test`, "windows", "bmbedlehalbnkkecpogafgmnbllplakm"},
+		{"windows lower-case drive", `c:\Extensions\Test`, "windows", "bmbedlehalbnkkecpogafgmnbllplakm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extensionID(tt.filePath, tt.goos); got != tt.want {
+				t.Errorf("extensionID(%q, %s) = %s, want %s", tt.filePath, tt.goos, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsCopiedPublisherKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	encodedKey := base64.StdEncoding.EncodeToString(der)
+
+	// An unsigned zip claims an allowed publisher by copying its public key
+	fs := fsys.NewMemory()
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": fmt.Sprintf(`{"manifest_version": 3, "name": "Copied", "version": "1.0", "key": %q}`, encodedKey),
+	}), 0644)
+	opts := InstallOptions{
+		ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot},
+		Policy:         &policy.Policy{AllowedPublisherKeys: []string{encodedKey}},
+	}
+
+	_, _, err = Verify(context.Background(), "/home/user/ext.zip", opts)
+	var violation *policy.Violation
+	if !errors.As(err, &violation) {
+		t.Fatalf("Verify() error = %v, want *policy.Violation", err)
+	}
+}
@@ -0,0 +1,272 @@
+package extension
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// externalEntry is the content of an external extension file. Chromium loads
+// either a local CRX with its version or whatever the update URL serves.
+type externalEntry struct {
+	ExternalCRX       string `json:"external_crx,omitempty"`
+	ExternalVersion   string `json:"external_version,omitempty"`
+	ExternalUpdateURL string `json:"external_update_url,omitempty"`
+}
+
+// externalLocation returns where MethodExternal keeps a copy of the package
+// and the extension ID. A CRX package is copied to <root>/<name>.crx. With an
+// update URL nothing is copied and the path is empty; packages that are not
+// CRX files need one.
+func externalLocation(root string, manifest *types.Manifest, publisherKey []byte, opts InstallOptions) (string, string, error) {
+	extensionID, err := keyID(manifest, publisherKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	if opts.UpdateURL != "" {
+		return "", extensionID, nil
+	}
+	if publisherKey == nil {
+		if manifest.UpdateURL == "" {
+			return "", "", fmt.Errorf("the %s method needs a CRX package or an update URL", MethodExternal)
+		}
+		return "", extensionID, nil
+	}
+	return filepath.Join(root, manifest.Name+".crx"), extensionID, nil
+}
+
+// keyID returns the extension ID Chromium derives from the publisher key of a
+// CRX package or, for other packages, from the manifest key
+func keyID(manifest *types.Manifest, publisherKey []byte) (string, error) {
+	key := publisherKey
+	if key == nil {
+		if manifest.Key == "" {
+			return "", fmt.Errorf("a CRX package or a manifest key is needed to derive the extension ID")
+		}
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(manifest.Key); err != nil {
+			return "", fmt.Errorf("invalid manifest key: %v", err)
+		}
+	}
+	return crx.ID(key), nil
+}
+
+// updateURL returns the update URL given in opts or else the manifest's
+func updateURL(manifest *types.Manifest, opts InstallOptions) string {
+	if opts.UpdateURL != "" {
+		return opts.UpdateURL
+	}
+	return manifest.UpdateURL
+}
+
+// isExtensionID reports whether s looks like an extension ID
+func isExtensionID(s string) bool {
+	if len(s) != 32 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'a' || c > 'p' {
+			return false
+		}
+	}
+	return true
+}
+
+// selectTargets returns the targets of the browsers selected by
+// opts.Browsers. Without a selection, installing uses every browser whose
+// directory exists or that appears to be installed, and uninstalling looks in
+// all of them.
+func selectTargets(opts ProfileOptions, all []browser.Target, kind string, installing bool) ([]browser.Target, error) {
+	if err := checkBrowserNames(opts.Browsers); err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("browsers on %s do not read %s files", runtime.GOOS, kind)
+	}
+
+	fs := opts.files()
+	var targets []browser.Target
+	for _, target := range all {
+		if len(opts.Browsers) > 0 {
+			if utils.Contains(opts.Browsers, target.Name) {
+				targets = append(targets, target)
+			}
+		} else if !installing || fsys.Exists(fs, target.Dir) || browserInstalled(fs, target.Name) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		if len(opts.Browsers) > 0 {
+			return nil, fmt.Errorf("none of the selected browsers read %s files: %s", kind, strings.Join(opts.Browsers, ", "))
+		}
+		return nil, fmt.Errorf("no Chromium-based browsers found")
+	}
+	return targets, nil
+}
+
+// browserInstalled reports whether a browser appears to be installed: its user
+// data is found, or its external extensions directory or that directory's
+// parent, the application directory on Linux, exists
+func browserInstalled(fs fsys.FS, name string) bool {
+	for _, b := range browser.DetectChromiumBrowsers(fs) {
+		if b.Name == name {
+			return true
+		}
+	}
+	for _, target := range browser.ExternalTargets(fs) {
+		if target.Name == name && (fsys.Exists(fs, target.Dir) || fsys.Exists(fs, filepath.Dir(target.Dir))) {
+			return true
+		}
+	}
+	return false
+}
+
+// installExternal copies a CRX package to crxPath, unless it is empty, and
+// writes an external extension file for it in every target browser's directory
+func installExternal(ctx context.Context, packagePath string, manifest *types.Manifest, crxPath, extensionID string, opts InstallOptions) (err error) {
+	fs := opts.files()
+	logger := opts.logger().With(logging.KeyExtensionID, extensionID)
+
+	targets, err := selectTargets(opts.ProfileOptions, browser.ExternalTargets(fs), "external extension", true)
+	if err != nil {
+		return err
+	}
+
+	successCount := 0
+	entry := externalEntry{ExternalUpdateURL: updateURL(manifest, opts)}
+	if crxPath != "" {
+		existed := fsys.Exists(fs, crxPath)
+		defer func() {
+			if err != nil && !existed && successCount == 0 {
+				fs.Remove(crxPath)
+			}
+		}()
+		if err := copyPackage(fs, packagePath, crxPath); err != nil {
+			return err
+		}
+		logger.Info("extension package copied", logging.KeyStep, "copy", "name", manifest.Name, "path", crxPath)
+		entry = externalEntry{ExternalCRX: crxPath, ExternalVersion: manifest.Version}
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("install interrupted: %w", err)
+		}
+
+		browserLog := logger.With(logging.KeyBrowser, target.DisplayName)
+		path := filepath.Join(target.Dir, extensionID+".json")
+		if err := fs.MkdirAll(target.Dir, 0755); err != nil {
+			browserLog.Warn("browser failed", logging.KeyStep, "install", logging.KeyError, err)
+			continue
+		}
+		if err := fs.WriteFile(path, data, 0644); err != nil {
+			browserLog.Warn("browser failed", logging.KeyStep, "install", logging.KeyError, err)
+			continue
+		}
+		browserLog.Info("external extension file written", logging.KeyStep, "install", "path", path)
+		successCount++
+	}
+
+	if successCount == 0 {
+		return fmt.Errorf("failed to install extension to any browser")
+	}
+	logger.Info("extension installed", logging.KeyStep, "install", "browsers", successCount)
+	return nil
+}
+
+// copyPackage copies a package file to dest, creating its directory
+func copyPackage(fs fsys.FS, src, dest string) error {
+	data, err := fs.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return fs.WriteFile(dest, data, 0644)
+}
+
+// uninstallExternal removes the external extension files of an extension,
+// given its ID or the name of its CRX copy, and the CRX copy they point at
+func uninstallExternal(ctx context.Context, nameOrID string, opts ProfileOptions) error {
+	fs := opts.files()
+	root, err := opts.installRoot()
+	if err != nil {
+		return err
+	}
+
+	extensionID := nameOrID
+	if !isExtensionID(nameOrID) {
+		if validateName(nameOrID) != nil {
+			return fmt.Errorf("extension not found")
+		}
+		data, err := fs.ReadFile(filepath.Join(root, nameOrID+".crx"))
+		if err != nil {
+			return fmt.Errorf("extension not found")
+		}
+		key, err := crx.Verify(data, nil)
+		if err != nil {
+			return fmt.Errorf("CRX verification failed: %v", err)
+		}
+		extensionID = crx.ID(key)
+	}
+	logger := opts.logger().With(logging.KeyExtensionID, extensionID)
+
+	targets, err := selectTargets(opts, browser.ExternalTargets(fs), "external extension", false)
+	if err != nil {
+		return err
+	}
+
+	successCount := 0
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("uninstall interrupted: %w", err)
+		}
+
+		browserLog := logger.With(logging.KeyBrowser, target.DisplayName)
+		path := filepath.Join(target.Dir, extensionID+".json")
+		data, err := fs.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		// Only CRX copies made by this tool are removed
+		var entry externalEntry
+		if err == nil && json.Unmarshal(data, &entry) == nil && entry.ExternalCRX != "" && filepath.Dir(entry.ExternalCRX) == root {
+			if err := fs.Remove(entry.ExternalCRX); err != nil && !os.IsNotExist(err) {
+				browserLog.Warn("failed to remove extension package", logging.KeyStep, "uninstall", logging.KeyError, err)
+			}
+		}
+
+		if err := fs.Remove(path); err != nil {
+			browserLog.Warn("browser failed", logging.KeyStep, "uninstall", logging.KeyError, err)
+			continue
+		}
+		browserLog.Info("external extension file removed", logging.KeyStep, "uninstall", "path", path)
+		successCount++
+	}
+
+	if successCount == 0 {
+		return fmt.Errorf("extension not found")
+	}
+	logger.Info("extension uninstalled", logging.KeyStep, "uninstall", "browsers", successCount)
+	return nil
+}
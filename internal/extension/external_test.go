@@ -0,0 +1,141 @@
+package extension
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+)
+
+// externalDir returns the external extension directory of a browser in fs
+func externalDir(t *testing.T, fs fsys.FS, name string) string {
+	t.Helper()
+	for _, target := range browser.ExternalTargets(fs) {
+		if target.Name == name {
+			return target.Dir
+		}
+	}
+	t.Fatalf("no external extension directory for %s", name)
+	return ""
+}
+
+// newKeyedExtension writes an unpacked extension with a manifest key and
+// returns its path and the ID derived from the key
+func newKeyedExtension(t *testing.T, fs fsys.FS, updateURL string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	manifest := fmt.Sprintf(`{"manifest_version": 3, "name": "External", "version": "2.0", "key": %q, "update_url": %q}`,
+		base64.StdEncoding.EncodeToString(der), updateURL)
+	fs.MkdirAll("/home/user/external", 0755)
+	fs.WriteFile("/home/user/external/manifest.json", []byte(manifest), 0644)
+	return "/home/user/external", crx.ID(der)
+}
+
+func readExternalEntry(t *testing.T, fs fsys.FS, path string) externalEntry {
+	t.Helper()
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		t.Fatalf("external extension file %s: %v", path, err)
+	}
+	var entry externalEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("external extension file %s: %v", path, err)
+	}
+	return entry
+}
+
+func TestInstallExternal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reads no external extension files")
+	}
+
+	fs := fsys.NewMemory()
+	chromeDir := externalDir(t, fs, "chrome")
+	fs.MkdirAll(filepath.Dir(chromeDir), 0755)
+	path, extensionID := newKeyedExtension(t, fs, "https://example.com/updates.xml")
+	opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Method: MethodExternal, Logger: logging.Discard}}
+
+	if _, id, err := Verify(context.Background(), path, opts); err != nil || id != extensionID {
+		t.Fatalf("Verify() = %q, %v, want the ID of the manifest key %q", id, err, extensionID)
+	}
+
+	if err := Install(context.Background(), path, opts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	file := filepath.Join(chromeDir, extensionID+".json")
+	if entry := readExternalEntry(t, fs, file); entry != (externalEntry{ExternalUpdateURL: "https://example.com/updates.xml"}) {
+		t.Errorf("external extension file = %+v, want the manifest update_url", entry)
+	}
+	if fsys.Exists(fs, filepath.Join(externalDir(t, fs, "edge"), extensionID+".json")) {
+		t.Error("Install() wrote a file for a browser that is not installed")
+	}
+	if fsys.Exists(fs, testInstallRoot) {
+		t.Error("Install() copied files although the extension is served from its update URL")
+	}
+
+	// An explicit update URL wins, and selected browsers are written even if not installed
+	opts.UpdateURL = "https://example.org/other.xml"
+	opts.Browsers = []string{"edge"}
+	if err := Install(context.Background(), path, opts); err != nil {
+		t.Fatalf("Install(--browser edge) error = %v", err)
+	}
+	edgeFile := filepath.Join(externalDir(t, fs, "edge"), extensionID+".json")
+	if entry := readExternalEntry(t, fs, edgeFile); entry.ExternalUpdateURL != opts.UpdateURL {
+		t.Errorf("external_update_url = %q, want %q", entry.ExternalUpdateURL, opts.UpdateURL)
+	}
+
+	uninstallOpts := ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Method: MethodExternal, Logger: logging.Discard}
+	if err := Uninstall(context.Background(), extensionID, uninstallOpts); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if fsys.Exists(fs, file) || fsys.Exists(fs, edgeFile) {
+		t.Error("Uninstall() left external extension files behind")
+	}
+	if err := Uninstall(context.Background(), extensionID, uninstallOpts); err == nil || err.Error() != "extension not found" {
+		t.Errorf("second Uninstall() error = %v, want extension not found", err)
+	}
+}
+
+func TestInstallExternalRequirements(t *testing.T) {
+	fs := fsys.NewMemory()
+	fs.MkdirAll("/home/user/plain", 0755)
+	fs.WriteFile("/home/user/plain/manifest.json", []byte(`{"manifest_version": 3, "name": "Plain", "version": "1.0"}`), 0644)
+	keyed, _ := newKeyedExtension(t, fs, "")
+
+	tests := []struct {
+		name   string
+		path   string
+		method string
+		want   string
+	}{
+		{"no key", "/home/user/plain", MethodExternal, "manifest key"},
+		{"no update URL", keyed, MethodExternal, "update URL"},
+		{"unknown method", keyed, "registry", "unknown install method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Method: tt.method, Logger: logging.Discard}}
+			if _, _, err := Verify(context.Background(), tt.path, opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package extension
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+// Install root names accepted in place of a directory
+const (
+	// UserRoot selects DefaultInstallRoot
+	UserRoot = "user"
+	// SystemRoot selects SystemInstallRoot
+	SystemRoot = "system"
+)
+
+// DefaultInstallRoot returns the per-user directory extensions are copied into
+// when ProfileOptions.InstallRoot is not set: %APPDATA%\BrowserExtensions on
+// Windows, ~/Library/Application Support/cei/extensions on macOS and
+// $XDG_DATA_HOME/cei/extensions (~/.local/share by default) elsewhere
+func DefaultInstallRoot(fs fsys.FS) string {
+	return defaultInstallRoot(fs, runtime.GOOS)
+}
+
+func defaultInstallRoot(fs fsys.FS, goos string) string {
+	home, _ := fs.UserHomeDir()
+	switch goos {
+	case "windows":
+		appData := fs.Getenv("APPDATA")
+		if appData == "" {
+			appData = filepath.Join(home, "AppData", "Roaming")
+		}
+		return filepath.Join(appData, "BrowserExtensions")
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "cei", "extensions")
+	default:
+		dataHome := fs.Getenv("XDG_DATA_HOME")
+		if dataHome == "" {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dataHome, "cei", "extensions")
+	}
+}
+
+// SystemInstallRoot returns a directory readable by every user of the machine,
+// for installing extensions into all of their profiles:
+// %ProgramData%\BrowserExtensions on Windows, /Library/Application Support/cei/extensions
+// on macOS and /usr/local/share/cei/extensions elsewhere
+func SystemInstallRoot(fs fsys.FS) string {
+	return systemInstallRoot(fs, runtime.GOOS)
+}
+
+func systemInstallRoot(fs fsys.FS, goos string) string {
+	switch goos {
+	case "windows":
+		programData := fs.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "BrowserExtensions")
+	case "darwin":
+		return "/Library/Application Support/cei/extensions"
+	default:
+		return "/usr/local/share/cei/extensions"
+	}
+}
+
+// ResolveInstallRoot returns the absolute, cleaned directory for an install
+// root setting. Empty and UserRoot select DefaultInstallRoot and SystemRoot
+// selects SystemInstallRoot. Extension IDs are derived from paths below the
+// result, so the same root always yields the same IDs, whatever the working
+// directory or spelling of the setting.
+func ResolveInstallRoot(fs fsys.FS, root string) (string, error) {
+	switch root {
+	case "", UserRoot:
+		root = DefaultInstallRoot(fs)
+	case SystemRoot:
+		root = SystemInstallRoot(fs)
+	}
+
+	absolute, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid install root %s: %v", root, err)
+	}
+	return absolute, nil
+}
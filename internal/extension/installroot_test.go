@@ -0,0 +1,103 @@
+package extension
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+// testInstallRoot is the install root of the in-memory tests
+const testInstallRoot = "/home/user/AppData/Roaming/BrowserExtensions"
+
+func TestDefaultInstallRoot(t *testing.T) {
+	tests := []struct {
+		name string
+		goos string
+		env  map[string]string
+		want string
+	}{
+		{"windows", "windows", map[string]string{"APPDATA": "/roaming"}, filepath.Join("/roaming", "BrowserExtensions")},
+		{"windows without APPDATA", "windows", nil, filepath.Join("/home/user", "AppData", "Roaming", "BrowserExtensions")},
+		{"macOS", "darwin", nil, filepath.Join("/home/user", "Library", "Application Support", "cei", "extensions")},
+		{"linux", "linux", nil, filepath.Join("/home/user", ".local", "share", "cei", "extensions")},
+		{"linux with XDG_DATA_HOME", "linux", map[string]string{"XDG_DATA_HOME": "/data"}, filepath.Join("/data", "cei", "extensions")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := fsys.NewMemory()
+			for key, value := range tt.env {
+				fs.Env[key] = value
+			}
+			if got := defaultInstallRoot(fs, tt.goos); got != tt.want {
+				t.Errorf("defaultInstallRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemInstallRoot(t *testing.T) {
+	fs := fsys.NewMemory()
+	tests := []struct {
+		goos string
+		want string
+	}{
+		{"windows", filepath.Join(`C:\ProgramData`, "BrowserExtensions")},
+		{"darwin", "/Library/Application Support/cei/extensions"},
+		{"linux", "/usr/local/share/cei/extensions"},
+	}
+	for _, tt := range tests {
+		if got := systemInstallRoot(fs, tt.goos); got != tt.want {
+			t.Errorf("systemInstallRoot(%s) = %q, want %q", tt.goos, got, tt.want)
+		}
+	}
+
+	fs.Env["ProgramData"] = "/programdata"
+	if got, want := systemInstallRoot(fs, "windows"), filepath.Join("/programdata", "BrowserExtensions"); got != want {
+		t.Errorf("systemInstallRoot(windows) = %q, want %q", got, want)
+	}
+}
+
+func TestResolveInstallRoot(t *testing.T) {
+	fs := fsys.NewMemory()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		root string
+		want string
+	}{
+		{"", DefaultInstallRoot(fs)},
+		{UserRoot, DefaultInstallRoot(fs)},
+		{SystemRoot, SystemInstallRoot(fs)},
+		{"/srv/extensions/", "/srv/extensions"},
+		{"/srv/./other/../extensions", "/srv/extensions"},
+		{"extensions", filepath.Join(cwd, "extensions")},
+	}
+	for _, tt := range tests {
+		got, err := ResolveInstallRoot(fs, tt.root)
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveInstallRoot(%q) = %q, %v, want %q", tt.root, got, err, tt.want)
+		}
+	}
+}
+
+func TestInstallRootIDsAreStable(t *testing.T) {
+	fs := fsys.NewMemory()
+	fs.MkdirAll("/srv/extensions/Stable", 0755)
+
+	want := GetExtensionID("/srv/extensions/Stable")
+	for _, root := range []string{"/srv/extensions", "/srv/extensions/", "/srv/../srv/extensions"} {
+		_, id, err := findExtension(ProfileOptions{FS: fs, InstallRoot: root}, "Stable")
+		if err != nil || id != want {
+			t.Errorf("findExtension() with root %q = %q, %v, want %q", root, id, err, want)
+		}
+	}
+
+	if extensionID(`c:\Extensions\Stable`, "windows") != extensionID(`C:\Extensions\Stable`, "windows") {
+		t.Error("extensionID() depends on the case of the drive letter")
+	}
+}
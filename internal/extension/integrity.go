@@ -0,0 +1,162 @@
+package extension
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/policy"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+// Install methods, selecting how an extension is registered with browsers
+const (
+	// MethodPreferences adds the extension to each profile's signed preferences
+	MethodPreferences = "preferences"
+	// MethodExternal writes an external extension file per browser
+	MethodExternal = "external"
+	// MethodPolicy force-installs the extension through managed policy files
+	MethodPolicy = "policy"
+)
+
+// ProfileOptions controls how browser profiles are updated
+type ProfileOptions struct {
+	// Repair restores corrupt preference files from a backup instead of skipping the profile
+	Repair bool
+	// DeviceIDs supplies the machine identifiers; nil uses system.DefaultProvider
+	DeviceIDs system.DeviceIDProvider
+	// FS is the file system to install into; nil uses the real one
+	FS fsys.FS
+	// Jobs is the number of profiles processed concurrently; 0 uses DefaultJobs
+	Jobs int
+	// Logger receives diagnostics; nil uses slog.Default
+	Logger *slog.Logger
+	// Browsers limits the update to these browser names, such as "chrome"; empty means all
+	Browsers []string
+	// Profiles limits the update to these profile directories or display names; empty means all
+	Profiles []string
+	// InstallRoot is the directory extensions are copied into, or UserRoot or
+	// SystemRoot; empty uses DefaultInstallRoot. Relative paths are made absolute.
+	InstallRoot string
+	// BackupDir holds preference backups instead of each profile's own backup directory
+	BackupDir string
+	// Method is MethodPreferences, MethodExternal or MethodPolicy; empty means MethodPreferences
+	Method string
+}
+
+func (o ProfileOptions) logger() *slog.Logger {
+	if o.Logger == nil {
+		return slog.Default()
+	}
+	return o.Logger
+}
+
+func (o ProfileOptions) jobs() int {
+	if o.Jobs <= 0 {
+		return DefaultJobs
+	}
+	return o.Jobs
+}
+
+func (o ProfileOptions) files() fsys.FS {
+	if o.FS == nil {
+		return fsys.OS{}
+	}
+	return o.FS
+}
+
+func (o ProfileOptions) installRoot() (string, error) {
+	return ResolveInstallRoot(o.files(), o.InstallRoot)
+}
+
+func (o ProfileOptions) method() (string, error) {
+	switch o.Method {
+	case "", MethodPreferences:
+		return MethodPreferences, nil
+	case MethodExternal, MethodPolicy:
+		return o.Method, nil
+	default:
+		return "", fmt.Errorf("unknown install method %q (want %s, %s or %s)", o.Method, MethodPreferences, MethodExternal, MethodPolicy)
+	}
+}
+
+func (o ProfileOptions) backups() browser.Backups {
+	return browser.Backups{Root: o.BackupDir}
+}
+
+func (o ProfileOptions) deviceIDs() system.DeviceIDProvider {
+	if o.DeviceIDs == nil {
+		return system.DefaultProvider()
+	}
+	return o.DeviceIDs
+}
+
+// InstallOptions controls how Install verifies and deploys a package
+type InstallOptions struct {
+	ProfileOptions
+
+	// SHA256 is the expected hex digest of the package file
+	SHA256 string
+	// PublisherKey is a DER-encoded public key that must have signed the CRX
+	PublisherKey []byte
+	// Policy restricts which extensions may be installed
+	Policy *policy.Policy
+	// UpdateURL is where MethodPolicy, and MethodExternal instead of a copy of
+	// the CRX, point browsers at; empty uses the manifest's update_url where needed
+	UpdateURL string
+	// ManagedPolicy is the policy MethodPolicy writes, ManagedForcelist or
+	// ManagedSettings; empty means ManagedForcelist
+	ManagedPolicy string
+}
+
+// VerifyPackage checks the package checksum and, for CRX files, its signatures.
+// It reads the package without extracting anything and returns the CRX developer
+// key, or nil for other packages.
+func VerifyPackage(path string, opts InstallOptions) ([]byte, error) {
+	info, err := opts.files().Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		if opts.SHA256 != "" || opts.PublisherKey != nil {
+			return nil, fmt.Errorf("cannot verify checksum or signature of an unpacked directory")
+		}
+		return nil, nil
+	}
+
+	data, err := opts.files().ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return verifyBytes(data, opts)
+}
+
+// verifyBytes checks the checksum and CRX signatures of a package read into data
+func verifyBytes(data []byte, opts InstallOptions) ([]byte, error) {
+	if opts.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		actual := hex.EncodeToString(sum[:])
+		if !strings.EqualFold(actual, strings.TrimSpace(opts.SHA256)) {
+			return nil, fmt.Errorf("sha256 mismatch: expected %s, got %s", strings.ToLower(opts.SHA256), actual)
+		}
+	}
+
+	if !crx.IsCRX(data) {
+		if opts.PublisherKey != nil {
+			return nil, fmt.Errorf("publisher key is pinned but the package is not a CRX file")
+		}
+		return nil, nil
+	}
+
+	developerKey, err := crx.Verify(data, opts.PublisherKey)
+	if err != nil {
+		return nil, fmt.Errorf("CRX verification failed: %v", err)
+	}
+	return developerKey, nil
+}
@@ -0,0 +1,97 @@
+package extension
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+func TestVerifyPackageSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ext.zip")
+	os.WriteFile(path, []byte("package contents"), 0644)
+	sum := sha256.Sum256([]byte("package contents"))
+	digest := hex.EncodeToString(sum[:])
+
+	if _, err := VerifyPackage(path, InstallOptions{SHA256: digest}); err != nil {
+		t.Errorf("VerifyPackage() error = %v", err)
+	}
+	if _, err := VerifyPackage(path, InstallOptions{SHA256: strings.ToUpper(digest)}); err != nil {
+		t.Errorf("VerifyPackage() should accept upper-case digest, error = %v", err)
+	}
+
+	_, err := VerifyPackage(path, InstallOptions{SHA256: strings.Repeat("0", 64)})
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Errorf("VerifyPackage() error = %v, want sha256 mismatch", err)
+	}
+}
+
+func TestVerifyPackageRejectsUnsignedCRX(t *testing.T) {
+	data := []byte("Cr24")
+	data = binary.LittleEndian.AppendUint32(data, 3)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = append(data, "PK\x03\x04"...)
+	path := filepath.Join(t.TempDir(), "ext.crx")
+	os.WriteFile(path, data, 0644)
+
+	if _, err := VerifyPackage(path, InstallOptions{}); err == nil {
+		t.Error("VerifyPackage() should reject an unsigned CRX")
+	}
+
+	// Rejected before extraction, so Install fails the same way
+	if err := Install(context.Background(), path, InstallOptions{}); err == nil || !strings.Contains(err.Error(), "CRX verification failed") {
+		t.Errorf("Install() error = %v, want CRX verification failure", err)
+	}
+}
+
+func TestVerifyPackagePinnedKeyRequiresCRX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ext.zip")
+	os.WriteFile(path, []byte("PK\x03\x04"), 0644)
+
+	if _, err := VerifyPackage(path, InstallOptions{PublisherKey: []byte("key")}); err == nil {
+		t.Error("VerifyPackage() should reject a pinned key for non-CRX packages")
+	}
+	if _, err := VerifyPackage(t.TempDir(), InstallOptions{SHA256: "00"}); err == nil {
+		t.Error("VerifyPackage() should reject a checksum for directories")
+	}
+}
+
+// swappingFS replaces a file with other contents once it has been read
+type swappingFS struct {
+	*fsys.Memory
+	path  string
+	other []byte
+}
+
+func (s *swappingFS) ReadFile(name string) ([]byte, error) {
+	data, err := s.Memory.ReadFile(name)
+	if err == nil && name == s.path {
+		s.Memory.WriteFile(name, s.other, 0644)
+	}
+	return data, err
+}
+
+func TestVerifyExtractsTheBytesItChecked(t *testing.T) {
+	verified := zipArchive(t, map[string]string{"manifest.json": `{"manifest_version": 3, "name": "Verified", "version": "1.0"}`})
+	swapped := zipArchive(t, map[string]string{"manifest.json": `{"manifest_version": 3, "name": "Swapped", "version": "1.0"}`})
+	sum := sha256.Sum256(verified)
+
+	memory := fsys.NewMemory()
+	memory.WriteFile("/tmp/ext.zip", verified, 0644)
+	fs := &swappingFS{Memory: memory, path: "/tmp/ext.zip", other: swapped}
+
+	opts := InstallOptions{SHA256: hex.EncodeToString(sum[:]), ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot}}
+	manifest, _, err := Verify(context.Background(), "/tmp/ext.zip", opts)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if manifest.Name != "Verified" {
+		t.Errorf("Verify() extracted %q, want the package whose checksum was checked", manifest.Name)
+	}
+}
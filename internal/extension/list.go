@@ -0,0 +1,73 @@
+package extension
+
+import (
+	"path/filepath"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+// Installed describes an extension in the install root
+type Installed struct {
+	ID      string
+	Name    string
+	Version string
+	Path    string
+	// Profiles lists the profile directories whose preferences reference the extension
+	Profiles []string
+}
+
+// List returns the extensions in the install root, sorted by directory name,
+// with the profiles selected by opts that reference them. Profiles that cannot
+// be read are ignored; a missing install root yields an empty list.
+func List(opts ProfileOptions) ([]Installed, error) {
+	fs := opts.files()
+	root, err := opts.installRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	if !fsys.Exists(fs, root) {
+		return nil, nil
+	}
+	entries, err := fs.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []Installed
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		extensionPath := filepath.Join(root, entry.Name())
+		extension := Installed{ID: installedID(fs, extensionPath), Name: entry.Name(), Path: extensionPath}
+		if manifest, err := LoadManifest(fs, extensionPath); err == nil {
+			extension.Version = manifest.Version
+		}
+		installed = append(installed, extension)
+	}
+
+	// Browsers are optional: extension files may be listed without any
+	browsers, _ := detectBrowsers(opts)
+	for _, b := range browsers {
+		profiles, err := selectProfiles(b, opts)
+		if err != nil {
+			continue
+		}
+		for _, profile := range profiles {
+			ids, err := browser.InstalledExtensions(fs, profile)
+			if err != nil {
+				continue
+			}
+			for i := range installed {
+				for _, id := range ids {
+					if id == installed[i].ID {
+						installed[i].Profiles = append(installed[i].Profiles, profile)
+					}
+				}
+			}
+		}
+	}
+	return installed, nil
+}
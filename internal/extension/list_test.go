@@ -0,0 +1,95 @@
+package extension
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+// newListFS builds chrome with two profiles and installs an extension into "Profile 1" only
+func newListFS(t *testing.T) (*fsys.Memory, ProfileOptions) {
+	fs := fsys.NewMemory()
+	if _, err := fixture.Build(fs, fixture.Options{}); err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Listed", "version": "2.1"}`,
+	}), 0644)
+
+	opts := ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Logger: logging.Discard, DeviceIDs: &system.FakeProvider{SID: fixture.DefaultSID}}
+	installOpts := InstallOptions{ProfileOptions: opts}
+	installOpts.Profiles = []string{"Profile 1"}
+	if err := Install(context.Background(), "/home/user/ext.zip", installOpts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	return fs, opts
+}
+
+func TestList(t *testing.T) {
+	fs, opts := newListFS(t)
+	fs.MkdirAll(filepath.Join(testInstallRoot, "Broken"), 0755)
+
+	installed, err := List(opts)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(installed) != 2 {
+		t.Fatalf("List() returned %d extensions, want 2", len(installed))
+	}
+
+	broken, listed := installed[0], installed[1]
+	if broken.Name != "Broken" || broken.Version != "" || len(broken.Profiles) != 0 {
+		t.Errorf("List()[0] = %+v, want Broken without version or profiles", broken)
+	}
+
+	extensionPath := filepath.Join(testInstallRoot, "Listed")
+	if listed.ID != GetExtensionID(extensionPath) || listed.Version != "2.1" || listed.Path != extensionPath {
+		t.Errorf("List()[1] = %+v", listed)
+	}
+	if len(listed.Profiles) != 1 || filepath.Base(listed.Profiles[0]) != "Profile 1" {
+		t.Errorf("List()[1].Profiles = %v, want only Profile 1", listed.Profiles)
+	}
+}
+
+func TestListWithoutInstallRoot(t *testing.T) {
+	fs := fsys.NewMemory()
+	installed, err := List(ProfileOptions{FS: fs, InstallRoot: testInstallRoot})
+	if err != nil || len(installed) != 0 {
+		t.Errorf("List() = %v, %v, want nothing", installed, err)
+	}
+}
+
+func TestProfileFilters(t *testing.T) {
+	_, opts := newListFS(t)
+
+	tests := []struct {
+		name     string
+		browsers []string
+		profiles []string
+		wantErr  bool
+	}{
+		{name: "profile directory", profiles: []string{"Default"}},
+		{name: "display name", profiles: []string{"Person 1"}},
+		{name: "browser", browsers: []string{"chrome"}},
+		{name: "missing browser", browsers: []string{"brave"}, wantErr: true},
+		{name: "unknown browser", browsers: []string{"netscape"}, wantErr: true},
+		{name: "no matching profile", profiles: []string{"Profile 9"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := opts
+			opts.Browsers, opts.Profiles = tt.browsers, tt.profiles
+			err := Resign(context.Background(), opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Resign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+)
+
+// Managed policies MethodPolicy can write
+const (
+	// ManagedForcelist adds "<id>;<update url>" to ExtensionInstallForcelist
+	ManagedForcelist = "forcelist"
+	// ManagedSettings adds a force_installed entry to ExtensionSettings
+	ManagedSettings = "settings"
+)
+
+// PolicyFileName is the managed policy file this tool owns in each browser's
+// policy directory; other policy files are never touched
+const PolicyFileName = "cei.json"
+
+// Policy names in managed policy files
+const (
+	forcelistPolicy = "ExtensionInstallForcelist"
+	settingsPolicy  = "ExtensionSettings"
+)
+
+// policyID returns the extension ID for MethodPolicy, which needs an update
+// URL because browsers download force-installed extensions themselves
+func policyID(manifest *types.Manifest, publisherKey []byte, opts InstallOptions) (string, error) {
+	switch opts.ManagedPolicy {
+	case "", ManagedForcelist, ManagedSettings:
+	default:
+		return "", fmt.Errorf("unknown managed policy %q (want %s or %s)", opts.ManagedPolicy, ManagedForcelist, ManagedSettings)
+	}
+	if updateURL(manifest, opts) == "" {
+		return "", fmt.Errorf("the %s method needs an update URL", MethodPolicy)
+	}
+	return keyID(manifest, publisherKey)
+}
+
+// conflictingPolicyFile returns another file in the policy directory dir that
+// sets policy. Chromium does not merge a policy across the files of a
+// directory: the file whose name sorts last wins, so an entry in PolicyFileName
+// would either be ignored or hide the other file's entries.
+func conflictingPolicyFile(fs fsys.FS, dir, policy string) (string, error) {
+	entries, err := fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == PolicyFileName {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Browsers ignore files that are not JSON objects, and so does this
+		doc, err := loadPolicyFile(fs, path)
+		if err != nil {
+			continue
+		}
+		if _, ok := doc[policy]; ok {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// policyDocument is the content of a managed policy file
+type policyDocument map[string]interface{}
+
+// loadPolicyFile reads a managed policy file; a missing file is empty
+func loadPolicyFile(fs fsys.FS, path string) (policyDocument, error) {
+	doc := policyDocument{}
+	data, err := fs.ReadFile(path)
+	if os.IsNotExist(err) {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", path, err)
+	}
+	return doc, nil
+}
+
+// savePolicyFile writes a managed policy file, or removes it once it is empty
+func savePolicyFile(fs fsys.FS, path string, doc policyDocument) error {
+	if len(doc) == 0 {
+		if err := fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return fs.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// remove deletes every entry for extensionID from both extension policies and
+// reports whether there was one
+func (doc policyDocument) remove(extensionID string) bool {
+	removed := false
+
+	if list, ok := doc[forcelistPolicy].([]interface{}); ok {
+		kept := []interface{}{}
+		for _, item := range list {
+			if entry, ok := item.(string); ok && (entry == extensionID || strings.HasPrefix(entry, extensionID+";")) {
+				removed = true
+				continue
+			}
+			kept = append(kept, item)
+		}
+		doc[forcelistPolicy] = kept
+		if len(kept) == 0 {
+			delete(doc, forcelistPolicy)
+		}
+	}
+
+	if settings, ok := doc[settingsPolicy].(map[string]interface{}); ok {
+		if _, ok := settings[extensionID]; ok {
+			delete(settings, extensionID)
+			removed = true
+		}
+		if len(settings) == 0 {
+			delete(doc, settingsPolicy)
+		}
+	}
+	return removed
+}
+
+// add force-installs extensionID from url with the given managed policy,
+// replacing any entry it had before
+func (doc policyDocument) add(extensionID, url, managed string) {
+	doc.remove(extensionID)
+
+	if managed == ManagedSettings {
+		settings, ok := doc[settingsPolicy].(map[string]interface{})
+		if !ok {
+			settings = map[string]interface{}{}
+			doc[settingsPolicy] = settings
+		}
+		settings[extensionID] = map[string]interface{}{
+			"installation_mode": "force_installed",
+			"update_url":        url,
+		}
+		return
+	}
+
+	list, _ := doc[forcelistPolicy].([]interface{})
+	doc[forcelistPolicy] = append(list, extensionID+";"+url)
+}
+
+// installManaged adds the extension to the managed policy file of every target browser
+func installManaged(ctx context.Context, manifest *types.Manifest, extensionID string, opts InstallOptions) error {
+	fs := opts.files()
+	logger := opts.logger().With(logging.KeyExtensionID, extensionID)
+
+	targets, err := selectTargets(opts.ProfileOptions, browser.PolicyTargets(fs), "managed policy", true)
+	if err != nil {
+		return err
+	}
+
+	url := updateURL(manifest, opts)
+	policy := forcelistPolicy
+	if opts.ManagedPolicy == ManagedSettings {
+		policy = settingsPolicy
+	}
+	successCount := 0
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("install interrupted: %w", err)
+		}
+
+		browserLog := logger.With(logging.KeyBrowser, target.DisplayName)
+		path := filepath.Join(target.Dir, PolicyFileName)
+		other, err := conflictingPolicyFile(fs, target.Dir, policy)
+		if err == nil && other != "" {
+			err = fmt.Errorf("%s also sets %s, and browsers apply %s from one file only", other, policy, policy)
+		}
+		var doc policyDocument
+		if err == nil {
+			doc, err = loadPolicyFile(fs, path)
+		}
+		if err == nil {
+			doc.add(extensionID, url, opts.ManagedPolicy)
+			err = savePolicyFile(fs, path, doc)
+		}
+		if err != nil {
+			browserLog.Warn("browser failed", logging.KeyStep, "install", logging.KeyError, err)
+			continue
+		}
+		browserLog.Info("managed policy written", logging.KeyStep, "install", "path", path)
+		successCount++
+	}
+
+	if successCount == 0 {
+		return fmt.Errorf("failed to install extension to any browser")
+	}
+	logger.Info("extension installed", logging.KeyStep, "install", "browsers", successCount)
+	return nil
+}
+
+// uninstallManaged removes an extension, given its ID, from the managed policy
+// file of every browser
+func uninstallManaged(ctx context.Context, extensionID string, opts ProfileOptions) error {
+	if !isExtensionID(extensionID) {
+		return fmt.Errorf("the %s method uninstalls by extension ID", MethodPolicy)
+	}
+
+	fs := opts.files()
+	logger := opts.logger().With(logging.KeyExtensionID, extensionID)
+
+	targets, err := selectTargets(opts, browser.PolicyTargets(fs), "managed policy", false)
+	if err != nil {
+		return err
+	}
+
+	successCount := 0
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("uninstall interrupted: %w", err)
+		}
+
+		browserLog := logger.With(logging.KeyBrowser, target.DisplayName)
+		path := filepath.Join(target.Dir, PolicyFileName)
+		doc, err := loadPolicyFile(fs, path)
+		if err == nil && !doc.remove(extensionID) {
+			continue
+		}
+		if err == nil {
+			err = savePolicyFile(fs, path, doc)
+		}
+		if err != nil {
+			browserLog.Warn("browser failed", logging.KeyStep, "uninstall", logging.KeyError, err)
+			continue
+		}
+		browserLog.Info("managed policy entry removed", logging.KeyStep, "uninstall", "path", path)
+		successCount++
+	}
+
+	if successCount == 0 {
+		return fmt.Errorf("extension not found")
+	}
+	logger.Info("extension uninstalled", logging.KeyStep, "uninstall", "browsers", successCount)
+	return nil
+}
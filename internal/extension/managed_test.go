@@ -0,0 +1,165 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+)
+
+func readPolicyFile(t *testing.T, fs fsys.FS, path string) map[string]interface{} {
+	t.Helper()
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		t.Fatalf("policy file %s: %v", path, err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("policy file %s: %v", path, err)
+	}
+	return doc
+}
+
+func TestInstallManagedPolicy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("managed policy files are only read on Linux")
+	}
+
+	fs := fsys.NewMemory()
+	fs.MkdirAll("/opt/google/chrome", 0755)
+	policyDir := browser.PolicyTargets(fs)[0].Dir
+	policyFile := filepath.Join(policyDir, PolicyFileName)
+	fs.MkdirAll(policyDir, 0755)
+	fs.WriteFile(policyFile, []byte(`{"HomepageLocation": "https://example.com"}`), 0644)
+	fs.WriteFile(filepath.Join(policyDir, "other.json"), []byte(`{"ExtensionInstallBlocklist": ["keep"]}`), 0644)
+
+	path, extensionID := newKeyedExtension(t, fs, "https://example.com/updates.xml")
+	opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, Method: MethodPolicy, Logger: logging.Discard}}
+
+	if err := Install(context.Background(), path, opts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	doc := readPolicyFile(t, fs, policyFile)
+	if want := []interface{}{extensionID + ";https://example.com/updates.xml"}; !reflect.DeepEqual(doc[forcelistPolicy], want) {
+		t.Errorf("%s = %v, want %v", forcelistPolicy, doc[forcelistPolicy], want)
+	}
+	if doc["HomepageLocation"] != "https://example.com" {
+		t.Error("Install() dropped an existing policy")
+	}
+	if fsys.Exists(fs, filepath.Join(browser.PolicyTargets(fs)[1].Dir, PolicyFileName)) {
+		t.Error("Install() wrote a policy for a browser that is not installed")
+	}
+
+	// Switching to ExtensionSettings replaces the forcelist entry
+	opts.ManagedPolicy = ManagedSettings
+	opts.UpdateURL = "https://example.org/updates.xml"
+	if err := Install(context.Background(), path, opts); err != nil {
+		t.Fatalf("Install(settings) error = %v", err)
+	}
+	doc = readPolicyFile(t, fs, policyFile)
+	if _, ok := doc[forcelistPolicy]; ok {
+		t.Errorf("%s = %v, want it removed", forcelistPolicy, doc[forcelistPolicy])
+	}
+	want := map[string]interface{}{extensionID: map[string]interface{}{"installation_mode": "force_installed", "update_url": "https://example.org/updates.xml"}}
+	if !reflect.DeepEqual(doc[settingsPolicy], want) {
+		t.Errorf("%s = %v, want %v", settingsPolicy, doc[settingsPolicy], want)
+	}
+
+	uninstallOpts := ProfileOptions{FS: fs, Method: MethodPolicy, Logger: logging.Discard}
+	if err := Uninstall(context.Background(), extensionID, uninstallOpts); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if doc := readPolicyFile(t, fs, policyFile); !reflect.DeepEqual(doc, map[string]interface{}{"HomepageLocation": "https://example.com"}) {
+		t.Errorf("policy file after Uninstall() = %v, want only the unrelated policy", doc)
+	}
+	if data, _ := fs.ReadFile(filepath.Join(policyDir, "other.json")); string(data) != `{"ExtensionInstallBlocklist": ["keep"]}` {
+		t.Error("Uninstall() changed a policy file it does not own")
+	}
+	if err := Uninstall(context.Background(), extensionID, uninstallOpts); err == nil || err.Error() != "extension not found" {
+		t.Errorf("second Uninstall() error = %v, want extension not found", err)
+	}
+	if err := Uninstall(context.Background(), "External", uninstallOpts); err == nil || !strings.Contains(err.Error(), "extension ID") {
+		t.Errorf("Uninstall(name) error = %v, want it to require an ID", err)
+	}
+}
+
+func TestInstallManagedPolicyConflict(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("managed policy files are only read on Linux")
+	}
+
+	fs := fsys.NewMemory()
+	fs.MkdirAll("/opt/google/chrome", 0755)
+	policyDir := browser.PolicyTargets(fs)[0].Dir
+	fs.MkdirAll(policyDir, 0755)
+	fs.WriteFile(filepath.Join(policyDir, "admin.json"), []byte(`{"ExtensionInstallForcelist": ["admin"]}`), 0644)
+
+	path, _ := newKeyedExtension(t, fs, "https://example.com/updates.xml")
+	opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, Method: MethodPolicy, Logger: logging.Discard}}
+
+	// Another file sets the same policy, so only one of them would apply
+	if err := Install(context.Background(), path, opts); err == nil {
+		t.Fatal("Install() succeeded although admin.json sets the same policy")
+	}
+	if fsys.Exists(fs, filepath.Join(policyDir, PolicyFileName)) {
+		t.Error("Install() wrote a policy that conflicts with admin.json")
+	}
+
+	// ExtensionSettings is a different policy and can be used instead
+	opts.ManagedPolicy = ManagedSettings
+	if err := Install(context.Background(), path, opts); err != nil {
+		t.Errorf("Install(settings) error = %v", err)
+	}
+}
+
+func TestPolicyDocument(t *testing.T) {
+	id := strings.Repeat("a", 32)
+	doc := policyDocument{}
+	doc.add(id, "https://example.com/updates.xml", "")
+	doc.add(id, "https://example.com/updates.xml", ManagedForcelist)
+	if list := doc[forcelistPolicy].([]interface{}); len(list) != 1 {
+		t.Errorf("add() twice left %v, want a single entry", list)
+	}
+
+	if !doc.remove(id) || len(doc) != 0 {
+		t.Errorf("remove() left %v, want an empty document", doc)
+	}
+	if doc.remove(id) {
+		t.Error("remove() reported an entry that is gone")
+	}
+
+	fs := fsys.NewMemory()
+	fs.WriteFile("/policies/cei.json", []byte(`{}`), 0644)
+	if err := savePolicyFile(fs, "/policies/cei.json", doc); err != nil || fsys.Exists(fs, "/policies/cei.json") {
+		t.Errorf("savePolicyFile(empty) = %v, want the file removed", err)
+	}
+}
+
+func TestInstallManagedPolicyRequirements(t *testing.T) {
+	fs := fsys.NewMemory()
+	keyed, _ := newKeyedExtension(t, fs, "")
+
+	tests := []struct {
+		name    string
+		opts    InstallOptions
+		wantErr string
+	}{
+		{"no update URL", InstallOptions{}, "update URL"},
+		{"unknown policy", InstallOptions{UpdateURL: "https://example.com/updates.xml", ManagedPolicy: "blocklist"}, "unknown managed policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.ProfileOptions = ProfileOptions{FS: fs, Method: MethodPolicy, Logger: logging.Discard}
+			if _, _, err := Verify(context.Background(), keyed, tt.opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
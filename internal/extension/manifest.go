@@ -0,0 +1,286 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// knownPermissions lists the API permissions Chromium accepts in a manifest
+var knownPermissions = map[string]bool{
+	"accessibilityFeatures.modify": true, "accessibilityFeatures.read": true, "activeTab": true,
+	"alarms": true, "audio": true, "background": true, "bookmarks": true, "browsingData": true,
+	"certificateProvider": true, "clipboardRead": true, "clipboardWrite": true, "contentSettings": true,
+	"contextMenus": true, "cookies": true, "debugger": true, "declarativeContent": true,
+	"declarativeNetRequest": true, "declarativeNetRequestFeedback": true,
+	"declarativeNetRequestWithHostAccess": true, "declarativeWebRequest": true, "desktopCapture": true,
+	"documentScan": true, "downloads": true, "downloads.open": true, "downloads.shelf": true,
+	"downloads.ui": true, "enterprise.deviceAttributes": true, "enterprise.hardwarePlatform": true,
+	"enterprise.networkingAttributes": true, "enterprise.platformKeys": true, "experimental": true,
+	"favicon": true, "fileBrowserHandler": true, "fileSystemProvider": true, "fontSettings": true,
+	"gcm": true, "geolocation": true, "history": true, "identity": true, "identity.email": true,
+	"idle": true, "loginState": true, "management": true, "nativeMessaging": true,
+	"notifications": true, "offscreen": true, "pageCapture": true, "platformKeys": true,
+	"power": true, "printerProvider": true, "printing": true, "printingMetrics": true,
+	"privacy": true, "processes": true, "proxy": true, "readingList": true, "runtime": true,
+	"scripting": true, "search": true, "sessions": true, "sidePanel": true, "storage": true,
+	"system.cpu": true, "system.display": true, "system.memory": true, "system.storage": true,
+	"tabCapture": true, "tabGroups": true, "tabs": true, "topSites": true, "tts": true,
+	"ttsEngine": true, "unlimitedStorage": true, "userScripts": true, "vpnProvider": true,
+	"wallpaper": true, "webAuthenticationProxy": true, "webNavigation": true, "webRequest": true,
+	"webRequestAuthProvider": true, "webRequestBlocking": true,
+}
+
+var matchPatternRegex = regexp.MustCompile(`^(\*|https?|wss?|file|ftp|urn|chrome-extension)://[^/]*(/.*)?$`)
+
+// ManifestError lists every problem found while validating a manifest
+type ManifestError struct {
+	Problems []string
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("invalid manifest: %s", strings.Join(e.Problems, "; "))
+}
+
+func (e *ManifestError) addf(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// LoadManifest reads and parses manifest.json from an unpacked extension directory
+func LoadManifest(fs fsys.FS, dir string) (*types.Manifest, error) {
+	manifestData, err := fs.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("manifest.json not found: %v", err)
+	}
+
+	var manifest types.Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %v", err)
+	}
+
+	return &manifest, nil
+}
+
+// ValidateManifest checks a manifest against the extension files in dir and
+// returns a *ManifestError holding every problem found
+func ValidateManifest(fs fsys.FS, dir string, manifest *types.Manifest) error {
+	result := &ManifestError{}
+
+	if manifest.ManifestVersion != 2 && manifest.ManifestVersion != 3 {
+		result.addf("manifest_version must be 2 or 3, got %d", manifest.ManifestVersion)
+	}
+
+	if strings.TrimSpace(manifest.Name) == "" {
+		result.addf("name is required")
+	} else if err := validateName(manifest.Name); err != nil {
+		result.addf("name %q: %v", manifest.Name, err)
+	}
+
+	if manifest.Version == "" {
+		result.addf("version is required")
+	} else if err := validateVersion(manifest.Version); err != nil {
+		result.addf("version %q: %v", manifest.Version, err)
+	}
+
+	requireFile := func(field, path string) {
+		if path == "" {
+			return
+		}
+		if strings.HasPrefix(path, "/") {
+			path = path[1:]
+		}
+		info, err := fs.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil || info.IsDir() {
+			result.addf("%s references missing file %q", field, path)
+		}
+	}
+
+	if manifest.Background != nil {
+		if manifest.ManifestVersion == 3 && (len(manifest.Background.Scripts) > 0 || manifest.Background.Page != "") {
+			result.addf("background.scripts and background.page are not supported in manifest_version 3")
+		}
+		requireFile("background.service_worker", manifest.Background.ServiceWorker)
+		requireFile("background.page", manifest.Background.Page)
+		for i, script := range manifest.Background.Scripts {
+			requireFile(fmt.Sprintf("background.scripts[%d]", i), script)
+		}
+	}
+
+	for i, script := range manifest.ContentScripts {
+		for j, js := range script.JS {
+			requireFile(fmt.Sprintf("content_scripts[%d].js[%d]", i, j), js)
+		}
+		for j, css := range script.CSS {
+			requireFile(fmt.Sprintf("content_scripts[%d].css[%d]", i, j), css)
+		}
+	}
+
+	for _, size := range sortedKeys(manifest.Icons) {
+		requireFile(fmt.Sprintf("icons.%s", size), manifest.Icons[size])
+	}
+
+	actions := []struct {
+		field  string
+		action *types.ManifestAction
+	}{
+		{"action", manifest.Action},
+		{"browser_action", manifest.BrowserAction},
+		{"page_action", manifest.PageAction},
+	}
+	for _, a := range actions {
+		if a.action == nil {
+			continue
+		}
+		if manifest.ManifestVersion == 3 && a.field != "action" {
+			result.addf("%s is not supported in manifest_version 3, use action", a.field)
+		}
+		requireFile(a.field+".default_popup", a.action.DefaultPopup)
+		switch icon := a.action.DefaultIcon.(type) {
+		case string:
+			requireFile(a.field+".default_icon", icon)
+		case map[string]interface{}:
+			for _, size := range sortedKeys(icon) {
+				if path, ok := icon[size].(string); ok {
+					requireFile(fmt.Sprintf("%s.default_icon.%s", a.field, size), path)
+				}
+			}
+		}
+	}
+
+	validatePermissions := func(field string, permissions []string) {
+		for _, permission := range permissions {
+			if knownPermissions[permission] {
+				continue
+			}
+			if isHostPattern(permission) {
+				if manifest.ManifestVersion == 3 {
+					result.addf("%s: host pattern %q must be declared in host_permissions", field, permission)
+				}
+				continue
+			}
+			result.addf("%s: unknown permission %q", field, permission)
+		}
+	}
+	validatePermissions("permissions", manifest.Permissions)
+	validatePermissions("optional_permissions", manifest.OptionalPermissions)
+
+	for _, host := range manifest.HostPermissions {
+		if !isHostPattern(host) {
+			result.addf("host_permissions: invalid match pattern %q", host)
+		}
+	}
+
+	if len(result.Problems) > 0 {
+		return result
+	}
+	return nil
+}
+
+// validateVersion checks a version string the way Chromium does: one to four
+// dot-separated integers between 0 and 65535 without leading zeros
+func validateVersion(version string) error {
+	parts := strings.Split(version, ".")
+	if len(parts) > 4 {
+		return fmt.Errorf("must have at most 4 components")
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("contains an empty component")
+		}
+		if len(part) > 1 && part[0] == '0' {
+			return fmt.Errorf("component %q has a leading zero", part)
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || n > 65535 {
+			return fmt.Errorf("component %q must be an integer between 0 and 65535", part)
+		}
+	}
+	return nil
+}
+
+// validateName checks that an extension name can be used as the name of its
+// directory and CRX copy in the install root: no path separators, and not
+// only dots and spaces, which Windows strips to "." or ".."
+func validateName(name string) error {
+	if strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("must not contain path separators")
+	}
+	if strings.TrimRight(name, ". ") == "" {
+		return fmt.Errorf("must not consist of dots")
+	}
+	return nil
+}
+
+func isHostPattern(pattern string) bool {
+	return pattern == "<all_urls>" || matchPatternRegex.MatchString(pattern)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Unpack extracts a zip or CRX package, or copies an unpacked directory, into dest
+func Unpack(ctx context.Context, fs fsys.FS, src, dest string) error {
+	info, err := fs.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return utils.CopyRecursiveSync(fs, src, dest)
+	}
+
+	data, err := fs.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return unpackBytes(ctx, fs, data, dest)
+}
+
+// unpackBytes extracts a zip or CRX package read into data to dest
+func unpackBytes(ctx context.Context, fs fsys.FS, data []byte, dest string) error {
+	if crx.IsCRX(data) {
+		file, err := crx.Parse(data)
+		if err != nil {
+			return err
+		}
+		data = file.Archive
+	}
+
+	return utils.UnzipBytes(ctx, fs, data, dest)
+}
+
+// Validate unpacks the extension at path (zip, CRX or directory) and validates its manifest
+func Validate(ctx context.Context, fs fsys.FS, path string) (*types.Manifest, error) {
+	tempPath, err := fs.MkdirTemp("", "cei-validate-")
+	if err != nil {
+		return nil, err
+	}
+	defer fs.RemoveAll(tempPath)
+
+	if err := Unpack(ctx, fs, path, tempPath); err != nil {
+		return nil, fmt.Errorf("failed to extract package: %v", err)
+	}
+
+	manifest, err := LoadManifest(fs, tempPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, ValidateManifest(fs, tempPath, manifest)
+}
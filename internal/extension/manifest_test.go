@@ -0,0 +1,193 @@
+package extension
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+)
+
+func writeExtension(t *testing.T, manifest string, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644)
+	for _, file := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+	return dir
+}
+
+func TestValidateManifestValid(t *testing.T) {
+	dir := writeExtension(t, `{
+		"manifest_version": 3,
+		"name": "Test",
+		"version": "1.2.3.4",
+		"background": {"service_worker": "bg.js"},
+		"content_scripts": [{"matches": ["<all_urls>"], "js": ["cs/a.js"], "css": ["cs/a.css"]}],
+		"icons": {"16": "icon16.png"},
+		"action": {"default_popup": "popup.html", "default_icon": {"16": "icon16.png"}},
+		"permissions": ["tabs", "storage"],
+		"host_permissions": ["https://*/*", "<all_urls>"]
+	}`, "bg.js", "cs/a.js", "cs/a.css", "icon16.png", "popup.html")
+
+	manifest, err := LoadManifest(fsys.OS{}, dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if err := ValidateManifest(fsys.OS{}, dir, manifest); err != nil {
+		t.Errorf("ValidateManifest() error = %v", err)
+	}
+}
+
+func TestValidateManifestReportsAllProblems(t *testing.T) {
+	dir := writeExtension(t, `{
+		"manifest_version": 4,
+		"version": "1.02",
+		"background": {"service_worker": "missing.js"},
+		"content_scripts": [{"js": ["missing-cs.js"]}],
+		"icons": {"48": "missing.png"},
+		"action": {"default_popup": "missing.html"},
+		"permissions": ["tabs", "teleport"]
+	}`)
+
+	manifest, err := LoadManifest(fsys.OS{}, dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+
+	err = ValidateManifest(fsys.OS{}, dir, manifest)
+	var manifestErr *ManifestError
+	if !errors.As(err, &manifestErr) {
+		t.Fatalf("ValidateManifest() error = %v, want *ManifestError", err)
+	}
+
+	wants := []string{
+		"manifest_version",
+		"name is required",
+		"leading zero",
+		"background.service_worker",
+		"content_scripts[0].js[0]",
+		"icons.48",
+		"action.default_popup",
+		`unknown permission "teleport"`,
+	}
+	if len(manifestErr.Problems) != len(wants) {
+		t.Errorf("got %d problems, want %d: %v", len(manifestErr.Problems), len(wants), manifestErr.Problems)
+	}
+	for _, want := range wants {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err.Error(), want)
+		}
+	}
+}
+
+func TestValidateManifestHostPermissionsInMV3(t *testing.T) {
+	manifest := &types.Manifest{
+		ManifestVersion: 3,
+		Name:            "Test",
+		Version:         "1.0",
+		Permissions:     []string{"<all_urls>"},
+	}
+	if err := ValidateManifest(fsys.OS{}, t.TempDir(), manifest); err == nil {
+		t.Error("ValidateManifest() should reject host patterns in MV3 permissions")
+	}
+
+	manifest.ManifestVersion = 2
+	if err := ValidateManifest(fsys.OS{}, t.TempDir(), manifest); err != nil {
+		t.Errorf("ValidateManifest() error = %v, want nil for MV2", err)
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		valid   bool
+	}{
+		{"1", true},
+		{"1.0", true},
+		{"1.2.3.4", true},
+		{"0.65535", true},
+		{"1.2.3.4.5", false},
+		{"1..2", false},
+		{"01.0", false},
+		{"1.65536", false},
+		{"1.0-beta", false},
+		{"-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			err := validateVersion(tt.version)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateVersion(%q) error = %v, valid %v", tt.version, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"My Extension", true},
+		{"v1.0", true},
+		{"__MSG_appName__", true},
+		{"../../x", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{".", false},
+		{"..", false},
+		{".. ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateName(tt.name)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateName(%q) error = %v, valid %v", tt.name, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidatePackages(t *testing.T) {
+	manifest := `{"manifest_version": 3, "name": "Test", "version": "1.0"}`
+	dir := writeExtension(t, manifest)
+
+	zipPath := filepath.Join(t.TempDir(), "ext.zip")
+	zipFile, _ := os.Create(zipPath)
+	zipWriter := zip.NewWriter(zipFile)
+	fileWriter, _ := zipWriter.Create("manifest.json")
+	fileWriter.Write([]byte(manifest))
+	zipWriter.Close()
+	zipFile.Close()
+
+	zipData, _ := os.ReadFile(zipPath)
+	crxData := []byte("Cr24")
+	crxData = binary.LittleEndian.AppendUint32(crxData, 3)
+	crxData = binary.LittleEndian.AppendUint32(crxData, 0)
+	crxData = append(crxData, zipData...)
+	crxPath := filepath.Join(t.TempDir(), "ext.crx")
+	os.WriteFile(crxPath, crxData, 0644)
+
+	for _, path := range []string{dir, zipPath, crxPath} {
+		result, err := Validate(context.Background(), fsys.OS{}, path)
+		if err != nil {
+			t.Errorf("Validate(%q) error = %v", path, err)
+			continue
+		}
+		if result.Name != "Test" {
+			t.Errorf("Validate(%q) name = %q, want Test", path, result.Name)
+		}
+	}
+}
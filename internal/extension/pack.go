@@ -0,0 +1,37 @@
+package extension
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// Pack validates the unpacked extension in dir and returns it as a CRX3
+// package signed with key, along with the extension ID the key gives it
+func Pack(fs fsys.FS, dir string, key crypto.Signer) ([]byte, string, error) {
+	manifest, err := LoadManifest(fs, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ValidateManifest(fs, dir, manifest); err != nil {
+		return nil, "", err
+	}
+
+	archive, err := utils.ZipDirectory(fs, dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to zip %s: %v", dir, err)
+	}
+
+	data, err := crx.Pack(archive, key)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := crx.KeyID(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, id, nil
+}
@@ -0,0 +1,52 @@
+package extension
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+func TestPack(t *testing.T) {
+	key, _, err := crx.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writeExtension(t, `{"manifest_version": 3, "name": "Packed", "version": "1.0", "background": {"service_worker": "bg.js"}}`, "bg.js", ".git/HEAD")
+
+	data, id, err := Pack(fsys.OS{}, dir, key)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	developerKey, err := crx.Verify(data, nil)
+	if err != nil {
+		t.Fatalf("Pack() returned a package that does not verify: %v", err)
+	}
+	if crx.ID(developerKey) != id {
+		t.Errorf("Pack() ID = %s, want %s", id, crx.ID(developerKey))
+	}
+
+	crxPath := filepath.Join(t.TempDir(), "packed.crx")
+	os.WriteFile(crxPath, data, 0644)
+	manifest, err := Validate(context.Background(), fsys.OS{}, crxPath)
+	if err != nil || manifest.Name != "Packed" {
+		t.Errorf("Validate() of the package = %+v, %v", manifest, err)
+	}
+
+	again, _, _ := Pack(fsys.OS{}, dir, key)
+	file, _ := crx.Parse(data)
+	fileAgain, _ := crx.Parse(again)
+	if string(file.Archive) != string(fileAgain.Archive) {
+		t.Error("Pack() archive is not deterministic")
+	}
+
+	invalid := writeExtension(t, `{"manifest_version": 3, "name": "Broken", "version": "1.0", "background": {"service_worker": "missing.js"}}`)
+	var manifestErr *ManifestError
+	if _, _, err := Pack(fsys.OS{}, invalid, key); !errors.As(err, &manifestErr) {
+		t.Errorf("Pack() of an invalid extension error = %v, want *ManifestError", err)
+	}
+}
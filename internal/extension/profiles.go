@@ -0,0 +1,203 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// DefaultJobs is the number of profiles processed concurrently when ProfileOptions.Jobs is not set
+const DefaultJobs = 4
+
+// profileAction describes an operation applied to every profile of every browser
+type profileAction struct {
+	// step names the operation in log entries
+	step string
+	// update changes one profile and may return extra attributes to log on success
+	update func(profile string, signer *browser.Signer) ([]interface{}, error)
+	// unsigned actions do not write MACs, so no signer is resolved and update gets nil
+	unsigned bool
+}
+
+// browserRun holds one browser's resolved signer, its profiles and their results
+type browserRun struct {
+	browser   browser.Browser
+	signer    *browser.Signer
+	setupStep string
+	setupErr  error
+	profiles  []string
+	results   []profileResult
+}
+
+type profileResult struct {
+	attrs    []interface{}
+	repaired []string
+	err      error
+}
+
+// runProfiles applies action to all profiles of browsers using at most
+// opts.Jobs workers. Each browser's seed is read once up front and its signer
+// is shared by the workers. Results are logged in detection order once all
+// profiles are done, so output does not depend on scheduling. It returns the
+// number of browsers in which at least one profile succeeded.
+//
+// Once ctx is done no further profile is started; profiles already being
+// written are finished, so none is left half-updated. The context's error is
+// returned in that case.
+func runProfiles(ctx context.Context, browsers []browser.Browser, opts ProfileOptions, action profileAction) (int, error) {
+	logger := opts.logger()
+
+	runs := make([]*browserRun, len(browsers))
+	for i, b := range browsers {
+		run := &browserRun{browser: b}
+		runs[i] = run
+
+		// Resolve the MAC seed and device ID for this browser
+		if !action.unsigned {
+			signer, err := browser.NewSigner(ctx, b, opts.deviceIDs())
+			if err != nil {
+				run.setupStep, run.setupErr = "seed", fmt.Errorf("failed to get key: %v", err)
+				continue
+			}
+			run.signer = signer
+			logger.Debug("resolved signer", logging.KeyBrowser, b.DisplayName, logging.KeyStep, "seed",
+				"seed_bytes", len(signer.Key), "device_id", logging.Redact(signer.DeviceID))
+		}
+
+		// Get profiles for this browser
+		profiles, err := selectProfiles(b, opts)
+		if err != nil {
+			run.setupStep, run.setupErr = "profiles", fmt.Errorf("failed to get profiles: %v", err)
+			continue
+		}
+		if len(profiles) == 0 {
+			run.setupStep, run.setupErr = "profiles", fmt.Errorf("no profiles found")
+			continue
+		}
+		run.profiles = profiles
+		run.results = make([]profileResult, len(profiles))
+	}
+
+	// Every worker writes only to its own result slot
+	jobs := make(chan func())
+	var wg sync.WaitGroup
+	for i := 0; i < opts.jobs(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job()
+			}
+		}()
+	}
+	for _, run := range runs {
+		for i, profile := range run.profiles {
+			run, i, profile := run, i, profile
+			jobs <- func() {
+				result := &run.results[i]
+				if err := ctx.Err(); err != nil {
+					result.err = fmt.Errorf("skipped: %v", err)
+					return
+				}
+				result.repaired, result.err = withRepair(profile, opts, func() (err error) {
+					result.attrs, err = action.update(profile, run.signer)
+					return err
+				})
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	successCount := 0
+	for _, run := range runs {
+		browserLog := logger.With(logging.KeyBrowser, run.browser.DisplayName)
+		if run.setupErr != nil {
+			browserLog.Warn("skipping browser", logging.KeyStep, run.setupStep, logging.KeyError, run.setupErr)
+			continue
+		}
+
+		profileSuccessCount := 0
+		for i, result := range run.results {
+			profileLog := browserLog.With(logging.KeyProfile, run.profiles[i])
+			if len(result.repaired) > 0 {
+				profileLog.Warn("restored corrupt preferences from backup", logging.KeyStep, "repair", "files", result.repaired)
+			}
+			if result.err != nil {
+				profileLog.Warn("profile failed", logging.KeyStep, action.step, logging.KeyError, result.err)
+				continue
+			}
+			profileLog.Info("profile updated", append([]interface{}{logging.KeyStep, action.step}, result.attrs...)...)
+			profileSuccessCount++
+		}
+
+		if profileSuccessCount > 0 {
+			browserLog.Info("browser updated", logging.KeyStep, action.step, "profiles", profileSuccessCount)
+			successCount++
+		} else {
+			browserLog.Error("no profile updated", logging.KeyStep, action.step)
+		}
+	}
+	return successCount, ctx.Err()
+}
+
+// checkBrowserNames returns an error naming the first unsupported browser in names
+func checkBrowserNames(names []string) error {
+	known := browser.Names()
+	for _, name := range names {
+		if !utils.Contains(known, name) {
+			return fmt.Errorf("unknown browser %q (supported: %s)", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// detectBrowsers returns the detected browsers selected by opts.Browsers
+func detectBrowsers(opts ProfileOptions) ([]browser.Browser, error) {
+	if err := checkBrowserNames(opts.Browsers); err != nil {
+		return nil, err
+	}
+
+	var browsers []browser.Browser
+	for _, b := range browser.DetectChromiumBrowsers(opts.files()) {
+		if len(opts.Browsers) == 0 || utils.Contains(opts.Browsers, b.Name) {
+			browsers = append(browsers, b)
+		}
+	}
+	if len(browsers) == 0 {
+		if len(opts.Browsers) > 0 {
+			return nil, fmt.Errorf("none of the selected browsers found: %s", strings.Join(opts.Browsers, ", "))
+		}
+		return nil, fmt.Errorf("no Chromium-based browsers found")
+	}
+	return browsers, nil
+}
+
+// selectProfiles returns the paths of a browser's profiles selected by opts.Profiles
+func selectProfiles(b browser.Browser, opts ProfileOptions) ([]string, error) {
+	profiles, err := browser.GetProfiles(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, profile := range profiles {
+		if len(opts.Profiles) == 0 || utils.Contains(opts.Profiles, profile.Dir) || (profile.Name != "" && utils.Contains(opts.Profiles, profile.Name)) {
+			paths = append(paths, profile.Path)
+		}
+	}
+	return paths, nil
+}
+
+// logBrowsers logs the detected browsers
+func logBrowsers(logger *slog.Logger, browsers []browser.Browser) {
+	for _, b := range browsers {
+		logger.Info("detected browser", logging.KeyBrowser, b.DisplayName, logging.KeyStep, "detect", "user_data", b.ProfilePath)
+	}
+}
@@ -0,0 +1,227 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// newTestLogger returns a text logger into buf without timestamps, so runs can be compared
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+}
+
+// containsLine reports whether one line of output contains all parts
+func containsLine(output string, parts ...string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		found := true
+		for _, part := range parts {
+			found = found && strings.Contains(line, part)
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// newMultiProfileFS builds chrome and brave with many profiles, one of them corrupt
+func newMultiProfileFS(t *testing.T) (*fsys.Memory, []string) {
+	fs := fsys.NewMemory()
+	var names []string
+	for i := 0; i < 8; i++ {
+		names = append(names, fmt.Sprintf("Profile %d", i+1))
+	}
+
+	var profiles []string
+	for _, name := range []string{"chrome", "brave"} {
+		f, err := fixture.Build(fs, fixture.Options{Browser: name, Profiles: names})
+		if err != nil {
+			t.Fatalf("fixture.Build() error = %v", err)
+		}
+		profiles = append(profiles, f.Profiles...)
+	}
+
+	fs.WriteFile(filepath.Join(profiles[3], "Preferences"), []byte("{"), 0644)
+	return fs, profiles
+}
+
+func TestInstallParallelIsDeterministic(t *testing.T) {
+	var outputs []string
+	for _, jobs := range []int{1, 8} {
+		fs, profiles := newMultiProfileFS(t)
+		fs.MkdirAll("/home/user/ext", 0755)
+		fs.WriteFile("/home/user/ext/manifest.json", []byte(`{"manifest_version": 3, "name": "Parallel", "version": "1.0"}`), 0644)
+
+		var buf bytes.Buffer
+		opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Jobs: jobs, Logger: newTestLogger(&buf), DeviceIDs: &system.FakeProvider{SID: fixture.DefaultSID, VolumeSerial: "1234-ABCD"}}}
+		if err := Install(context.Background(), "/home/user/ext", opts); err != nil {
+			t.Errorf("Install() jobs=%d error = %v", jobs, err)
+		}
+		output := buf.String()
+		outputs = append(outputs, output)
+
+		extensionID := GetExtensionID(filepath.Join(testInstallRoot, "Parallel"))
+		for i, profile := range profiles {
+			doc := readPrefs(t, fs, filepath.Join(profile, "Secure Preferences"))
+			_, installed, _ := doc.Get("extensions.settings." + extensionID)
+			if installed != (i != 3) {
+				t.Errorf("jobs=%d: extension installed in %s = %v", jobs, profile, installed)
+			}
+		}
+
+		if !containsLine(output, `level=WARN msg="profile failed"`, `profile="`+profiles[3]+`"`) {
+			t.Errorf("jobs=%d: output does not report the corrupt profile:\n%s", jobs, output)
+		}
+	}
+
+	if outputs[0] != outputs[1] {
+		t.Errorf("output differs between sequential and parallel runs:\n%s\n---\n%s", outputs[0], outputs[1])
+	}
+}
+
+func TestResignParallel(t *testing.T) {
+	fs, profiles := newMultiProfileFS(t)
+
+	var buf bytes.Buffer
+	opts := ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Jobs: 3, Repair: true, Logger: newTestLogger(&buf), DeviceIDs: &system.FakeProvider{SID: fixture.DefaultSID}}
+	if err := Resign(context.Background(), opts); err != nil {
+		t.Errorf("Resign() error = %v", err)
+	}
+	output := buf.String()
+
+	// The corrupt profile has no backup, so repair fails and it is reported in place
+	var reported []string
+	for _, line := range strings.Split(output, "\n") {
+		for _, profile := range profiles {
+			if strings.Contains(line, `profile="`+profile+`"`) {
+				reported = append(reported, profile)
+			}
+		}
+	}
+	if len(reported) != len(profiles) || !utils.Contains(reported, profiles[3]) {
+		t.Fatalf("Resign() reported %d profiles, want %d:\n%s", len(reported), len(profiles), output)
+	}
+	for i := range profiles {
+		if reported[i] != profiles[i] {
+			t.Errorf("Resign() reported %s at position %d, want %s", reported[i], i, profiles[i])
+		}
+	}
+}
+
+func TestRunProfilesStopsBetweenProfiles(t *testing.T) {
+	fs, profiles := newMultiProfileFS(t)
+	browsers := browser.DetectChromiumBrowsers(fs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var updated []string
+	action := profileAction{
+		step: "test",
+		update: func(profile string, signer *browser.Signer) ([]interface{}, error) {
+			updated = append(updated, profile)
+			cancel()
+			return nil, nil
+		},
+	}
+
+	opts := ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Jobs: 1, Logger: logging.Discard, DeviceIDs: &system.FakeProvider{SID: fixture.DefaultSID}}
+	count, err := runProfiles(ctx, browsers, opts, action)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("runProfiles() error = %v, want context.Canceled", err)
+	}
+	if count != 1 || len(updated) != 1 || updated[0] != profiles[0] {
+		t.Errorf("runProfiles() updated %v in %d browser(s), want only %s", updated, count, profiles[0])
+	}
+}
+
+func TestInstallCanceledLeavesNoTrace(t *testing.T) {
+	fs, profiles := newMultiProfileFS(t)
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Canceled", "version": "1.0"}`,
+	}), 0644)
+	before, _ := fs.ReadFile(filepath.Join(profiles[0], "Secure Preferences"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Logger: logging.Discard, DeviceIDs: &system.FakeProvider{SID: fixture.DefaultSID}}}
+	if err := Install(ctx, "/home/user/ext.zip", opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Install() error = %v, want context.Canceled", err)
+	}
+
+	if entries, _ := fs.ReadDir(fs.TempDir()); len(entries) != 0 {
+		t.Errorf("Install() left %d temporary entries behind", len(entries))
+	}
+	if fsys.Exists(fs, filepath.Join(testInstallRoot, "Canceled")) {
+		t.Error("Install() left extension files behind")
+	}
+	if after, _ := fs.ReadFile(filepath.Join(profiles[0], "Secure Preferences")); !bytes.Equal(before, after) {
+		t.Error("Install() changed a profile after cancellation")
+	}
+}
+
+func TestInstallLogRedactsDeviceIDs(t *testing.T) {
+	fs, _ := newMultiProfileFS(t)
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Redacted", "version": "1.0"}`,
+	}), 0644)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Logger: logger, DeviceIDs: &system.FakeProvider{SID: fixture.DefaultSID, VolumeSerial: "1234-ABCD"}}}
+	if err := Install(context.Background(), "/home/user/ext.zip", opts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	output := buf.String()
+
+	for _, secret := range []string{"1234-ABCD", "S-1-5-21", "2222222222"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("debug log contains %q:\n%s", secret, output)
+		}
+	}
+
+	buf.Reset()
+	logVolumeSerial(context.Background(), logger, &system.FakeProvider{VolumeSerial: "1234-ABCD"}, "windows")
+	if output := buf.String(); strings.Contains(output, "1234-ABCD") || !strings.Contains(output, "****ABCD") {
+		t.Errorf("debug log does not contain only the redacted volume serial:\n%s", output)
+	}
+}
+
+func TestInstallWithoutVolumeSerial(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows MACs need the machine SID")
+	}
+	fs, _ := newMultiProfileFS(t)
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "No Serial", "version": "1.0"}`,
+	}), 0644)
+
+	// Outside Windows there is no vol command, and no device ID in MACs
+	provider := &system.FakeProvider{Err: fmt.Errorf("exec: \"cmd\": executable file not found")}
+	opts := InstallOptions{ProfileOptions: ProfileOptions{FS: fs, InstallRoot: testInstallRoot, Logger: logging.Discard, DeviceIDs: provider}}
+	if err := Install(context.Background(), "/home/user/ext.zip", opts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+}
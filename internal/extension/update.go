@@ -0,0 +1,261 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+	"github.com/yinxulai/chromium-extension-installer/internal/update"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// UpdateOptions controls how Update checks for and installs new versions
+type UpdateOptions struct {
+	InstallOptions
+
+	// Client sends update checks and downloads packages; nil uses http.DefaultClient
+	Client *http.Client
+}
+
+func (o UpdateOptions) client() *http.Client {
+	if o.Client == nil {
+		return http.DefaultClient
+	}
+	return o.Client
+}
+
+// UpdateResult is the outcome of checking one extension in the install root
+type UpdateResult struct {
+	// Name is the directory name of the extension
+	Name string
+	// ID is the extension ID the update server knows, derived from the publisher key
+	ID string
+	// From is the version installed before the check
+	From string
+	// To is the version the extension was updated to, or empty
+	To string
+	// Skipped explains why the extension was not checked
+	Skipped string
+	Err     error
+}
+
+// publisherKeyPath returns where the publisher key of the extension at extensionPath is recorded
+func publisherKeyPath(extensionPath string) string {
+	return extensionPath + ".pub"
+}
+
+// savePublisherKey records the CRX developer key an extension was installed
+// from next to its directory, as the extension ID update servers know it by
+// and the key later versions must be signed with. A nil key removes the record.
+func savePublisherKey(fs fsys.FS, extensionPath string, key []byte) error {
+	path := publisherKeyPath(extensionPath)
+	if key == nil {
+		if err := fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return fs.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: key}), 0644)
+}
+
+// loadPublisherKey returns the key recorded by savePublisherKey or else the
+// manifest key; nil when there is neither
+func loadPublisherKey(fs fsys.FS, extensionPath string, manifest *types.Manifest) ([]byte, error) {
+	data, err := fs.ReadFile(publisherKeyPath(extensionPath))
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("invalid publisher key record %s", publisherKeyPath(extensionPath))
+		}
+		return block.Bytes, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if manifest.Key == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(manifest.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest key: %v", err)
+	}
+	return key, nil
+}
+
+// Update checks the extensions in the install root, or those named by
+// nameOrIDs, against the update server in their manifest's update_url and
+// replaces each one that has a newer version in place. Update servers know
+// extensions by the ID of their publisher key, so only extensions installed
+// from a CRX package or with a manifest key can be checked; new versions must
+// be signed by the same key and pass the same checks as Install. Profiles are
+// left alone: browsers load the new files on their next start.
+func Update(ctx context.Context, nameOrIDs []string, opts UpdateOptions) ([]UpdateResult, error) {
+	fs := opts.files()
+	root, err := opts.installRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if len(nameOrIDs) > 0 {
+		for _, nameOrID := range nameOrIDs {
+			extensionPath, _, err := findExtension(opts.ProfileOptions, nameOrID)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", nameOrID, err)
+			}
+			paths = append(paths, extensionPath)
+		}
+	} else if fsys.Exists(fs, root) {
+		entries, err := fs.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			// Hidden directories are updates being staged
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				paths = append(paths, filepath.Join(root, entry.Name()))
+			}
+		}
+	}
+
+	var results []UpdateResult
+	for _, extensionPath := range paths {
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("update interrupted: %w", err)
+		}
+		results = append(results, updateExtension(ctx, extensionPath, opts))
+	}
+	return results, nil
+}
+
+// updateExtension checks one extension for a newer version and installs it
+func updateExtension(ctx context.Context, extensionPath string, opts UpdateOptions) UpdateResult {
+	fs := opts.files()
+	result := UpdateResult{Name: filepath.Base(extensionPath)}
+
+	manifest, err := LoadManifest(fs, extensionPath)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.From = manifest.Version
+	if manifest.UpdateURL == "" {
+		result.Skipped = "no update_url in manifest"
+		return result
+	}
+
+	key, err := loadPublisherKey(fs, extensionPath, manifest)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if key == nil {
+		result.Skipped = "not installed from a CRX package, so its update ID is unknown"
+		return result
+	}
+	result.ID = crx.ID(key)
+
+	logger := opts.logger().With(logging.KeyExtensionID, result.ID)
+	m, err := update.FetchManifest(ctx, opts.client(), manifest.UpdateURL, []update.Check{{ID: result.ID, Version: manifest.Version}})
+	if err != nil {
+		result.Err = fmt.Errorf("update check failed: %v", err)
+		return result
+	}
+
+	app, ok := m.App(result.ID)
+	if !ok || (app.Status != "" && app.Status != "ok") {
+		result.Err = fmt.Errorf("update server does not know the extension (status %q)", app.Status)
+		return result
+	}
+	check := app.UpdateCheck
+	if check == nil || check.Status == "noupdate" || utils.CompareVersions(check.Version, manifest.Version) <= 0 {
+		logger.Debug("extension is up to date", logging.KeyStep, "update", "version", manifest.Version)
+		return result
+	}
+	if check.Status != "" && check.Status != "ok" {
+		result.Err = fmt.Errorf("update server returned status %q", check.Status)
+		return result
+	}
+
+	logger.Info("downloading update", logging.KeyStep, "update", "version", check.Version, "url", check.Codebase)
+	data, err := update.Download(ctx, opts.client(), check.Codebase, check.HashSHA256)
+	if err != nil {
+		result.Err = fmt.Errorf("download failed: %v", err)
+		return result
+	}
+
+	if result.To, err = replaceExtension(ctx, extensionPath, manifest.Version, data, key, opts.InstallOptions); err != nil {
+		result.Err = err
+		return result
+	}
+	logger.Info("extension updated", logging.KeyStep, "update", "from", result.From, "to", result.To)
+	return result
+}
+
+// replaceExtension verifies a downloaded package like Install, requiring a
+// signature by key and a version newer than installed, and swaps it in for the
+// files at extensionPath. It returns the new version.
+func replaceExtension(ctx context.Context, extensionPath, installed string, data, key []byte, opts InstallOptions) (string, error) {
+	fs := opts.files()
+	opts.Method = MethodPreferences
+	opts.PublisherKey = key
+	opts.SHA256 = ""
+
+	tempDir, err := fs.MkdirTemp("", "cei-update-")
+	if err != nil {
+		return "", err
+	}
+	defer fs.RemoveAll(tempDir)
+	packagePath := filepath.Join(tempDir, "update.crx")
+	if err := fs.WriteFile(packagePath, data, 0644); err != nil {
+		return "", err
+	}
+
+	// Unpack next to the installed copy, so swapping them is a rename
+	stagingPath := filepath.Join(filepath.Dir(extensionPath), "."+filepath.Base(extensionPath)+".update")
+	oldPath := stagingPath + ".old"
+	fs.RemoveAll(stagingPath)
+	fs.RemoveAll(oldPath)
+	defer fs.RemoveAll(stagingPath)
+	if err := fs.MkdirAll(stagingPath, 0755); err != nil {
+		return "", err
+	}
+
+	manifest, publisherKey, newPath, _, err := prepare(ctx, packagePath, stagingPath, opts)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(publisherKey, key) {
+		return "", fmt.Errorf("update is signed by a different publisher key")
+	}
+	if utils.CompareVersions(manifest.Version, installed) <= 0 {
+		return "", fmt.Errorf("update has version %s, not newer than %s", manifest.Version, installed)
+	}
+	if newPath != extensionPath {
+		return "", fmt.Errorf("update renames the extension to %q; install it again instead", manifest.Name)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("update interrupted: %w", err)
+	}
+	if err := fs.Rename(extensionPath, oldPath); err != nil {
+		return "", err
+	}
+	if err := fs.Rename(stagingPath, extensionPath); err != nil {
+		fs.Rename(oldPath, extensionPath)
+		return "", err
+	}
+	fs.RemoveAll(oldPath)
+	return manifest.Version, nil
+}
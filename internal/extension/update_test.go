@@ -0,0 +1,156 @@
+package extension
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+	"github.com/yinxulai/chromium-extension-installer/internal/update"
+)
+
+// updatablePackage returns a CRX package of the extension "Updatable" at version, with one script of that name
+func updatablePackage(t *testing.T, key *ecdsa.PrivateKey, updateURL, version string) []byte {
+	t.Helper()
+	data, err := crx.Pack(zipArchive(t, map[string]string{
+		"manifest.json": fmt.Sprintf(`{"manifest_version": 3, "name": "Updatable", "version": %q, "update_url": %q}`, version, updateURL),
+		version + ".js": "// " + version,
+	}), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUpdate(t *testing.T) {
+	fs := fsys.NewMemory()
+	provider := &system.FakeProvider{SID: "S-1-5-21-1-2-3-1001", VolumeSerial: "1234-ABCD"}
+	if _, err := fixture.Build(fs, fixture.Options{Profiles: []string{"Default"}, DeviceIDs: provider}); err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+
+	packages := fsys.NewMemory()
+	packages.MkdirAll("/crxs", 0755)
+	server := httptest.NewServer(update.Handler(packages, "/crxs", "", logging.Discard))
+	defer server.Close()
+	updateURL := server.URL + update.ManifestPath
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fs.MkdirAll("/home/user/Downloads", 0755)
+	fs.WriteFile("/home/user/Downloads/updatable.crx", updatablePackage(t, key, updateURL, "1.0"), 0644)
+	fs.WriteFile("/home/user/Downloads/plain.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Plain", "version": "1.0"}`,
+	}), 0644)
+
+	opts := InstallOptions{ProfileOptions: ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: testInstallRoot}}
+	for _, path := range []string{"/home/user/Downloads/updatable.crx", "/home/user/Downloads/plain.zip"} {
+		if err := Install(context.Background(), path, opts); err != nil {
+			t.Fatalf("Install(%s) error = %v", path, err)
+		}
+	}
+	extensionPath := filepath.Join(testInstallRoot, "Updatable")
+	if !fsys.Exists(fs, publisherKeyPath(extensionPath)) {
+		t.Fatal("Install() of a CRX did not record its publisher key")
+	}
+
+	updateOpts := UpdateOptions{InstallOptions: opts, Client: server.Client()}
+	run := func(nameOrIDs ...string) []UpdateResult {
+		t.Helper()
+		results, err := Update(context.Background(), nameOrIDs, updateOpts)
+		if err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		return results
+	}
+
+	// Unknown to the server
+	results := run()
+	if len(results) != 2 || results[0].Name != "Plain" || results[0].Skipped == "" {
+		t.Fatalf("Update() = %+v, want Plain skipped first", results)
+	}
+	if id, _ := crx.KeyID(key); results[1].ID != id || results[1].Err == nil {
+		t.Errorf("Update() of an extension unknown to the server = %+v, want an error", results[1])
+	}
+
+	// Current
+	packages.WriteFile("/crxs/updatable-1.0.crx", updatablePackage(t, key, updateURL, "1.0"), 0644)
+	if results := run("Updatable"); len(results) != 1 || results[0].Err != nil || results[0].To != "" {
+		t.Errorf("Update() of a current extension = %+v", results)
+	}
+
+	// Newer version
+	packages.WriteFile("/crxs/updatable-1.1.crx", updatablePackage(t, key, updateURL, "1.1"), 0644)
+	results = run("Updatable")
+	if len(results) != 1 || results[0].Err != nil || results[0].From != "1.0" || results[0].To != "1.1" {
+		t.Fatalf("Update() = %+v, want 1.0 updated to 1.1", results)
+	}
+	if manifest, _ := LoadManifest(fs, extensionPath); manifest.Version != "1.1" {
+		t.Errorf("installed version = %s, want 1.1", manifest.Version)
+	}
+	if !fsys.Exists(fs, filepath.Join(extensionPath, "1.1.js")) || fsys.Exists(fs, filepath.Join(extensionPath, "1.0.js")) {
+		t.Error("Update() did not replace the extension files")
+	}
+	if entries, _ := fs.ReadDir(testInstallRoot); len(entries) != 5 {
+		t.Errorf("install root has %d entries after update, want Plain, Updatable, its key and their profile records", len(entries))
+	}
+
+	if err := Uninstall(context.Background(), "Updatable", opts.ProfileOptions); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if fsys.Exists(fs, publisherKeyPath(extensionPath)) {
+		t.Error("Uninstall() left the publisher key record behind")
+	}
+}
+
+func TestUpdateRejectsOtherPublisher(t *testing.T) {
+	fs := fsys.NewMemory()
+	provider := &system.FakeProvider{SID: "S-1-5-21-1-2-3-1001", VolumeSerial: "1234-ABCD"}
+	if _, err := fixture.Build(fs, fixture.Options{Profiles: []string{"Default"}, DeviceIDs: provider}); err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	id, _ := crx.KeyID(key)
+
+	// A server offering a package signed by someone else under the installed ID
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/evil.crx" {
+			w.Write(updatablePackage(t, other, server.URL, "2.0"))
+			return
+		}
+		m := &update.Manifest{Apps: []update.App{{ID: id, Status: "ok", UpdateCheck: &update.UpdateCheck{Version: "2.0", Codebase: server.URL + "/evil.crx"}}}}
+		data, _ := m.Encode()
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	fs.MkdirAll("/home/user/Downloads", 0755)
+	fs.WriteFile("/home/user/Downloads/updatable.crx", updatablePackage(t, key, server.URL, "1.0"), 0644)
+	opts := InstallOptions{ProfileOptions: ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: testInstallRoot}}
+	if err := Install(context.Background(), "/home/user/Downloads/updatable.crx", opts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	results, err := Update(context.Background(), nil, UpdateOptions{InstallOptions: opts, Client: server.Client()})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Err == nil || results[0].To != "" {
+		t.Fatalf("Update() with a package from another publisher = %+v, want an error", results)
+	}
+	if manifest, _ := LoadManifest(fs, filepath.Join(testInstallRoot, "Updatable")); manifest.Version != "1.0" {
+		t.Errorf("installed version = %s, want 1.0 kept", manifest.Version)
+	}
+}
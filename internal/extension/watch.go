@@ -0,0 +1,322 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// DefaultWatchInterval is how often Watch checks profiles when WatchOptions.Interval is not set
+const DefaultWatchInterval = time.Minute
+
+// watchSettle is how long Watch lets a burst of changes settle before checking
+const watchSettle = 500 * time.Millisecond
+
+// WatchOptions controls how Watch keeps extensions installed
+type WatchOptions struct {
+	ProfileOptions
+
+	// Interval is how often profiles are checked besides change notifications,
+	// which are only available on Linux; 0 uses DefaultWatchInterval
+	Interval time.Duration
+}
+
+func (o WatchOptions) interval() time.Duration {
+	if o.Interval <= 0 {
+		return DefaultWatchInterval
+	}
+	return o.Interval
+}
+
+// watchTarget is an extension in the install root that a profile should have
+type watchTarget struct {
+	browser       string
+	profile       string
+	extensionID   string
+	extensionPath string
+}
+
+// watchState is what Watch remembers between checks
+type watchState struct {
+	opts WatchOptions
+	// targets are the entries the last check expected, keyed by profile and
+	// extension ID
+	targets map[string]watchTarget
+	// waiting holds the browsers Watch has reported it waits for
+	waiting map[string]bool
+}
+
+// profilesPath returns where the profiles the extension at extensionPath was
+// installed into are recorded
+func profilesPath(extensionPath string) string {
+	return extensionPath + ".profiles"
+}
+
+// loadProfiles returns the profiles recorded by saveProfiles, or nil for an
+// extension installed without a record
+func loadProfiles(fs fsys.FS, extensionPath string) map[string]bool {
+	data, err := fs.ReadFile(profilesPath(extensionPath))
+	if err != nil {
+		return nil
+	}
+	var profiles []string
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil
+	}
+	set := map[string]bool{}
+	for _, profile := range profiles {
+		set[profile] = true
+	}
+	return set
+}
+
+// saveProfiles adds profiles to the record of where the extension at
+// extensionPath is installed, which Watch keeps it in. Nil profiles remove
+// the record.
+func saveProfiles(fs fsys.FS, extensionPath string, profiles []string) error {
+	path := profilesPath(extensionPath)
+	if profiles == nil {
+		if err := fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	set := loadProfiles(fs, extensionPath)
+	if set == nil {
+		set = map[string]bool{}
+	}
+	for _, profile := range profiles {
+		set[profile] = true
+	}
+	all := make([]string, 0, len(set))
+	for profile := range set {
+		all = append(all, profile)
+	}
+	sort.Strings(all)
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(path, data, 0644)
+}
+
+// Watch keeps the extensions in the install root registered in the profiles
+// selected by opts until ctx is done. Each extension belongs in the profiles
+// Install recorded for it; extensions installed without a record belong in
+// the profiles that had their entry when Watch first saw it. When Chromium
+// drops the entry from extensions.settings, or its MAC stops matching because
+// a browser update changed the seed, Watch waits until the browser is closed
+// and installs or re-signs the entry again. Extensions removed from the
+// install root are no longer watched.
+//
+// Profiles are checked every opts.Interval and, on Linux, whenever the user
+// data, profile or application directories change.
+func Watch(ctx context.Context, opts WatchOptions) error {
+	state := &watchState{opts: opts, targets: map[string]watchTarget{}, waiting: map[string]bool{}}
+	logger := opts.logger()
+
+	// Change notifications need the real file system
+	var notifier fsys.Watcher
+	var events <-chan struct{}
+	if _, ok := opts.files().(fsys.OS); ok {
+		var err error
+		if notifier, err = fsys.NewWatcher(); err == nil {
+			defer notifier.Close()
+			events = notifier.Events()
+		} else {
+			logger.Info("change notifications unavailable, polling", logging.KeyStep, "watch", "interval", opts.interval(), logging.KeyError, err)
+		}
+	}
+
+	ticker := time.NewTicker(opts.interval())
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		dirs, err := state.check(ctx)
+		if err != nil {
+			if first {
+				return err
+			}
+			logger.Warn("check failed", logging.KeyStep, "watch", logging.KeyError, err)
+		}
+		if first {
+			logger.Info("watching extensions", logging.KeyStep, "watch", "targets", len(state.targets))
+		}
+		if notifier != nil {
+			for _, dir := range dirs {
+				if err := notifier.Add(dir); err != nil {
+					logger.Debug("cannot watch directory", logging.KeyStep, "watch", "dir", dir, logging.KeyError, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-events:
+			// Browsers write several files at once; check after they are done
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(watchSettle):
+			}
+			for len(events) > 0 {
+				<-events
+			}
+		}
+	}
+}
+
+// check expects the extensions in the install root in the selected profiles
+// they belong in and restores the entries profiles lack, unless their browser
+// is running. It returns the directories whose changes should trigger the
+// next check.
+func (s *watchState) check(ctx context.Context) ([]string, error) {
+	opts := s.opts.ProfileOptions
+	fs := opts.files()
+	logger := opts.logger()
+
+	root, err := opts.installRoot()
+	if err != nil {
+		return nil, err
+	}
+	type rootExtension struct {
+		path     string
+		profiles map[string]bool
+	}
+	installed := map[string]rootExtension{}
+	if fsys.Exists(fs, root) {
+		entries, err := fs.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				extensionPath := filepath.Join(root, entry.Name())
+				installed[installedID(fs, extensionPath)] = rootExtension{path: extensionPath, profiles: loadProfiles(fs, extensionPath)}
+			}
+		}
+	}
+
+	browsers, err := detectBrowsers(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	detected := map[string]browser.Browser{}
+	targets := map[string]watchTarget{}
+	var dirs []string
+	for _, b := range browsers {
+		detected[b.Name] = b
+		dirs = append(dirs, b.ProfilePath)
+		if b.AppPath != "" {
+			dirs = append(dirs, b.AppPath)
+		}
+
+		profiles, err := selectProfiles(b, opts)
+		if err != nil {
+			continue
+		}
+		for _, profile := range profiles {
+			dirs = append(dirs, profile)
+			var registered []string
+			for id, extension := range installed {
+				key := profile + "\x00" + id
+				if extension.profiles != nil {
+					if !extension.profiles[profile] {
+						continue
+					}
+				} else if _, watched := s.targets[key]; !watched {
+					// Without a record, only profiles that have the entry keep it
+					if registered == nil {
+						registered, _ = browser.InstalledExtensions(fs, profile)
+					}
+					if !utils.Contains(registered, id) {
+						continue
+					}
+				}
+				targets[key] = watchTarget{browser: b.Name, profile: profile, extensionID: id, extensionPath: extension.path}
+			}
+		}
+	}
+	s.targets = targets
+
+	keys := make([]string, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	signers := map[string]*browser.Signer{}
+	running := map[string]bool{}
+	for _, key := range keys {
+		target := targets[key]
+		b := detected[target.browser]
+		targetLog := logger.With(logging.KeyBrowser, b.DisplayName, logging.KeyProfile, target.profile, logging.KeyExtensionID, target.extensionID)
+
+		// The seed is read on every check, as a browser update may change it
+		signer, ok := signers[b.Name]
+		if !ok {
+			if signer, err = browser.NewSigner(ctx, b, opts.deviceIDs()); err != nil {
+				targetLog.Warn("skipping browser", logging.KeyStep, "seed", logging.KeyError, err)
+			}
+			signers[b.Name] = signer
+		}
+		if signer == nil {
+			continue
+		}
+
+		registered, signed, err := browser.ExtensionState(fs, target.profile, target.extensionID, target.extensionPath, signer)
+		if err != nil {
+			targetLog.Warn("cannot read profile", logging.KeyStep, "watch", logging.KeyError, err)
+			continue
+		}
+		if registered && signed {
+			continue
+		}
+
+		if _, ok := running[b.Name]; !ok {
+			running[b.Name] = browser.IsRunning(b)
+		}
+		if running[b.Name] {
+			if !s.waiting[b.Name] {
+				targetLog.Info("extension lost, waiting for the browser to close", logging.KeyStep, "watch", "registered", registered)
+				s.waiting[b.Name] = true
+			}
+			continue
+		}
+
+		step := "install"
+		_, err = withRepair(target.profile, opts, func() error {
+			if registered {
+				// Only the MAC is stale: re-sign the entry, keeping its flags
+				step = "resign"
+				return browser.SetExtensionFlags(fs, opts.backups(), target.profile, target.extensionID, browser.ExtensionFlags{}, signer)
+			}
+			return browser.UpdateProfile(fs, opts.backups(), target.profile, target.extensionID, target.extensionPath, signer)
+		})
+		if err != nil {
+			targetLog.Warn("failed to restore extension", logging.KeyStep, step, logging.KeyError, err)
+			continue
+		}
+		targetLog.Info("extension restored", logging.KeyStep, step)
+	}
+
+	for name := range s.waiting {
+		if !running[name] {
+			delete(s.waiting, name)
+		}
+	}
+	return dirs, nil
+}
@@ -0,0 +1,66 @@
+package extension
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+func TestWatchNotifiesOnProfileRewrite(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	fs := fsys.OS{}
+	provider := &system.FakeProvider{}
+	chromium, err := fixture.Build(fs, fixture.Options{Browser: "chromium", NoApplication: true, Profiles: []string{"Default"}, DeviceIDs: provider})
+	if err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+
+	source := filepath.Join(home, "ext.zip")
+	if err := os.WriteFile(source, zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Watched", "version": "1.0"}`,
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: filepath.Join(home, "extensions"), Browsers: []string{"chromium"}, Logger: logging.Discard}
+	if err := Install(context.Background(), source, InstallOptions{ProfileOptions: opts}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	extensionPath := filepath.Join(home, "extensions", "Watched")
+
+	// Polling alone would not notice the change before the deadline
+	handler := &startedHandler{Handler: logging.Discard.Handler(), started: make(chan struct{})}
+	opts.Logger = slog.New(handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Watch(ctx, WatchOptions{ProfileOptions: opts, Interval: time.Hour}) }()
+
+	<-handler.started
+	profile := chromium.Profiles[0]
+	browser.RemoveFromProfile(fs, browser.Backups{}, profile, GetExtensionID(extensionPath), chromium.Signer)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if registered, _ := extensionState(t, fs, chromium.Browser, profile, extensionPath, provider); registered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Watch() did not re-check after the profile was rewritten")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch() error = %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package extension
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fixture"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+// newWatchFixture installs an extension into a fake browser with one profile
+func newWatchFixture(t *testing.T) (*fsys.Memory, *fixture.Fixture, WatchOptions, string) {
+	t.Helper()
+	fs := fsys.NewMemory()
+	provider := &system.FakeProvider{SID: "S-1-5-21-1-2-3-1001", VolumeSerial: "1234-ABCD"}
+	chrome, err := fixture.Build(fs, fixture.Options{Profiles: []string{"Default"}, DeviceIDs: provider})
+	if err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+
+	fs.MkdirAll("/home/user/Downloads", 0755)
+	fs.WriteFile("/home/user/Downloads/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Watched", "version": "1.0"}`,
+	}), 0644)
+	opts := ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: testInstallRoot, Logger: logging.Discard}
+	if err := Install(context.Background(), "/home/user/Downloads/ext.zip", InstallOptions{ProfileOptions: opts}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	return fs, chrome, WatchOptions{ProfileOptions: opts}, filepath.Join(testInstallRoot, "Watched")
+}
+
+func extensionState(t *testing.T, fs fsys.FS, b browser.Browser, profile, extensionPath string, provider system.DeviceIDProvider) (bool, bool) {
+	t.Helper()
+	signer, err := browser.NewSigner(context.Background(), b, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered, signed, err := browser.ExtensionState(fs, profile, GetExtensionID(extensionPath), extensionPath, signer)
+	if err != nil {
+		t.Fatalf("ExtensionState() error = %v", err)
+	}
+	return registered, signed
+}
+
+func TestWatchCheckRestoresLostExtension(t *testing.T) {
+	fs, chrome, opts, extensionPath := newWatchFixture(t)
+	profile, extensionID := chrome.Profiles[0], GetExtensionID(extensionPath)
+	state := &watchState{opts: opts, targets: map[string]watchTarget{}, waiting: map[string]bool{}}
+
+	dirs, err := state.check(context.Background())
+	if err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if len(state.targets) != 1 {
+		t.Fatalf("check() targets = %+v, want the installed extension", state.targets)
+	}
+	if len(dirs) == 0 || dirs[0] != chrome.Browser.ProfilePath {
+		t.Errorf("check() dirs = %v, want the user data directory first", dirs)
+	}
+
+	// Chromium resets the entry while it runs; nothing is written until it exits
+	browser.RemoveFromProfile(fs, browser.Backups{}, profile, extensionID, chrome.Signer)
+	lock := filepath.Join(chrome.Browser.ProfilePath, "SingletonLock")
+	fs.WriteFile(lock, nil, 0644)
+	state.check(context.Background())
+	if registered, _ := extensionState(t, fs, chrome.Browser, profile, extensionPath, opts.DeviceIDs); registered {
+		t.Error("check() restored the extension while the browser was running")
+	}
+
+	fs.Remove(lock)
+	state.check(context.Background())
+	if registered, signed := extensionState(t, fs, chrome.Browser, profile, extensionPath, opts.DeviceIDs); !registered || !signed {
+		t.Errorf("after check() the extension is registered %v, signed %v; want both", registered, signed)
+	}
+}
+
+func TestWatchCheckRestoresExtensionMissingAtStartup(t *testing.T) {
+	fs, chrome, opts, extensionPath := newWatchFixture(t)
+	profile := chrome.Profiles[0]
+
+	// The entry is already gone when watching starts
+	browser.RemoveFromProfile(fs, browser.Backups{}, profile, GetExtensionID(extensionPath), chrome.Signer)
+	state := &watchState{opts: opts, targets: map[string]watchTarget{}, waiting: map[string]bool{}}
+	if _, err := state.check(context.Background()); err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if registered, signed := extensionState(t, fs, chrome.Browser, profile, extensionPath, opts.DeviceIDs); !registered || !signed {
+		t.Errorf("after check() the extension is registered %v, signed %v; want both", registered, signed)
+	}
+}
+
+func TestWatchCheckResignsAfterBrowserUpdate(t *testing.T) {
+	fs, chrome, opts, extensionPath := newWatchFixture(t)
+	profile, extensionID := chrome.Profiles[0], GetExtensionID(extensionPath)
+	incognito := true
+	browser.SetExtensionFlags(fs, browser.Backups{}, profile, extensionID, browser.ExtensionFlags{Incognito: &incognito}, chrome.Signer)
+	state := &watchState{opts: opts, targets: map[string]watchTarget{}, waiting: map[string]bool{}}
+	state.check(context.Background())
+
+	// The update ships a new version with a different seed
+	if err := chrome.Update("121.0.6167.85", make([]byte, 64)); err != nil {
+		t.Fatal(err)
+	}
+	if registered, signed := extensionState(t, fs, chrome.Browser, profile, extensionPath, opts.DeviceIDs); !registered || signed {
+		t.Fatalf("after the update the extension is registered %v, signed %v; want a stale MAC", registered, signed)
+	}
+
+	state.check(context.Background())
+	if registered, signed := extensionState(t, fs, chrome.Browser, profile, extensionPath, opts.DeviceIDs); !registered || !signed {
+		t.Errorf("after check() the extension is registered %v, signed %v; want both", registered, signed)
+	}
+	doc := readPrefs(t, fs, filepath.Join(profile, "Secure Preferences"))
+	if incognito, _, _ := doc.Get("extensions.settings." + extensionID + ".incognito"); incognito != true {
+		t.Error("re-signing lost the extension's flags")
+	}
+}
+
+func TestWatchCheckForgetsUninstalledExtensions(t *testing.T) {
+	fs, _, opts, extensionPath := newWatchFixture(t)
+	state := &watchState{opts: opts, targets: map[string]watchTarget{}, waiting: map[string]bool{}}
+	state.check(context.Background())
+
+	if err := Uninstall(context.Background(), "Watched", opts.ProfileOptions); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if fsys.Exists(fs, profilesPath(extensionPath)) {
+		t.Error("Uninstall() left the profile record behind")
+	}
+	state.check(context.Background())
+	if len(state.targets) != 0 {
+		t.Errorf("check() targets after uninstall = %+v, want none", state.targets)
+	}
+}
+
+func TestWatchCheckKeepsExtensionsInTheirProfiles(t *testing.T) {
+	fs := fsys.NewMemory()
+	provider := &system.FakeProvider{SID: "S-1-5-21-1-2-3-1001"}
+	chrome, err := fixture.Build(fs, fixture.Options{Profiles: []string{"Default", "Profile 1"}, DeviceIDs: provider})
+	if err != nil {
+		t.Fatalf("fixture.Build() error = %v", err)
+	}
+	fs.WriteFile("/home/user/ext.zip", zipArchive(t, map[string]string{
+		"manifest.json": `{"manifest_version": 3, "name": "Filtered", "version": "1.0"}`,
+	}), 0644)
+	opts := ProfileOptions{DeviceIDs: provider, FS: fs, InstallRoot: testInstallRoot, Logger: logging.Discard}
+	installOpts := InstallOptions{ProfileOptions: opts}
+	installOpts.Profiles = []string{"Default"}
+	if err := Install(context.Background(), "/home/user/ext.zip", installOpts); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	extensionPath := filepath.Join(testInstallRoot, "Filtered")
+	extensionID := GetExtensionID(extensionPath)
+	installed, other := chrome.Profiles[0], chrome.Profiles[1]
+
+	// Watching every profile keeps the extension where it was installed only
+	state := &watchState{opts: WatchOptions{ProfileOptions: opts}, targets: map[string]watchTarget{}, waiting: map[string]bool{}}
+	state.check(context.Background())
+	if registered, _ := extensionState(t, fs, chrome.Browser, other, extensionPath, provider); registered || len(state.targets) != 1 {
+		t.Fatalf("check() targets = %+v, installed into the other profile %v; want only %s", state.targets, registered, installed)
+	}
+
+	// Without a record, the profiles that have the entry are watched from then on
+	fs.Remove(profilesPath(extensionPath))
+	state = &watchState{opts: WatchOptions{ProfileOptions: opts}, targets: map[string]watchTarget{}, waiting: map[string]bool{}}
+	state.check(context.Background())
+	browser.RemoveFromProfile(fs, browser.Backups{}, installed, extensionID, chrome.Signer)
+	state.check(context.Background())
+	if registered, _ := extensionState(t, fs, chrome.Browser, installed, extensionPath, provider); !registered {
+		t.Error("check() did not restore an unrecorded extension in the profile that had it")
+	}
+	if registered, _ := extensionState(t, fs, chrome.Browser, other, extensionPath, provider); registered {
+		t.Error("check() installed an unrecorded extension into a profile that never had it")
+	}
+}
+
+// startedHandler closes started when Watch logs that its first check is done
+type startedHandler struct {
+	slog.Handler
+	started chan struct{}
+	once    sync.Once
+}
+
+func (h *startedHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *startedHandler) Handle(_ context.Context, record slog.Record) error {
+	if record.Message == "watching extensions" {
+		h.once.Do(func() { close(h.started) })
+	}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	fs, chrome, opts, extensionPath := newWatchFixture(t)
+	profile := chrome.Profiles[0]
+	opts.Interval = 10 * time.Millisecond
+	handler := &startedHandler{Handler: logging.Discard.Handler(), started: make(chan struct{})}
+	opts.Logger = slog.New(handler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Watch(ctx, opts) }()
+
+	<-handler.started
+	browser.RemoveFromProfile(fs, browser.Backups{}, profile, GetExtensionID(extensionPath), chrome.Signer)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if registered, _ := extensionState(t, fs, chrome.Browser, profile, extensionPath, opts.DeviceIDs); registered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Watch() did not restore the extension")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch() error = %v", err)
+	}
+
+	// Without browsers there is nothing to watch
+	empty := WatchOptions{ProfileOptions: ProfileOptions{FS: fsys.NewMemory(), InstallRoot: testInstallRoot, Logger: logging.Discard}}
+	if err := Watch(context.Background(), empty); err == nil {
+		t.Error("Watch() without browsers should fail")
+	}
+}
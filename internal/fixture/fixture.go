@@ -0,0 +1,269 @@
+// Package fixture builds fake Chromium-based browser installations for tests
+// and for reproducing field bugs: an application directory with a synthetic
+// resources.pak, a user-data directory with Local State, and profiles with
+// signed Preferences and Secure Preferences.
+package fixture
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
+	"github.com/yinxulai/chromium-extension-installer/internal/system"
+)
+
+// DefaultSeed is the 64-byte MAC seed used when Options.Seed is empty
+var DefaultSeed = func() []byte {
+	sum := sha512.Sum512([]byte("cei fixture seed"))
+	return sum[:]
+}()
+
+// DefaultSID is the user SID of the default device ID provider
+const DefaultSID = "S-1-5-21-1111111111-2222222222-3333333333-1001"
+
+// DefaultPlatformUUID is the Mac platform UUID of the default device ID provider
+const DefaultPlatformUUID = "0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0"
+
+// Options describes the fake browser to build
+type Options struct {
+	// Browser is the browser name as used by detection; default "chrome"
+	Browser string
+	// Version is the application version directory; default "120.0.6099.110"
+	Version string
+	// PakVersion is the resources.pak format, 4 or 5; default 5
+	PakVersion int
+	// Seed is the MAC seed stored in resources.pak; default DefaultSeed
+	Seed []byte
+	// Profiles are the profile directory names; default Default and Profile 1
+	Profiles []string
+	// DeviceIDs supplies the identifiers mixed into MACs; default a FakeProvider
+	// with DefaultSID and DefaultPlatformUUID
+	DeviceIDs system.DeviceIDProvider
+	// NoApplication leaves out the application directory and resources.pak,
+	// for browsers that are only installed system-wide, as on Linux. Only a
+	// browser with an empty seed, such as chromium, can be signed without it.
+	NoApplication bool
+}
+
+// Fixture is a fake browser installation
+type Fixture struct {
+	Browser  browser.Browser
+	Signer   *browser.Signer
+	Profiles []string
+
+	pakVersion int
+}
+
+func (o *Options) setDefaults() {
+	if o.Browser == "" {
+		o.Browser = "chrome"
+	}
+	if o.Version == "" {
+		o.Version = "120.0.6099.110"
+	}
+	if o.PakVersion == 0 {
+		o.PakVersion = 5
+	}
+	if len(o.Seed) == 0 {
+		o.Seed = DefaultSeed
+	}
+	if len(o.Profiles) == 0 {
+		o.Profiles = []string{"Default", "Profile 1"}
+	}
+	if o.DeviceIDs == nil {
+		o.DeviceIDs = &system.FakeProvider{SID: DefaultSID, VolumeSerial: "1234-ABCD", UUID: DefaultPlatformUUID}
+	}
+}
+
+// Build creates a fake browser under the home directory of fs. The browser is
+// laid out where DetectChromiumBrowsers looks for it.
+func Build(fs fsys.FS, opts Options) (*Fixture, error) {
+	opts.setDefaults()
+
+	home, err := fs.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	userDataDir, appDirs, ok := browser.Locate(fs, opts.Browser)
+	if !ok {
+		return nil, fmt.Errorf("unknown browser: %s", opts.Browser)
+	}
+
+	if !opts.NoApplication {
+		appDir := applicationDir(home, appDirs)
+		if err := writePak(fs, appDir, opts.Version, opts.PakVersion, opts.Seed); err != nil {
+			return nil, fmt.Errorf("failed to write resources.pak under %s: %v", appDir, err)
+		}
+	}
+
+	if err := fs.MkdirAll(userDataDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := writeLocalState(fs, userDataDir, opts.Profiles); err != nil {
+		return nil, err
+	}
+
+	var found *browser.Browser
+	for _, b := range browser.DetectChromiumBrowsers(fs) {
+		if b.Name == opts.Browser {
+			found = &b
+			break
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s was not detected after building the fixture", opts.Browser)
+	}
+
+	signer, err := browser.NewSigner(context.Background(), *found, opts.DeviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := &Fixture{Browser: *found, Signer: signer, pakVersion: opts.PakVersion}
+	for _, name := range opts.Profiles {
+		profile := filepath.Join(userDataDir, name)
+		if err := writeProfile(fs, profile, signer); err != nil {
+			return nil, err
+		}
+		fixture.Profiles = append(fixture.Profiles, profile)
+	}
+	return fixture, nil
+}
+
+// Update simulates a browser update: the application directory is left with
+// only version, whose resources.pak holds seed. Profiles are not re-signed.
+func (f *Fixture) Update(version string, seed []byte) error {
+	appDir := f.Browser.AppPath
+	if appDir == "" {
+		return fmt.Errorf("%s fixture has no application directory", f.Browser.Name)
+	}
+	fs := f.Browser.FS
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		entries, err := fs.ReadDir(appDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				if err := fs.RemoveAll(filepath.Join(appDir, entry.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return writePak(fs, appDir, version, f.pakVersion, seed)
+}
+
+// applicationDir picks where to install the fake browser: its per-user
+// application directory if it has one, else the first system-wide one
+func applicationDir(home string, appDirs []string) string {
+	for _, dir := range appDirs {
+		if strings.HasPrefix(dir, home+string(filepath.Separator)) {
+			return dir
+		}
+	}
+	return appDirs[0]
+}
+
+// pakPath returns where a browser installed in appDir keeps the resources.pak
+// of version on this OS
+func pakPath(appDir, version string) string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(appDir, version, "resources.pak")
+	case "darwin":
+		return filepath.Join(appDir, version, "Resources", "resources.pak")
+	default:
+		return filepath.Join(appDir, "resources.pak")
+	}
+}
+
+// writePak writes a resources.pak holding seed for version into appDir
+func writePak(fs fsys.FS, appDir, version string, pakVersion int, seed []byte) error {
+	pak, err := SeedPak(pakVersion, seed)
+	if err != nil {
+		return err
+	}
+	path := pakPath(appDir, version)
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return fs.WriteFile(path, pak, 0644)
+}
+
+// writeLocalState writes the browser-wide Local State listing the profiles
+func writeLocalState(fs fsys.FS, userDataDir string, profiles []string) error {
+	infoCache := prefs.NewObject()
+	for i, name := range profiles {
+		info := prefs.NewObject()
+		info.Set("name", fmt.Sprintf("Person %d", i+1))
+		infoCache.Set(name, info)
+	}
+
+	doc := prefs.New()
+	if err := doc.Set("profile.info_cache", infoCache); err != nil {
+		return err
+	}
+	if err := doc.Set("profile.last_used", profiles[0]); err != nil {
+		return err
+	}
+	return doc.Save(fs, filepath.Join(userDataDir, "Local State"))
+}
+
+// writeProfile writes a profile whose tracked prefs all carry valid MACs
+func writeProfile(fs fsys.FS, profile string, signer *browser.Signer) error {
+	if err := fs.MkdirAll(profile, 0755); err != nil {
+		return err
+	}
+
+	prefsDoc, err := prefs.Parse([]byte(`{"browser":{"show_home_button":true},"extensions":{"toolbar":[]},"homepage":"https://www.example.com/","profile":{"name":"` + filepath.Base(profile) + `"}}`))
+	if err != nil {
+		return err
+	}
+	if err := sign(prefsDoc, signer, false, "browser.show_home_button", "homepage"); err != nil {
+		return err
+	}
+
+	securePrefsDoc, err := prefs.Parse([]byte(`{"extensions":{"settings":{}},"homepage_is_newtabpage":false,"session":{"restore_on_startup":1}}`))
+	if err != nil {
+		return err
+	}
+	if err := sign(securePrefsDoc, signer, true, "homepage_is_newtabpage", "session.restore_on_startup"); err != nil {
+		return err
+	}
+
+	if err := prefsDoc.Save(fs, filepath.Join(profile, "Preferences")); err != nil {
+		return err
+	}
+	return securePrefsDoc.Save(fs, filepath.Join(profile, "Secure Preferences"))
+}
+
+// sign stores the MAC of each path under protection.macs and, if superMAC is
+// set, the super_mac over all of them
+func sign(doc *prefs.Document, signer *browser.Signer, superMAC bool, paths ...string) error {
+	for _, path := range paths {
+		value, _, err := doc.Get(path)
+		if err != nil {
+			return err
+		}
+		if err := doc.Set("protection.macs."+path, signer.MAC(path, value)); err != nil {
+			return err
+		}
+	}
+	if !superMAC {
+		return nil
+	}
+
+	macs, err := doc.Object("protection.macs", false)
+	if err != nil {
+		return err
+	}
+	return doc.Set("protection.super_mac", signer.SuperMAC(macs))
+}
@@ -0,0 +1,170 @@
+package fixture
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/browser"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/prefs"
+)
+
+func TestSeedPakReadableByGetKey(t *testing.T) {
+	for _, version := range []int{4, 5} {
+		fs := fsys.NewMemory()
+		seed := bytes.Repeat([]byte{byte(version)}, 64)
+
+		fixture, err := Build(fs, Options{PakVersion: version, Seed: seed})
+		if err != nil {
+			t.Fatalf("Build() v%d error = %v", version, err)
+		}
+
+		key, err := browser.GetKey(context.Background(), fixture.Browser)
+		if err != nil {
+			t.Fatalf("GetKey() v%d error = %v", version, err)
+		}
+		if !bytes.Equal(key, seed) {
+			t.Errorf("GetKey() v%d = %x, want %x", version, key, seed)
+		}
+	}
+
+	if _, err := Pak(3, nil); err == nil {
+		t.Error("Pak() should reject unsupported versions")
+	}
+}
+
+func TestBuildLayout(t *testing.T) {
+	fs := fsys.NewMemory()
+
+	fixture, err := Build(fs, Options{Browser: "brave", Profiles: []string{"Default", "Profile 1", "Profile 2"}})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	profiles, err := browser.GetProfilePaths(fixture.Browser)
+	if err != nil {
+		t.Fatalf("GetProfilePaths() error = %v", err)
+	}
+	if len(profiles) != 3 {
+		t.Errorf("GetProfilePaths() = %v, want 3 profiles", profiles)
+	}
+
+	localState, err := prefs.Load(fs, filepath.Join(fixture.Browser.ProfilePath, "Local State"))
+	if err != nil {
+		t.Fatalf("failed to load Local State: %v", err)
+	}
+	if name, _ := localState.String("profile.info_cache.Profile 2.name"); name != "Person 3" {
+		t.Errorf("Local State name of Profile 2 = %q, want Person 3", name)
+	}
+
+	if _, err := Build(fsys.NewMemory(), Options{Browser: "netscape"}); err == nil {
+		t.Error("Build() should fail for an unknown browser")
+	}
+}
+
+func TestBuildSignsPreferences(t *testing.T) {
+	fs := fsys.NewMemory()
+
+	fixture, err := Build(fs, Options{})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	for _, profile := range fixture.Profiles {
+		for name, paths := range map[string][]string{
+			"Preferences":        {"browser.show_home_button", "homepage"},
+			"Secure Preferences": {"homepage_is_newtabpage", "session.restore_on_startup"},
+		} {
+			doc, err := prefs.Load(fs, filepath.Join(profile, name))
+			if err != nil {
+				t.Fatalf("failed to load %s: %v", name, err)
+			}
+			for _, path := range paths {
+				value, _, _ := doc.Get(path)
+				if mac, _ := doc.String("protection.macs." + path); mac != fixture.Signer.MAC(path, value) {
+					t.Errorf("%s: MAC of %s = %q, want %q", name, path, mac, fixture.Signer.MAC(path, value))
+				}
+			}
+		}
+	}
+
+	// Re-signing a freshly built profile must not change any MAC
+	profile := fixture.Profiles[0]
+	before, _ := fs.ReadFile(filepath.Join(profile, "Secure Preferences"))
+	if _, err := browser.ResignProfile(fs, browser.Backups{}, profile, fixture.Signer); err != nil {
+		t.Fatalf("ResignProfile() error = %v", err)
+	}
+	after, _ := fs.ReadFile(filepath.Join(profile, "Secure Preferences"))
+	if !bytes.Equal(before, after) {
+		t.Errorf("ResignProfile() changed a fixture profile:\n%s\n%s", before, after)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	fs := fsys.NewMemory()
+	fixture, err := Build(fs, Options{Browser: "edge"})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	seed := bytes.Repeat([]byte{7}, 64)
+	if err := fixture.Update("121.0.6167.85", seed); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	// On Linux resources.pak is not kept per version and is simply replaced
+	if old := pakPath(fixture.Browser.AppPath, "120.0.6099.110"); old != pakPath(fixture.Browser.AppPath, "121.0.6167.85") {
+		if _, err := fs.Stat(old); err == nil {
+			t.Error("Update() kept the old version")
+		}
+	}
+	key, err := browser.GetKey(context.Background(), fixture.Browser)
+	if err != nil {
+		t.Fatalf("GetKey() error = %v", err)
+	}
+	if !bytes.Equal(key, seed) {
+		t.Errorf("GetKey() after Update() = %x, want %x", key, seed)
+	}
+}
+
+func TestBuildWithoutApplication(t *testing.T) {
+	fs := fsys.NewMemory()
+	fixture, err := Build(fs, Options{Browser: "chromium", NoApplication: true})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if fixture.Browser.AppPath != "" {
+		t.Errorf("AppPath = %q, want none", fixture.Browser.AppPath)
+	}
+	if err := fixture.Update("121.0.6167.85", nil); err == nil {
+		t.Error("Update() should fail without an application directory")
+	}
+
+	// Branded browsers need resources.pak for their seed
+	if _, err := Build(fsys.NewMemory(), Options{Browser: "chrome", NoApplication: true}); err == nil {
+		t.Error("Build() should fail for chrome without an application directory")
+	}
+}
+
+func TestBuildOnDisk(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	// chromium needs no resources.pak, so this works where browsers are only
+	// installed system-wide
+	fixture, err := Build(fsys.OS{}, Options{Browser: "chromium", NoApplication: true})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if !strings.HasPrefix(fixture.Browser.ProfilePath, home) {
+		t.Errorf("ProfilePath = %q, want it under %q", fixture.Browser.ProfilePath, home)
+	}
+	profiles, err := browser.GetProfilePaths(fixture.Browser)
+	if err != nil || len(profiles) != 2 {
+		t.Errorf("GetProfilePaths() = %v, %v, want 2 profiles", profiles, err)
+	}
+}
@@ -0,0 +1,55 @@
+package fixture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Pak builds a resources.pak file in format version 4 or 5 holding the given
+// resources, numbered from 1 in order
+func Pak(version int, resources [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var header int
+
+	switch version {
+	case 4:
+		binary.Write(&buf, binary.LittleEndian, uint32(4))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(resources)))
+		buf.WriteByte(1) // UTF-8
+		header = 9
+	case 5:
+		binary.Write(&buf, binary.LittleEndian, uint32(5))
+		binary.Write(&buf, binary.LittleEndian, uint32(1)) // UTF-8
+		binary.Write(&buf, binary.LittleEndian, uint16(len(resources)))
+		binary.Write(&buf, binary.LittleEndian, uint16(0)) // no aliases
+		header = 12
+	default:
+		return nil, fmt.Errorf("unsupported resources.pak version: %d", version)
+	}
+
+	// Each entry is a uint16 id and a uint32 offset, followed by a sentinel entry
+	offset := uint32(header + 6*(len(resources)+1))
+	for i := 0; i <= len(resources); i++ {
+		binary.Write(&buf, binary.LittleEndian, uint16(i+1))
+		binary.Write(&buf, binary.LittleEndian, offset)
+		if i < len(resources) {
+			offset += uint32(len(resources[i]))
+		}
+	}
+
+	for _, resource := range resources {
+		buf.Write(resource)
+	}
+	return buf.Bytes(), nil
+}
+
+// SeedPak builds a resources.pak in which seed is surrounded by other resources,
+// the way the MAC seed sits among Chromium's real resources
+func SeedPak(version int, seed []byte) ([]byte, error) {
+	return Pak(version, [][]byte{
+		[]byte("<!doctype html><title>fixture</title>"),
+		seed,
+		[]byte(`{"fixture":true}`),
+	})
+}
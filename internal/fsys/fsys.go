@@ -0,0 +1,82 @@
+package fsys
+
+import (
+	"io/fs"
+	"os"
+)
+
+// FS is the file system and process environment used by the installer.
+// Besides file operations it locates the home, temp and environment-derived
+// directories, so a whole install can run against an in-memory tree.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	MkdirTemp(dir, pattern string) (string, error)
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldpath, newpath string) error
+
+	TempDir() string
+	UserHomeDir() (string, error)
+	Getenv(key string) string
+}
+
+// OS is the FS backed by the real operating system
+type OS struct{}
+
+func (OS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OS) MkdirTemp(dir, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+func (OS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (OS) TempDir() string {
+	return os.TempDir()
+}
+
+func (OS) UserHomeDir() (string, error) {
+	return os.UserHomeDir()
+}
+
+func (OS) Getenv(key string) string {
+	return os.Getenv(key)
+}
+
+// Exists reports whether name exists
+func Exists(fsys FS, name string) bool {
+	_, err := fsys.Stat(name)
+	return err == nil
+}
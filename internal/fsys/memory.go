@@ -0,0 +1,297 @@
+package fsys
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory FS for tests. It is safe for concurrent use.
+type Memory struct {
+	// Home is returned by UserHomeDir
+	Home string
+	// Temp is returned by TempDir
+	Temp string
+	// Env holds the variables returned by Getenv
+	Env map[string]string
+
+	mu      sync.Mutex
+	entries map[string]*memEntry
+	counter int
+}
+
+type memEntry struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemory returns an empty in-memory file system with /home/user as home
+// and /tmp as temp directory, both already created
+func NewMemory() *Memory {
+	m := &Memory{
+		Home:    "/home/user",
+		Temp:    "/tmp",
+		Env:     make(map[string]string),
+		entries: make(map[string]*memEntry),
+	}
+	m.MkdirAll(m.Home, 0755)
+	m.MkdirAll(m.Temp, 0755)
+	return m
+}
+
+func (m *Memory) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[clean(name)]
+	if !ok {
+		return nil, pathError("open", name, fs.ErrNotExist)
+	}
+	if entry.mode.IsDir() {
+		return nil, pathError("read", name, fmt.Errorf("is a directory"))
+	}
+	return append([]byte(nil), entry.data...), nil
+}
+
+func (m *Memory) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if !m.isDir(filepath.Dir(name)) {
+		return pathError("open", name, fs.ErrNotExist)
+	}
+	entry, exists := m.entries[name]
+	if exists && entry.mode.IsDir() {
+		return pathError("open", name, fmt.Errorf("is a directory"))
+	}
+	m.entries[name] = &memEntry{data: append([]byte(nil), data...), mode: perm.Perm(), modTime: time.Now()}
+	if !exists {
+		m.touch(filepath.Dir(name))
+	}
+	return nil
+}
+
+func (m *Memory) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if isRoot(name) {
+		return memInfo{name: name, entry: &memEntry{mode: fs.ModeDir | 0755}}, nil
+	}
+	entry, ok := m.entries[name]
+	if !ok {
+		return nil, pathError("stat", name, fs.ErrNotExist)
+	}
+	return memInfo{name: filepath.Base(name), entry: entry}, nil
+}
+
+func (m *Memory) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if !m.isDir(name) {
+		return nil, pathError("open", name, fs.ErrNotExist)
+	}
+
+	var result []fs.DirEntry
+	for path, entry := range m.entries {
+		if filepath.Dir(path) == name && path != name {
+			result = append(result, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(path), entry: entry}))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+func (m *Memory) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mkdirAll(clean(path), perm)
+}
+
+func (m *Memory) mkdirAll(path string, perm fs.FileMode) error {
+	if isRoot(path) {
+		return nil
+	}
+	if entry, ok := m.entries[path]; ok {
+		if !entry.mode.IsDir() {
+			return pathError("mkdir", path, fmt.Errorf("not a directory"))
+		}
+		return nil
+	}
+	if err := m.mkdirAll(filepath.Dir(path), perm); err != nil {
+		return err
+	}
+	m.entries[path] = &memEntry{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	m.touch(filepath.Dir(path))
+	return nil
+}
+
+func (m *Memory) MkdirTemp(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if dir == "" {
+		dir = m.Temp
+	}
+	if !m.isDir(clean(dir)) {
+		return "", pathError("mkdirtemp", dir, fs.ErrNotExist)
+	}
+
+	m.counter++
+	suffix := fmt.Sprint(m.counter)
+	name := pattern + suffix
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		name = pattern[:i] + suffix + pattern[i+1:]
+	}
+	path := filepath.Join(dir, name)
+	m.entries[clean(path)] = &memEntry{mode: fs.ModeDir | 0700, modTime: time.Now()}
+	m.touch(clean(dir))
+	return path, nil
+}
+
+func (m *Memory) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if _, ok := m.entries[name]; !ok {
+		return pathError("remove", name, fs.ErrNotExist)
+	}
+	for path := range m.entries {
+		if isWithin(path, name) {
+			return pathError("remove", name, fmt.Errorf("directory not empty"))
+		}
+	}
+	delete(m.entries, name)
+	m.touch(filepath.Dir(name))
+	return nil
+}
+
+func (m *Memory) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = clean(path)
+	if _, ok := m.entries[path]; ok {
+		m.touch(filepath.Dir(path))
+	}
+	for name := range m.entries {
+		if name == path || isWithin(name, path) {
+			delete(m.entries, name)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, newpath = clean(oldpath), clean(newpath)
+	entry, ok := m.entries[oldpath]
+	if !ok {
+		return pathError("rename", oldpath, fs.ErrNotExist)
+	}
+	if !m.isDir(filepath.Dir(newpath)) {
+		return pathError("rename", newpath, fs.ErrNotExist)
+	}
+
+	delete(m.entries, oldpath)
+	m.entries[newpath] = entry
+	for name, child := range m.entries {
+		if isWithin(name, oldpath) {
+			delete(m.entries, name)
+			m.entries[newpath+name[len(oldpath):]] = child
+		}
+	}
+	m.touch(filepath.Dir(oldpath))
+	m.touch(filepath.Dir(newpath))
+	return nil
+}
+
+// touch updates the modification time of dir, as adding, removing or renaming
+// an entry does on a real file system. The caller holds m.mu.
+func (m *Memory) touch(dir string) {
+	// FileInfos already handed out keep the old time
+	if entry, ok := m.entries[dir]; ok && entry.mode.IsDir() {
+		touched := *entry
+		touched.modTime = time.Now()
+		m.entries[dir] = &touched
+	}
+}
+
+func (m *Memory) TempDir() string {
+	return m.Temp
+}
+
+func (m *Memory) UserHomeDir() (string, error) {
+	if m.Home == "" {
+		return "", fmt.Errorf("home directory not set")
+	}
+	return m.Home, nil
+}
+
+func (m *Memory) Getenv(key string) string {
+	return m.Env[key]
+}
+
+// Files returns the paths of all regular files, sorted
+func (m *Memory) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var files []string
+	for path, entry := range m.entries {
+		if !entry.mode.IsDir() {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (m *Memory) isDir(path string) bool {
+	if isRoot(path) {
+		return true
+	}
+	entry, ok := m.entries[path]
+	return ok && entry.mode.IsDir()
+}
+
+func clean(path string) string {
+	return filepath.Clean(path)
+}
+
+func isRoot(path string) bool {
+	return path == "." || path == string(filepath.Separator) || filepath.Dir(path) == path
+}
+
+func isWithin(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func pathError(op, path string, err error) error {
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
+
+type memInfo struct {
+	name  string
+	entry *memEntry
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.entry.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.entry.mode }
+func (i memInfo) ModTime() time.Time { return i.entry.modTime }
+func (i memInfo) IsDir() bool        { return i.entry.mode.IsDir() }
+func (i memInfo) Sys() interface{}   { return nil }
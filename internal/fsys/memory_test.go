@@ -0,0 +1,112 @@
+package fsys
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryFiles(t *testing.T) {
+	m := NewMemory()
+
+	if err := m.WriteFile("/a/b/file.txt", []byte("x"), 0644); !os.IsNotExist(err) {
+		t.Errorf("WriteFile() without parent error = %v, want not exist", err)
+	}
+
+	m.MkdirAll("/a/b", 0755)
+	if err := m.WriteFile("/a/b/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	data, err := m.ReadFile("/a/b/file.txt")
+	if err != nil || string(data) != "content" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+
+	info, err := m.Stat("/a/b/file.txt")
+	if err != nil || info.IsDir() || info.Size() != 7 || info.Name() != "file.txt" {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+	if _, err := m.Stat("/missing"); !os.IsNotExist(err) {
+		t.Errorf("Stat() of missing file error = %v", err)
+	}
+
+	m.WriteFile("/a/z.txt", nil, 0644)
+	entries, err := m.ReadDir("/a")
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"b", "z.txt"}) {
+		t.Errorf("ReadDir() = %v, want [b z.txt]", names)
+	}
+
+	if err := m.Remove("/a"); err == nil {
+		t.Error("Remove() of non-empty directory should fail")
+	}
+	if err := m.Rename("/a/b", "/a/c"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if data, _ := m.ReadFile("/a/c/file.txt"); string(data) != "content" {
+		t.Error("Rename() did not move directory contents")
+	}
+
+	if err := m.RemoveAll("/a"); err != nil {
+		t.Fatalf("RemoveAll() error = %v", err)
+	}
+	if files := m.Files(); len(files) != 0 {
+		t.Errorf("Files() after RemoveAll = %v, want none", files)
+	}
+}
+
+func TestMemoryEnvironment(t *testing.T) {
+	m := NewMemory()
+	m.Env["APPDATA"] = "/home/user/AppData/Roaming"
+
+	if home, _ := m.UserHomeDir(); home != "/home/user" {
+		t.Errorf("UserHomeDir() = %q", home)
+	}
+	if m.Getenv("APPDATA") != "/home/user/AppData/Roaming" || m.Getenv("MISSING") != "" {
+		t.Error("Getenv() returned wrong values")
+	}
+
+	dir1, err := m.MkdirTemp("", "cei-*-x")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	dir2, _ := m.MkdirTemp("", "cei-*-x")
+	if dir1 == dir2 || !Exists(m, dir1) || !Exists(m, dir2) {
+		t.Errorf("MkdirTemp() = %q, %q, want two distinct directories", dir1, dir2)
+	}
+}
+
+func TestMemoryDirModTime(t *testing.T) {
+	m := NewMemory()
+	m.MkdirAll("/data", 0755)
+
+	changes := []struct {
+		name    string
+		change  func()
+		changed bool
+	}{
+		{"create", func() { m.WriteFile("/data/a", []byte("1"), 0644) }, true},
+		{"overwrite", func() { m.WriteFile("/data/a", []byte("2"), 0644) }, false},
+		{"rename", func() { m.Rename("/data/a", "/data/b") }, true},
+		{"remove", func() { m.Remove("/data/b") }, true},
+		{"mkdir", func() { m.MkdirAll("/data/sub/dir", 0755) }, true},
+		{"remove all", func() { m.RemoveAll("/data/sub") }, true},
+	}
+	for _, tt := range changes {
+		before, _ := m.Stat("/data")
+		time.Sleep(time.Millisecond)
+		tt.change()
+		after, _ := m.Stat("/data")
+		if changed := !after.ModTime().Equal(before.ModTime()); changed != tt.changed {
+			t.Errorf("%s: directory modification time changed = %v, want %v", tt.name, changed, tt.changed)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package fsys
+
+// Watcher reports changes to the entries of a set of directories, such as
+// files being created, written, renamed or removed
+type Watcher interface {
+	// Add starts watching dir; adding a directory again has no effect
+	Add(dir string) error
+	// Events receives a value after changes; a burst of changes may be
+	// reported once. It is closed when the watcher is closed.
+	Events() <-chan struct{}
+	Close() error
+}
@@ -0,0 +1,61 @@
+package fsys
+
+import (
+	"os"
+	"syscall"
+)
+
+// inotifyMask selects the directory changes a Watcher reports
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_CLOSE_WRITE
+
+// inotifyWatcher is the Watcher of the real file system on Linux
+type inotifyWatcher struct {
+	fd     int
+	file   *os.File
+	events chan struct{}
+}
+
+// NewWatcher returns a Watcher of the real file system, backed by inotify
+func NewWatcher() (Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// Reading through an os.File uses the runtime poller, so Close unblocks read
+	w := &inotifyWatcher{fd: fd, file: os.NewFile(uintptr(fd), "inotify"), events: make(chan struct{}, 1)}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Add(dir string) error {
+	if _, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask); err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	return nil
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
+
+// read turns inotify events into notifications until the watcher is closed.
+// The events themselves are not decoded: callers re-check what they watch.
+func (w *inotifyWatcher) read() {
+	defer close(w.events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil || n == 0 {
+			return
+		}
+		select {
+		case w.events <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package fsys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	if err := w.Add(dir); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := w.Add(dir); err != nil {
+		t.Errorf("Add() of a watched directory error = %v", err)
+	}
+	if err := w.Add(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Add() of a missing directory should fail")
+	}
+
+	os.WriteFile(filepath.Join(dir, "Preferences"), []byte("{}"), 0644)
+	select {
+	case <-w.Events():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after writing a file")
+	}
+
+	w.Close()
+	select {
+	case _, ok := <-w.Events():
+		for ok {
+			_, ok = <-w.Events()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Events() not closed after Close()")
+	}
+}
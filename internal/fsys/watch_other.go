@@ -0,0 +1,11 @@
+//go:build !linux
+
+package fsys
+
+import "errors"
+
+// NewWatcher returns a Watcher of the real file system. Change notifications
+// are only implemented on Linux; elsewhere it returns errors.ErrUnsupported.
+func NewWatcher() (Watcher, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,65 @@
+// Package logging sets up the structured logger used for diagnostics
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Standard attribute keys, so log pipelines can rely on them
+const (
+	KeyBrowser     = "browser"
+	KeyProfile     = "profile"
+	KeyExtensionID = "extension_id"
+	KeyStep        = "step"
+	KeyError       = "error"
+)
+
+// New returns a logger writing to w in format "text" or "json" at the given level
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+}
+
+// Level maps the -v and -q flags to a level: quiet shows warnings and errors
+// only, verbose adds debug messages
+func Level(verbose, quiet bool) slog.Level {
+	switch {
+	case quiet:
+		return slog.LevelWarn
+	case verbose:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// ParseLevel parses a level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// Discard is a logger that drops everything
+var Discard = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+
+// Redact hides all but the last four characters of a machine identifier such
+// as a SID or volume serial number
+func Redact(value string) string {
+	if len(value) <= 4 {
+		return strings.Repeat("*", len(value))
+	}
+	return "****" + value[len(value)-4:]
+}
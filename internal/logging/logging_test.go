@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Debug("hidden")
+	logger.Info("profile updated", KeyBrowser, "Google Chrome", KeyStep, "install")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output is not one JSON line: %q", buf.String())
+	}
+	if entry["msg"] != "profile updated" || entry[KeyBrowser] != "Google Chrome" || entry[KeyStep] != "install" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+
+	buf.Reset()
+	logger, _ = New(&buf, "text", slog.LevelInfo)
+	logger.Info("hello", KeyProfile, "Default")
+	if !strings.Contains(buf.String(), "msg=hello profile=Default") {
+		t.Errorf("text output = %q", buf.String())
+	}
+
+	if _, err := New(&buf, "xml", slog.LevelInfo); err == nil {
+		t.Error("New() should reject unknown formats")
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		verbose, quiet bool
+		want           slog.Level
+	}{
+		{false, false, slog.LevelInfo},
+		{true, false, slog.LevelDebug},
+		{false, true, slog.LevelWarn},
+		{true, true, slog.LevelWarn},
+	}
+	for _, tt := range tests {
+		if got := Level(tt.verbose, tt.quiet); got != tt.want {
+			t.Errorf("Level(%v, %v) = %v, want %v", tt.verbose, tt.quiet, got, tt.want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"S-1-5-21-1111111111-2222222222-3333333333-1001": "****1001",
+		"1234-ABCD": "****ABCD",
+		"ABC":       "***",
+		"":          "",
+	}
+	for input, want := range tests {
+		if got := Redact(input); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError}
+	for name, want := range tests {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel() should reject unknown levels")
+	}
+}
@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// Policy restricts which extensions may be installed.
+// Deny lists always win; a non-empty allow list admits only its entries.
+type Policy struct {
+	AllowedIDs           []string `json:"allowed_ids,omitempty"`
+	DeniedIDs            []string `json:"denied_ids,omitempty"`
+	AllowedPublisherKeys []string `json:"allowed_publisher_keys,omitempty"`
+	DeniedPublisherKeys  []string `json:"denied_publisher_keys,omitempty"`
+	AllowedPermissions   []string `json:"allowed_permissions,omitempty"`
+	DeniedPermissions    []string `json:"denied_permissions,omitempty"`
+}
+
+// Violation describes why an extension was rejected by a policy
+type Violation struct {
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("policy violation: %s", v.Reason)
+}
+
+// Candidate is an extension about to be installed
+type Candidate struct {
+	ID       string
+	Manifest *types.Manifest
+	// PublisherKey is the DER-encoded developer key of a verified CRX
+	// signature; nil for unsigned packages
+	PublisherKey []byte
+}
+
+// Load reads a JSON policy file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %v", err)
+	}
+
+	// Keys are often pasted with surrounding whitespace; Check trims them too
+	for _, keys := range [][]string{policy.AllowedPublisherKeys, policy.DeniedPublisherKeys} {
+		for i, key := range keys {
+			keys[i] = strings.TrimSpace(key)
+			if _, err := base64.StdEncoding.DecodeString(keys[i]); err != nil {
+				return nil, fmt.Errorf("policy publisher key %q is not valid base64: %v", key, err)
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+// Check returns a *Violation if the candidate is not allowed by the policy
+func (p *Policy) Check(c Candidate) error {
+	if utils.Contains(p.DeniedIDs, c.ID) {
+		return &Violation{Reason: fmt.Sprintf("extension ID %s is denied", c.ID)}
+	}
+	if len(p.AllowedIDs) > 0 && !utils.Contains(p.AllowedIDs, c.ID) {
+		return &Violation{Reason: fmt.Sprintf("extension ID %s is not in the allowed list", c.ID)}
+	}
+
+	// Anyone can copy a manifest key, so it may only deny; only a verified
+	// CRX signature can satisfy the allow list
+	if c.PublisherKey != nil && containsKey(p.DeniedPublisherKeys, c.PublisherKey) {
+		return &Violation{Reason: "publisher key is denied"}
+	}
+	if c.Manifest != nil && c.Manifest.Key != "" {
+		manifestKey, err := base64.StdEncoding.DecodeString(c.Manifest.Key)
+		if err == nil && containsKey(p.DeniedPublisherKeys, manifestKey) {
+			return &Violation{Reason: "manifest key is denied"}
+		}
+	}
+	if len(p.AllowedPublisherKeys) > 0 {
+		if c.PublisherKey == nil {
+			return &Violation{Reason: "extension is not a signed CRX and only allowed publisher keys are permitted"}
+		}
+		if !containsKey(p.AllowedPublisherKeys, c.PublisherKey) {
+			return &Violation{Reason: "publisher key is not in the allowed list"}
+		}
+	}
+
+	if c.Manifest != nil {
+		for _, permission := range requestedPermissions(c.Manifest) {
+			if utils.Contains(p.DeniedPermissions, permission.name) {
+				return &Violation{Reason: fmt.Sprintf("%s requests denied permission %q", permission.field, permission.name)}
+			}
+			if len(p.AllowedPermissions) > 0 && !utils.Contains(p.AllowedPermissions, permission.name) {
+				return &Violation{Reason: fmt.Sprintf("%s requests permission %q which is not in the allowed list", permission.field, permission.name)}
+			}
+		}
+	}
+
+	return nil
+}
+
+type requestedPermission struct {
+	field string
+	name  string
+}
+
+// requestedPermissions lists API permissions and host patterns the manifest asks for
+func requestedPermissions(manifest *types.Manifest) []requestedPermission {
+	var permissions []requestedPermission
+	add := func(field string, names []string) {
+		for _, name := range names {
+			permissions = append(permissions, requestedPermission{field: field, name: name})
+		}
+	}
+
+	add("permissions", manifest.Permissions)
+	add("optional_permissions", manifest.OptionalPermissions)
+	add("host_permissions", manifest.HostPermissions)
+	for i, script := range manifest.ContentScripts {
+		add(fmt.Sprintf("content_scripts[%d].matches", i), script.Matches)
+	}
+	return permissions
+}
+
+func containsKey(keys []string, key []byte) bool {
+	for _, encoded := range keys {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err == nil && bytes.Equal(decoded, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+)
+
+func TestCheck(t *testing.T) {
+	publisherKey := []byte("publisher-key")
+	encodedKey := base64.StdEncoding.EncodeToString(publisherKey)
+	manifest := &types.Manifest{
+		Name:            "Test",
+		Permissions:     []string{"tabs", "storage"},
+		HostPermissions: []string{"https://example.com/*"},
+		ContentScripts:  []types.ContentScript{{Matches: []string{"<all_urls>"}}},
+	}
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		candidate Candidate
+		reason    string
+	}{
+		{
+			name:      "Empty policy allows everything",
+			candidate: Candidate{ID: "abc", Manifest: manifest},
+		},
+		{
+			name:      "Denied ID",
+			policy:    Policy{DeniedIDs: []string{"abc"}},
+			candidate: Candidate{ID: "abc", Manifest: manifest},
+			reason:    "extension ID abc is denied",
+		},
+		{
+			name:      "ID not in allowed list",
+			policy:    Policy{AllowedIDs: []string{"xyz"}},
+			candidate: Candidate{ID: "abc", Manifest: manifest},
+			reason:    "not in the allowed list",
+		},
+		{
+			name:      "Denied publisher key",
+			policy:    Policy{DeniedPublisherKeys: []string{encodedKey}},
+			candidate: Candidate{ID: "abc", Manifest: manifest, PublisherKey: publisherKey},
+			reason:    "publisher key is denied",
+		},
+		{
+			name:      "Denied manifest key",
+			policy:    Policy{DeniedPublisherKeys: []string{encodedKey}},
+			candidate: Candidate{ID: "abc", Manifest: &types.Manifest{Key: encodedKey}},
+			reason:    "manifest key is denied",
+		},
+		{
+			name:      "Allowed publisher key from signature",
+			policy:    Policy{AllowedPublisherKeys: []string{encodedKey}},
+			candidate: Candidate{ID: "abc", Manifest: &types.Manifest{Key: encodedKey}, PublisherKey: publisherKey},
+		},
+		{
+			name:      "Allowed key copied into an unsigned manifest",
+			policy:    Policy{AllowedPublisherKeys: []string{encodedKey}},
+			candidate: Candidate{ID: "abc", Manifest: &types.Manifest{Key: encodedKey}},
+			reason:    "not a signed CRX",
+		},
+		{
+			name:      "Missing publisher key",
+			policy:    Policy{AllowedPublisherKeys: []string{encodedKey}},
+			candidate: Candidate{ID: "abc", Manifest: manifest},
+			reason:    "not a signed CRX",
+		},
+		{
+			name:      "Denied permission",
+			policy:    Policy{DeniedPermissions: []string{"debugger", "storage"}},
+			candidate: Candidate{ID: "abc", Manifest: manifest},
+			reason:    `permissions requests denied permission "storage"`,
+		},
+		{
+			name:      "Denied host in content script",
+			policy:    Policy{DeniedPermissions: []string{"<all_urls>"}},
+			candidate: Candidate{ID: "abc", Manifest: manifest},
+			reason:    `content_scripts[0].matches requests denied permission "<all_urls>"`,
+		},
+		{
+			name:      "Permission not in allowed list",
+			policy:    Policy{AllowedPermissions: []string{"tabs", "storage", "<all_urls>"}},
+			candidate: Candidate{ID: "abc", Manifest: manifest},
+			reason:    `"https://example.com/*" which is not in the allowed list`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.candidate)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var violation *Violation
+			if !errors.As(err, &violation) {
+				t.Fatalf("Check() error = %v, want *Violation", err)
+			}
+			if !strings.Contains(violation.Reason, tt.reason) {
+				t.Errorf("Check() reason = %q, want it to contain %q", violation.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.json")
+	os.WriteFile(path, []byte(`{"denied_permissions": ["debugger"]}`), 0644)
+
+	policy, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(policy.DeniedPermissions) != 1 || policy.DeniedPermissions[0] != "debugger" {
+		t.Errorf("DeniedPermissions = %v, want [debugger]", policy.DeniedPermissions)
+	}
+
+	os.WriteFile(path, []byte(`{"allowed_publisher_keys": [" a2V5\n"]}`), 0644)
+	policy, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() with surrounding whitespace error = %v", err)
+	}
+	if err := policy.Check(Candidate{ID: "id", PublisherKey: []byte("key")}); err != nil {
+		t.Errorf("Check() with a trimmed key error = %v", err)
+	}
+
+	os.WriteFile(path, []byte(`{"denied_publisher_keys": ["not base64!"]}`), 0644)
+	if _, err := Load(path); err == nil {
+		t.Error("Load() should reject invalid publisher keys")
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Load() should fail for a missing file")
+	}
+}
@@ -0,0 +1,350 @@
+package prefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+)
+
+// Object is a JSON object that remembers the order of its keys
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewObject returns an empty object
+func NewObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+// Keys returns the object's keys in document order
+func (o *Object) Keys() []string {
+	return append([]string(nil), o.keys...)
+}
+
+// Len returns the number of keys in the object
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Get returns the value stored under key
+func (o *Object) Get(key string) (interface{}, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+// Set stores value under key, appending new keys after existing ones
+func (o *Object) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = normalize(value)
+}
+
+// Delete removes key from the object
+func (o *Object) Delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Document is a parsed Preferences or Secure Preferences file.
+// Values are nil, bool, json.Number, string, []interface{} or *Object.
+// Unknown fields and key order survive a parse/serialize round trip.
+type Document struct {
+	root *Object
+}
+
+// New returns an empty document
+func New() *Document {
+	return &Document{root: NewObject()}
+}
+
+// Parse decodes a JSON document whose top level is an object
+func Parse(data []byte) (*Document, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value, err := decodeValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+
+	root, ok := value.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("top-level value is %s, not an object", kindOf(value))
+	}
+	return &Document{root: root}, nil
+}
+
+// Load reads and parses a document from a file
+func Load(fs fsys.FS, path string) (*Document, error) {
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Root returns the document's top-level object
+func (d *Document) Root() *Object {
+	return d.root
+}
+
+// Get returns the value at a dot-separated path such as "extensions.settings.<id>".
+// The boolean is false if any segment is missing.
+func (d *Document) Get(path string) (interface{}, bool, error) {
+	segments := splitPath(path)
+	current := d.root
+	for i, segment := range segments {
+		value, ok := current.Get(segment)
+		if !ok {
+			return nil, false, nil
+		}
+		if i == len(segments)-1 {
+			return value, true, nil
+		}
+		next, ok := value.(*Object)
+		if !ok {
+			return nil, false, fmt.Errorf("%s is %s, not an object", strings.Join(segments[:i+1], "."), kindOf(value))
+		}
+		current = next
+	}
+	return current, true, nil
+}
+
+// Set stores value at path, creating intermediate objects as needed
+func (d *Document) Set(path string, value interface{}) error {
+	segments := splitPath(path)
+	parent, err := d.walk(segments[:len(segments)-1], true)
+	if err != nil {
+		return err
+	}
+	parent.Set(segments[len(segments)-1], value)
+	return nil
+}
+
+// Delete removes the value at path; a missing path is not an error
+func (d *Document) Delete(path string) error {
+	segments := splitPath(path)
+	parent, err := d.walk(segments[:len(segments)-1], false)
+	if err != nil || parent == nil {
+		return err
+	}
+	parent.Delete(segments[len(segments)-1])
+	return nil
+}
+
+// Object returns the object at path, creating it if create is set.
+// It returns nil without error if the path is missing and create is not set.
+func (d *Document) Object(path string, create bool) (*Object, error) {
+	return d.walk(splitPath(path), create)
+}
+
+// StringList returns the list of strings at path, or nil if it is missing
+func (d *Document) StringList(path string) ([]string, error) {
+	value, ok, err := d.Get(path)
+	if err != nil || !ok {
+		return nil, err
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is %s, not a list", path, kindOf(value))
+	}
+	result := make([]string, 0, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s[%d] is %s, not a string", path, i, kindOf(item))
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// String returns the string at path, or "" if it is missing
+func (d *Document) String(path string) (string, error) {
+	value, ok, err := d.Get(path)
+	if err != nil || !ok {
+		return "", err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s is %s, not a string", path, kindOf(value))
+	}
+	return s, nil
+}
+
+// Decode unmarshals the value at path into v, leaving v untouched if the path is missing
+func (d *Document) Decode(path string, v interface{}) error {
+	value, ok, err := d.Get(path)
+	if err != nil || !ok {
+		return err
+	}
+	return json.Unmarshal([]byte(Serialize(value)), v)
+}
+
+// Bytes serializes the document compactly, keeping key order
+func (d *Document) Bytes() []byte {
+	return []byte(Serialize(d.root))
+}
+
+// Save writes the document to a file. It writes a temporary file first and
+// renames it into place, so an interrupted save never leaves a half-written file.
+func (d *Document) Save(fs fsys.FS, path string) error {
+	tempPath := path + ".cei-tmp"
+	if err := fs.WriteFile(tempPath, d.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := fs.Rename(tempPath, path); err != nil {
+		fs.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+func (d *Document) walk(segments []string, create bool) (*Object, error) {
+	current := d.root
+	for i, segment := range segments {
+		value, ok := current.Get(segment)
+		if !ok {
+			if !create {
+				return nil, nil
+			}
+			next := NewObject()
+			current.Set(segment, next)
+			current = next
+			continue
+		}
+		next, ok := value.(*Object)
+		if !ok {
+			return nil, fmt.Errorf("%s is %s, not an object", strings.Join(segments[:i+1], "."), kindOf(value))
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func decodeValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			object := NewObject()
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := keyToken.(string)
+				value, err := decodeValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				object.Set(key, value)
+			}
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+			return object, nil
+		case '[':
+			list := []interface{}{}
+			for decoder.More() {
+				value, err := decodeValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	default:
+		return t, nil
+	}
+}
+
+// normalize converts plain Go values into document values
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		object := NewObject()
+		for _, k := range keys {
+			object.Set(k, v[k])
+		}
+		return object
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalize(item)
+		}
+		return list
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = item
+		}
+		return list
+	case int:
+		return json.Number(fmt.Sprint(v))
+	case int64:
+		return json.Number(fmt.Sprint(v))
+	case float64:
+		data, _ := json.Marshal(v)
+		return json.Number(data)
+	}
+	return value
+}
+
+func kindOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "a list"
+	case *Object:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
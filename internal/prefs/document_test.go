@@ -0,0 +1,144 @@
+package prefs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []string{
+		`{}`,
+		`{"b":1,"a":{"z":true,"y":null},"c":[1.50,"x",{"k":[]}]}`,
+		`{"big":12345678901234567890,"neg":-1e5,"s":"é\"\\"}`,
+	}
+
+	for _, input := range tests {
+		doc, err := Parse([]byte(input))
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", input, err)
+		}
+		if output := string(doc.Bytes()); output != input {
+			t.Errorf("round trip = %s, want %s", output, input)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{``, `{`, `[]`, `"x"`, `{"a":1} {}`, `{"a":}`} {
+		if _, err := Parse([]byte(input)); err == nil {
+			t.Errorf("Parse(%q) should return error", input)
+		}
+	}
+}
+
+func TestGetSetDelete(t *testing.T) {
+	doc, _ := Parse([]byte(`{"extensions":{"settings":{"a":{"state":1}},"toolbar":["a"]},"name":"x"}`))
+
+	value, ok, err := doc.Get("extensions.settings.a.state")
+	if err != nil || !ok || value != json.Number("1") {
+		t.Errorf("Get() = %v, %v, %v, want 1, true, nil", value, ok, err)
+	}
+
+	if _, ok, err := doc.Get("extensions.settings.b"); ok || err != nil {
+		t.Errorf("Get() of missing path = %v, %v, want false, nil", ok, err)
+	}
+
+	if _, _, err := doc.Get("name.first"); err == nil {
+		t.Error("Get() through a string should return error")
+	}
+
+	if err := doc.Set("extensions.settings.b", map[string]interface{}{"state": 0, "path": "C:\\b"}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := doc.Set("protection.macs.extensions.settings.b", "MAC"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := doc.Set("name.first", "x"); err == nil {
+		t.Error("Set() through a string should return error")
+	}
+
+	if err := doc.Delete("extensions.settings.a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := doc.Delete("missing.path.entirely"); err != nil {
+		t.Errorf("Delete() of missing path error = %v", err)
+	}
+
+	expected := `{"extensions":{"settings":{"b":{"path":"C:\\b","state":0}},"toolbar":["a"]},"name":"x","protection":{"macs":{"extensions":{"settings":{"b":"MAC"}}}}}`
+	if output := string(doc.Bytes()); output != expected {
+		t.Errorf("Bytes() = %s, want %s", output, expected)
+	}
+}
+
+func TestTypedAccessors(t *testing.T) {
+	doc, _ := Parse([]byte(`{"extensions":{"toolbar":["a","b"],"mixed":["a",1],"install_signature":{"ids":["x"],"signature":"s"}},"n":1}`))
+
+	toolbar, err := doc.StringList("extensions.toolbar")
+	if err != nil || !reflect.DeepEqual(toolbar, []string{"a", "b"}) {
+		t.Errorf("StringList() = %v, %v", toolbar, err)
+	}
+	if _, err := doc.StringList("extensions.mixed"); err == nil {
+		t.Error("StringList() should reject non-string items")
+	}
+	if _, err := doc.StringList("n"); err == nil {
+		t.Error("StringList() should reject non-list values")
+	}
+	if list, err := doc.StringList("missing"); list != nil || err != nil {
+		t.Errorf("StringList() of missing path = %v, %v", list, err)
+	}
+	if _, err := doc.String("n"); err == nil {
+		t.Error("String() should reject non-string values")
+	}
+
+	var signature types.InstallSignature
+	if err := doc.Decode("extensions.install_signature", &signature); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(signature.IDs, []string{"x"}) {
+		t.Errorf("Decode() IDs = %v, want [x]", signature.IDs)
+	}
+}
+
+func TestObjectKeyOrder(t *testing.T) {
+	object := NewObject()
+	object.Set("b", 1)
+	object.Set("a", 2)
+	object.Set("b", 3)
+	object.Delete("missing")
+
+	if keys := object.Keys(); !reflect.DeepEqual(keys, []string{"b", "a"}) {
+		t.Errorf("Keys() = %v, want [b a]", keys)
+	}
+	object.Delete("b")
+	if keys := object.Keys(); !reflect.DeepEqual(keys, []string{"a"}) || object.Len() != 1 {
+		t.Errorf("Keys() after Delete = %v, want [a]", keys)
+	}
+}
+
+func TestDecodeTypedPreferences(t *testing.T) {
+	doc, err := Parse([]byte(`{"browser":{"show_home_button":true},"protection":{"super_mac":"OLD"}}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if err := doc.Set("extensions.settings.abc.path", "/ext"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := doc.Set("protection.macs.extensions.settings.abc", "MAC"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// The whole document reads as the typed model, unknown fields aside
+	var securePrefs types.SecurePreferences
+	if err := doc.Decode("", &securePrefs); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if securePrefs.Extensions == nil || !reflect.DeepEqual(securePrefs.Extensions.Settings["abc"], map[string]interface{}{"path": "/ext"}) {
+		t.Errorf("Decode() extensions = %+v, want the abc entry", securePrefs.Extensions)
+	}
+	if p := securePrefs.Protection; p == nil || p.SuperMac != "OLD" || p.Macs == nil || p.Macs.Extensions == nil || p.Macs.Extensions.Settings["abc"] != "MAC" {
+		t.Errorf("Decode() protection = %+v, want the MAC and super_mac", p)
+	}
+}
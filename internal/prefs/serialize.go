@@ -0,0 +1,141 @@
+package prefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Serialize writes a document value compactly in document key order,
+// escaping strings the way Chromium's JSON writer does
+func Serialize(value interface{}) string {
+	var sb strings.Builder
+	writeValue(&sb, value, false, false)
+	return sb.String()
+}
+
+// SerializeForMAC serializes a value the way Chromium does before hashing a
+// tracked pref: sorted keys and, below an object, empty lists and objects
+// removed from objects and lists alike. A missing (nil) value serializes to an
+// empty string.
+func SerializeForMAC(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	// Chromium only prunes a value that is an object at the top level
+	_, prune := normalize(value).(*Object)
+	var sb strings.Builder
+	writeValue(&sb, value, true, prune)
+	return sb.String()
+}
+
+// writeValue serializes value, with object keys sorted if sorted is set and
+// empty containers left out if prune is set
+func writeValue(sb *strings.Builder, value interface{}, sorted, prune bool) {
+	switch v := value.(type) {
+	case nil:
+		sb.WriteString("null")
+	case bool:
+		if v {
+			sb.WriteString("true")
+		} else {
+			sb.WriteString("false")
+		}
+	case json.Number:
+		sb.WriteString(v.String())
+	case string:
+		writeString(sb, v)
+	case []interface{}:
+		sb.WriteByte('[')
+		first := true
+		for _, item := range v {
+			if prune && isEmptyContainer(item) {
+				continue
+			}
+			if !first {
+				sb.WriteByte(',')
+			}
+			first = false
+			writeValue(sb, item, sorted, prune)
+		}
+		sb.WriteByte(']')
+	case *Object:
+		var keys []string
+		for _, k := range v.keys {
+			if !prune || !isEmptyContainer(v.values[k]) {
+				keys = append(keys, k)
+			}
+		}
+		if sorted {
+			sort.Strings(keys)
+		}
+		sb.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			writeString(sb, k)
+			sb.WriteByte(':')
+			writeValue(sb, v.values[k], sorted, prune)
+		}
+		sb.WriteByte('}')
+	default:
+		writeValue(sb, normalize(value), sorted, prune)
+	}
+}
+
+func writeString(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '<':
+			sb.WriteString(`\u003C`)
+		case '\u2028', '\u2029':
+			fmt.Fprintf(sb, `\u%04X`, r)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+}
+
+// isEmptyContainer reports whether value is a list or an object holding
+// nothing but empty containers
+func isEmptyContainer(value interface{}) bool {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if !isEmptyContainer(item) {
+				return false
+			}
+		}
+		return true
+	case *Object:
+		for _, item := range v.values {
+			if !isEmptyContainer(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package prefs
+
+import "testing"
+
+func TestSerializeEscaping(t *testing.T) {
+	input := "<all_urls>\n\t\"q\" \\ \u2028 \x01 é"
+	expected := `"\u003Call_urls>\n\t\"q\" \\ \u2028 \u0001 é"`
+	if result := Serialize(input); result != expected {
+		t.Errorf("Serialize() = %s, want %s", result, expected)
+	}
+}
+
+func TestSerializeForMAC(t *testing.T) {
+	doc, _ := Parse([]byte(`{"path":"C:\\ext","hosts":["<all_urls>"],"empty":{"nested":[]},"state":1,"list":[],"inner":{"b":[],"a":{}},"keep":[[]]}`))
+
+	expected := `{"hosts":["\u003Call_urls>"],"path":"C:\\ext","state":1}`
+	if result := SerializeForMAC(doc.Root()); result != expected {
+		t.Errorf("SerializeForMAC() = %s, want %s", result, expected)
+	}
+
+	// Empty containers are pruned from lists too, but not from a top-level list
+	doc, _ = Parse([]byte(`{"list":[[],{},1,{"b":[],"a":2},[{}]],"top":[]}`))
+	if result := SerializeForMAC(doc.Root()); result != `{"list":[1,{"a":2}]}` {
+		t.Errorf("SerializeForMAC() with nested lists = %s", result)
+	}
+	if result := SerializeForMAC([]interface{}{[]interface{}{}, NewObject()}); result != `[[],{}]` {
+		t.Errorf("SerializeForMAC() of a list = %s, want it unpruned", result)
+	}
+	if result := SerializeForMAC(nil); result != "" {
+		t.Errorf("SerializeForMAC(nil) = %q, want empty", result)
+	}
+	if result := SerializeForMAC(map[string]interface{}{"b": true, "a": 1}); result != `{"a":1,"b":true}` {
+		t.Errorf("SerializeForMAC(map) = %s", result)
+	}
+}
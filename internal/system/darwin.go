@@ -0,0 +1,29 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+)
+
+var platformUUIDRegex = regexp.MustCompile(`"IOPlatformUUID"\s*=\s*"([0-9A-Fa-f-]+)"`)
+
+// GetPlatformUUID retrieves the IOPlatformUUID of a Mac; the command is killed if ctx is done
+func GetPlatformUUID(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "ioreg", "-rd1", "-c", "IOPlatformExpertDevice")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return parsePlatformUUID(string(output))
+}
+
+func parsePlatformUUID(output string) (string, error) {
+	match := platformUUIDRegex.FindStringSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("IOPlatformUUID not found")
+	}
+	return match[1], nil
+}
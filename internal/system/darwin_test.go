@@ -0,0 +1,36 @@
+package system
+
+import "testing"
+
+func TestParsePlatformUUID(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "ioreg output",
+			output: `+-o MacBookPro18,3  <class IOPlatformExpertDevice, id 0x100000112, registered, matched, active, busy 0 (0 ms), retain 32>
+    {
+      "IOPlatformSerialNumber" = "C02XXXXXXXXX"
+      "IOPlatformUUID" = "6B8C4A0E-2F3D-5C1B-9A7E-0D4F8E2C1B3A"
+      "model" = <"MacBookPro18,3">
+    }`,
+			want: "6B8C4A0E-2F3D-5C1B-9A7E-0D4F8E2C1B3A",
+		},
+		{name: "missing", output: `"IOPlatformSerialNumber" = "C02XXXXXXXXX"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePlatformUUID(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePlatformUUID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePlatformUUID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
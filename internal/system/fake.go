@@ -0,0 +1,49 @@
+package system
+
+import "context"
+
+// FakeProvider is an in-memory DeviceIDProvider for tests. It fails with the
+// context's error once the context is done.
+type FakeProvider struct {
+	SID          string
+	VolumeSerial string
+	UUID         string
+	Err          error
+	Calls        int
+}
+
+// UserSID returns the fake SID or Err
+func (p *FakeProvider) UserSID(ctx context.Context) (string, error) {
+	p.Calls++
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if p.Err != nil {
+		return "", p.Err
+	}
+	return p.SID, nil
+}
+
+// VolumeSerialNumber returns the fake serial or Err
+func (p *FakeProvider) VolumeSerialNumber(ctx context.Context) (string, error) {
+	p.Calls++
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if p.Err != nil {
+		return "", p.Err
+	}
+	return p.VolumeSerial, nil
+}
+
+// PlatformUUID returns the fake platform UUID or Err
+func (p *FakeProvider) PlatformUUID(ctx context.Context) (string, error) {
+	p.Calls++
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if p.Err != nil {
+		return "", p.Err
+	}
+	return p.UUID, nil
+}
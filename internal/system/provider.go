@@ -0,0 +1,88 @@
+package system
+
+import (
+	"context"
+	"os"
+)
+
+// Environment variables that override the detected device identifiers
+const (
+	EnvSID          = "CEI_SID"
+	EnvVolumeSerial = "CEI_VOLUME_SERIAL"
+	EnvPlatformUUID = "CEI_PLATFORM_UUID"
+)
+
+// DeviceIDProvider supplies the machine identifiers used to sign preferences
+type DeviceIDProvider interface {
+	UserSID(ctx context.Context) (string, error)
+	VolumeSerialNumber(ctx context.Context) (string, error)
+	// PlatformUUID returns the IOPlatformUUID of a Mac
+	PlatformUUID(ctx context.Context) (string, error)
+}
+
+// CommandProvider reads identifiers by running whoami, vol and ioreg
+type CommandProvider struct{}
+
+// UserSID runs whoami /user
+func (CommandProvider) UserSID(ctx context.Context) (string, error) {
+	return GetStringSID(ctx)
+}
+
+// VolumeSerialNumber runs vol
+func (CommandProvider) VolumeSerialNumber(ctx context.Context) (string, error) {
+	return GetVolumeSerialNumber(ctx)
+}
+
+// PlatformUUID runs ioreg
+func (CommandProvider) PlatformUUID(ctx context.Context) (string, error) {
+	return GetPlatformUUID(ctx)
+}
+
+// OverrideProvider returns fixed identifiers where set and asks Fallback otherwise
+type OverrideProvider struct {
+	SID          string
+	VolumeSerial string
+	UUID         string
+	Fallback     DeviceIDProvider
+}
+
+// UserSID returns the overridden SID or the fallback's
+func (p OverrideProvider) UserSID(ctx context.Context) (string, error) {
+	if p.SID != "" || p.Fallback == nil {
+		return p.SID, nil
+	}
+	return p.Fallback.UserSID(ctx)
+}
+
+// VolumeSerialNumber returns the overridden serial or the fallback's
+func (p OverrideProvider) VolumeSerialNumber(ctx context.Context) (string, error) {
+	if p.VolumeSerial != "" || p.Fallback == nil {
+		return p.VolumeSerial, nil
+	}
+	return p.Fallback.VolumeSerialNumber(ctx)
+}
+
+// PlatformUUID returns the overridden platform UUID or the fallback's
+func (p OverrideProvider) PlatformUUID(ctx context.Context) (string, error) {
+	if p.UUID != "" || p.Fallback == nil {
+		return p.UUID, nil
+	}
+	return p.Fallback.PlatformUUID(ctx)
+}
+
+// DefaultProvider honours CEI_SID, CEI_VOLUME_SERIAL and CEI_PLATFORM_UUID and
+// falls back to system commands
+func DefaultProvider() DeviceIDProvider {
+	return EnvProvider(CommandProvider{})
+}
+
+// EnvProvider overrides fallback with CEI_SID, CEI_VOLUME_SERIAL and
+// CEI_PLATFORM_UUID when set
+func EnvProvider(fallback DeviceIDProvider) DeviceIDProvider {
+	return OverrideProvider{
+		SID:          os.Getenv(EnvSID),
+		VolumeSerial: os.Getenv(EnvVolumeSerial),
+		UUID:         os.Getenv(EnvPlatformUUID),
+		Fallback:     fallback,
+	}
+}
@@ -0,0 +1,56 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOverrideProvider(t *testing.T) {
+	fallback := &FakeProvider{SID: "S-1-5-21-1-2-3-1001", VolumeSerial: "1234-ABCD"}
+
+	provider := OverrideProvider{SID: "S-1-5-21-9-9-9-500", Fallback: fallback}
+	if sid, _ := provider.UserSID(context.Background()); sid != "S-1-5-21-9-9-9-500" {
+		t.Errorf("UserSID() = %q, want override", sid)
+	}
+	if serial, _ := provider.VolumeSerialNumber(context.Background()); serial != "1234-ABCD" {
+		t.Errorf("VolumeSerialNumber() = %q, want fallback", serial)
+	}
+	if uuid, _ := provider.PlatformUUID(context.Background()); uuid != "" {
+		t.Errorf("PlatformUUID() = %q, want fallback", uuid)
+	}
+	if fallback.Calls != 2 {
+		t.Errorf("fallback called %d times, want 2", fallback.Calls)
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv(EnvSID, "S-1-5-21-7-7-7-1001")
+	t.Setenv(EnvVolumeSerial, "")
+	t.Setenv(EnvPlatformUUID, "6B8C4A0E-2F3D-5C1B-9A7E-0D4F8E2C1B3A")
+
+	fallback := &FakeProvider{Err: errors.New("no whoami")}
+	provider := EnvProvider(fallback)
+
+	if sid, err := provider.UserSID(context.Background()); err != nil || sid != "S-1-5-21-7-7-7-1001" {
+		t.Errorf("UserSID() = %q, %v, want value from %s", sid, err, EnvSID)
+	}
+	if _, err := provider.VolumeSerialNumber(context.Background()); err == nil {
+		t.Error("VolumeSerialNumber() should fall back and return its error")
+	}
+	if uuid, err := provider.PlatformUUID(context.Background()); err != nil || uuid != "6B8C4A0E-2F3D-5C1B-9A7E-0D4F8E2C1B3A" {
+		t.Errorf("PlatformUUID() = %q, %v, want value from %s", uuid, err, EnvPlatformUUID)
+	}
+}
+
+func TestProvidersHonourCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	providers := []DeviceIDProvider{CommandProvider{}, &FakeProvider{SID: "S-1-5-21-1-2-3-1001"}}
+	for _, provider := range providers {
+		if _, err := provider.UserSID(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("%T.UserSID() error = %v, want context.Canceled", provider, err)
+		}
+	}
+}
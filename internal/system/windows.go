@@ -1,44 +1,63 @@
 package system
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"regexp"
+	"strings"
 )
 
-// GetVolumeSerialNumber retrieves the volume serial number
-func GetVolumeSerialNumber() (string, error) {
-	cmd := exec.Command("cmd", "/c", "vol")
+var (
+	// vol prints a localized label, so match the serial number format only
+	volumeSerialRegex = regexp.MustCompile(`\b[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}\b`)
+	sidRegex          = regexp.MustCompile(`\bS-1-\d+-\d+(-\d+)*\b`)
+)
+
+// GetVolumeSerialNumber retrieves the volume serial number; the command is killed if ctx is done
+func GetVolumeSerialNumber(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "cmd", "/c", "vol")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
 	}
 
-	re := regexp.MustCompile(`Serial Number is ([A-F0-9-]+)`)
-	match := re.FindStringSubmatch(string(output))
-	if len(match) > 1 {
-		return match[1], nil
-	}
-
-	return "", fmt.Errorf("volume serial number not found")
+	return parseVolumeSerialNumber(string(output))
 }
 
-// GetStringSID retrieves the user's SID
-func GetStringSID() (string, error) {
-	cmd := exec.Command("whoami", "/user")
+// GetStringSID retrieves the user's SID; the command is killed if ctx is done
+func GetStringSID(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "whoami", "/user")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
 	}
 
-	re := regexp.MustCompile(`\bS-1-\d+-\d+(-\d+)*\b`)
-	match := re.FindString(string(output))
-	if match != "" {
-		// Remove last 5 characters
-		if len(match) > 5 {
-			return match[:len(match)-5], nil
-		}
+	return parseSID(string(output))
+}
+
+func parseVolumeSerialNumber(output string) (string, error) {
+	match := volumeSerialRegex.FindString(output)
+	if match == "" {
+		return "", fmt.Errorf("volume serial number not found")
 	}
+	return strings.ToUpper(match), nil
+}
 
-	return "", fmt.Errorf("SID not found")
+func parseSID(output string) (string, error) {
+	match := sidRegex.FindString(output)
+	if match == "" {
+		return "", fmt.Errorf("SID not found")
+	}
+	return match, nil
+}
+
+// MachineSID strips the relative identifier (the last component) from a user
+// SID, leaving the machine SID Chromium uses as its device ID
+func MachineSID(userSID string) (string, error) {
+	i := strings.LastIndex(userSID, "-")
+	if !strings.HasPrefix(userSID, "S-1-") || i <= len("S-1") {
+		return "", fmt.Errorf("invalid SID %q", userSID)
+	}
+	return userSID[:i], nil
 }
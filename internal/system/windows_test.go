@@ -0,0 +1,107 @@
+package system
+
+import "testing"
+
+func TestMachineSID(t *testing.T) {
+	tests := []struct {
+		name     string
+		userSID  string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Four digit RID",
+			userSID:  "S-1-5-21-1004336348-1177238915-682003330-1001",
+			expected: "S-1-5-21-1004336348-1177238915-682003330",
+		},
+		{
+			name:     "Built-in administrator RID",
+			userSID:  "S-1-5-21-1004336348-1177238915-682003330-500",
+			expected: "S-1-5-21-1004336348-1177238915-682003330",
+		},
+		{
+			name:     "Five digit RID",
+			userSID:  "S-1-5-21-1004336348-1177238915-682003330-10001",
+			expected: "S-1-5-21-1004336348-1177238915-682003330",
+		},
+		{
+			name:    "No RID",
+			userSID: "S-1-5",
+			wantErr: true,
+		},
+		{
+			name:    "Not a SID",
+			userSID: "hello-world",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := MachineSID(tt.userSID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MachineSID(%q) error = %v, wantErr %v", tt.userSID, err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("MachineSID(%q) = %q, want %q", tt.userSID, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseVolumeSerialNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "English",
+			output:   " Volume in drive C has no label.\r\n Volume Serial Number is 1A2B-3C4D\r\n",
+			expected: "1A2B-3C4D",
+		},
+		{
+			name:     "German",
+			output:   " Volume in Laufwerk C: hat keine Bezeichnung.\r\n Volumeseriennummer: 1a2b-3c4d\r\n",
+			expected: "1A2B-3C4D",
+		},
+		{
+			name:     "Chinese",
+			output:   " 驱动器 C 中的卷没有标签。\r\n 卷的序列号是 0E4F-9A21\r\n",
+			expected: "0E4F-9A21",
+		},
+		{
+			name:    "No serial",
+			output:  "The system cannot find the drive specified.",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseVolumeSerialNumber(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVolumeSerialNumber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("parseVolumeSerialNumber() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSID(t *testing.T) {
+	output := "USER INFORMATION\r\n----------------\r\n\r\nUser Name      SID\r\n============== =============================================\r\ndesktop\\user S-1-5-21-1004336348-1177238915-682003330-1001\r\n"
+	sid, err := parseSID(output)
+	if err != nil {
+		t.Fatalf("parseSID() error = %v", err)
+	}
+	if sid != "S-1-5-21-1004336348-1177238915-682003330-1001" {
+		t.Errorf("parseSID() = %q", sid)
+	}
+
+	if _, err := parseSID("no sid here"); err == nil {
+		t.Error("parseSID() should fail without a SID")
+	}
+}
@@ -0,0 +1,42 @@
+package types
+
+// Manifest represents the extension manifest.json structure
+type Manifest struct {
+	ManifestVersion     int                 `json:"manifest_version"`
+	Name                string              `json:"name"`
+	Version             string              `json:"version"`
+	Description         string              `json:"description,omitempty"`
+	Key                 string              `json:"key,omitempty"`
+	UpdateURL           string              `json:"update_url,omitempty"`
+	Icons               map[string]string   `json:"icons,omitempty"`
+	Background          *ManifestBackground `json:"background,omitempty"`
+	ContentScripts      []ContentScript     `json:"content_scripts,omitempty"`
+	Action              *ManifestAction     `json:"action,omitempty"`
+	BrowserAction       *ManifestAction     `json:"browser_action,omitempty"`
+	PageAction          *ManifestAction     `json:"page_action,omitempty"`
+	Permissions         []string            `json:"permissions,omitempty"`
+	OptionalPermissions []string            `json:"optional_permissions,omitempty"`
+	HostPermissions     []string            `json:"host_permissions,omitempty"`
+}
+
+// ManifestBackground represents the background section of a manifest
+type ManifestBackground struct {
+	ServiceWorker string   `json:"service_worker,omitempty"`
+	Scripts       []string `json:"scripts,omitempty"`
+	Page          string   `json:"page,omitempty"`
+}
+
+// ContentScript represents a single content_scripts entry
+type ContentScript struct {
+	Matches []string `json:"matches,omitempty"`
+	JS      []string `json:"js,omitempty"`
+	CSS     []string `json:"css,omitempty"`
+}
+
+// ManifestAction represents action, browser_action and page_action sections.
+// DefaultIcon is either a single path or a size-to-path map.
+type ManifestAction struct {
+	DefaultPopup string      `json:"default_popup,omitempty"`
+	DefaultTitle string      `json:"default_title,omitempty"`
+	DefaultIcon  interface{} `json:"default_icon,omitempty"`
+}
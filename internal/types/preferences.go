@@ -1,10 +1,5 @@
 package types
 
-// Manifest represents the extension manifest.json structure
-type Manifest struct {
-	Name string `json:"name"`
-}
-
 // Preferences represents Chrome's Preferences file structure
 type Preferences struct {
 	Extensions *ExtensionsPrefs `json:"extensions,omitempty"`
@@ -0,0 +1,92 @@
+package update
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Limits on what FetchManifest and Download read from a server
+const (
+	maxManifestSize = 1 << 20
+	maxPackageSize  = 256 << 20
+)
+
+// CheckURL returns the update check request Chromium sends to updateURL for
+// checks, in the form ParseChecks reads
+func CheckURL(updateURL string, checks []Check) (string, error) {
+	u, err := url.Parse(updateURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid update URL %q: %v", updateURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid update URL %q: want http or https", updateURL)
+	}
+
+	query := u.Query()
+	query.Set("response", "updatecheck")
+	for _, check := range checks {
+		query.Add("x", url.Values{"id": {check.ID}, "v": {check.Version}}.Encode()+"&uc")
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// FetchManifest sends an update check for checks to updateURL and returns the response
+func FetchManifest(ctx context.Context, client *http.Client, updateURL string, checks []Check) (*Manifest, error) {
+	checkURL, err := CheckURL(updateURL, checks)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fetch(ctx, client, checkURL, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// Download fetches a package from its codebase. If hashSHA256 is set the
+// package must have that hex digest.
+func Download(ctx context.Context, client *http.Client, codebase, hashSHA256 string) ([]byte, error) {
+	data, err := fetch(ctx, client, codebase, maxPackageSize)
+	if err != nil {
+		return nil, err
+	}
+	if hashSHA256 != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); actual != strings.ToLower(hashSHA256) {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", codebase, hashSHA256, actual)
+		}
+	}
+	return data, nil
+}
+
+// fetch returns the body of a successful GET request, failing beyond limit bytes
+func fetch(ctx context.Context, client *http.Client, target string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %v", target, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", target, limit)
+	}
+	return data, nil
+}
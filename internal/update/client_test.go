@@ -0,0 +1,77 @@
+package update
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+)
+
+func TestCheckURL(t *testing.T) {
+	checks := []Check{{ID: "abc", Version: "1.2"}, {ID: "def"}}
+	got, err := CheckURL("https://example.com/updates.xml?channel=beta", checks)
+	if err != nil {
+		t.Fatalf("CheckURL() error = %v", err)
+	}
+	u, _ := url.Parse(got)
+	if u.Path != "/updates.xml" || u.Query().Get("channel") != "beta" || u.Query().Get("response") != "updatecheck" {
+		t.Errorf("CheckURL() = %s", got)
+	}
+	if parsed := ParseChecks(u.Query()); !reflect.DeepEqual(parsed, checks) {
+		t.Errorf("ParseChecks(CheckURL()) = %+v, want %+v", parsed, checks)
+	}
+
+	for _, invalid := range []string{"ftp://example.com/updates.xml", "updates.xml", "http://[::1"} {
+		if _, err := CheckURL(invalid, checks); err == nil {
+			t.Errorf("CheckURL(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestFetchManifestAndDownload(t *testing.T) {
+	fs, a, _ := newPackageDir(t)
+	handler := Handler(fs, "/crxs", "", logging.Discard)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	ctx := context.Background()
+
+	m, err := FetchManifest(ctx, server.Client(), server.URL+ManifestPath, []Check{{ID: testID(a), Version: "1.0"}})
+	if err != nil {
+		t.Fatalf("FetchManifest() error = %v", err)
+	}
+	app, ok := m.App(testID(a))
+	if !ok || app.UpdateCheck == nil || app.UpdateCheck.Version != "1.10" {
+		t.Fatalf("FetchManifest() = %+v, want an update to 1.10", m)
+	}
+
+	check := app.UpdateCheck
+	data, err := Download(ctx, server.Client(), check.Codebase, check.HashSHA256)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if want, _ := fs.ReadFile("/crxs/a-1.10.crx"); string(data) != string(want) {
+		t.Error("Download() returned a different package")
+	}
+
+	wrongHash := fmt.Sprintf("%x", sha256.Sum256([]byte("other")))
+	if _, err := Download(ctx, server.Client(), check.Codebase, wrongHash); err == nil {
+		t.Error("Download() with a wrong hash should fail")
+	}
+	if _, err := Download(ctx, server.Client(), server.URL+"/missing.crx", ""); err == nil {
+		t.Error("Download() of a missing package should fail")
+	}
+
+	notXML := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a manifest"))
+	}))
+	defer notXML.Close()
+	if _, err := FetchManifest(ctx, notXML.Client(), notXML.URL, nil); err == nil {
+		t.Error("FetchManifest() of an invalid response should fail")
+	}
+}
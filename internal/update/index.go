@@ -0,0 +1,127 @@
+package update
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/types"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// Package is a CRX file in a package directory
+type Package struct {
+	ID      string
+	Name    string
+	Version string
+	// File is the file name within the directory
+	File string
+	// SHA256 is the hex digest of the file
+	SHA256 string
+}
+
+// Inspect verifies a CRX package and returns its extension ID and manifest
+func Inspect(data []byte) (string, *types.Manifest, error) {
+	key, err := crx.Verify(data, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("CRX verification failed: %v", err)
+	}
+	file, err := crx.Parse(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(file.Archive), int64(len(file.Archive)))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid CRX archive: %v", err)
+	}
+	entry, err := archive.Open("manifest.json")
+	if err != nil {
+		return "", nil, fmt.Errorf("manifest.json not found in CRX archive")
+	}
+	defer entry.Close()
+	data, err = io.ReadAll(entry)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var manifest types.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", nil, fmt.Errorf("invalid manifest.json: %v", err)
+	}
+	if manifest.Version == "" {
+		return "", nil, fmt.Errorf("manifest.json has no version")
+	}
+	return crx.ID(key), &manifest, nil
+}
+
+// Index returns the newest package of each extension among the .crx files in
+// dir, sorted by ID. Files that are not valid, signed packages are logged and skipped.
+func Index(fs fsys.FS, dir string, logger *slog.Logger) ([]Package, error) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	newest := map[string]Package{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".crx") {
+			continue
+		}
+		data, err := fs.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			logger.Warn("skipping package", "file", entry.Name(), logging.KeyError, err)
+			continue
+		}
+		id, manifest, err := Inspect(data)
+		if err != nil {
+			logger.Warn("skipping package", "file", entry.Name(), logging.KeyError, err)
+			continue
+		}
+
+		sum := sha256.Sum256(data)
+		pkg := Package{ID: id, Name: manifest.Name, Version: manifest.Version, File: entry.Name(), SHA256: hex.EncodeToString(sum[:])}
+		if current, ok := newest[id]; !ok || utils.CompareVersions(pkg.Version, current.Version) > 0 {
+			newest[id] = pkg
+		}
+	}
+
+	packages := make([]Package, 0, len(newest))
+	for _, pkg := range newest {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].ID < packages[j].ID })
+	return packages, nil
+}
+
+// codebase returns the download URL of a package below baseURL
+func codebase(baseURL string, pkg Package) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(pkg.File)
+}
+
+// BuildManifest returns an update manifest offering every package, downloaded
+// from baseURL followed by its file name
+func BuildManifest(packages []Package, baseURL string) *Manifest {
+	m := &Manifest{}
+	for _, pkg := range packages {
+		m.Apps = append(m.Apps, App{ID: pkg.ID, Status: "ok", UpdateCheck: &UpdateCheck{
+			Status:     "ok",
+			Codebase:   codebase(baseURL, pkg),
+			Version:    pkg.Version,
+			HashSHA256: pkg.SHA256,
+		}})
+	}
+	return m
+}
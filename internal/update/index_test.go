@@ -0,0 +1,103 @@
+package update
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/crx"
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+)
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testPackage returns a CRX3 package signed by key whose manifest has the given name and version
+func testPackage(t *testing.T, key *ecdsa.PrivateKey, name, version string) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	w := zip.NewWriter(&archive)
+	f, _ := w.Create("manifest.json")
+	fmt.Fprintf(f, `{"manifest_version": 3, "name": %q, "version": %q}`, name, version)
+	w.Close()
+
+	data, err := crx.Pack(archive.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testID(key *ecdsa.PrivateKey) string {
+	publicKey, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return crx.ID(publicKey)
+}
+
+// newPackageDir writes two versions of extension a, one of b and some other files to /crxs
+func newPackageDir(t *testing.T) (fsys.FS, *ecdsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	a, b := newTestKey(t), newTestKey(t)
+	fs := fsys.NewMemory()
+	fs.MkdirAll("/crxs/sub.crx", 0755)
+	fs.WriteFile("/crxs/a-1.0.crx", testPackage(t, a, "A", "1.0"), 0644)
+	fs.WriteFile("/crxs/a-1.10.crx", testPackage(t, a, "A", "1.10"), 0644)
+	fs.WriteFile("/crxs/a-1.9.crx", testPackage(t, a, "A", "1.9"), 0644)
+	fs.WriteFile("/crxs/b.CRX", testPackage(t, b, "B", "3.0"), 0644)
+	fs.WriteFile("/crxs/broken.crx", []byte("Cr24 not really"), 0644)
+	fs.WriteFile("/crxs/notes.txt", []byte("not a package"), 0644)
+	return fs, a, b
+}
+
+func TestIndex(t *testing.T) {
+	fs, a, b := newPackageDir(t)
+
+	packages, err := Index(fs, "/crxs", logging.Discard)
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	want := map[string]Package{
+		testID(a): {ID: testID(a), Name: "A", Version: "1.10", File: "a-1.10.crx"},
+		testID(b): {ID: testID(b), Name: "B", Version: "3.0", File: "b.CRX"},
+	}
+	if len(packages) != len(want) {
+		t.Fatalf("Index() = %+v, want %d packages", packages, len(want))
+	}
+	for i, pkg := range packages {
+		if i > 0 && packages[i-1].ID >= pkg.ID {
+			t.Error("Index() is not sorted by ID")
+		}
+		data, _ := fs.ReadFile("/crxs/" + pkg.File)
+		sum := sha256.Sum256(data)
+		w := want[pkg.ID]
+		w.SHA256 = fmt.Sprintf("%x", sum)
+		if pkg != w {
+			t.Errorf("Index() package = %+v, want %+v", pkg, w)
+		}
+	}
+
+	if _, err := Index(fs, "/missing", logging.Discard); err == nil {
+		t.Error("Index() of a missing directory should fail")
+	}
+}
+
+func TestBuildManifest(t *testing.T) {
+	packages := []Package{{ID: "abc", Version: "1.0", File: "my ext.crx", SHA256: "00ff"}}
+	m := BuildManifest(packages, "https://example.com/crxs/")
+	check := m.Apps[0].UpdateCheck
+	if m.Apps[0].ID != "abc" || check.Codebase != "https://example.com/crxs/my%20ext.crx" || check.Version != "1.0" || check.HashSHA256 != "00ff" {
+		t.Errorf("BuildManifest() = %+v, %+v", m.Apps[0], check)
+	}
+}
@@ -0,0 +1,71 @@
+// Package update implements Chromium's gupdate extension update protocol:
+// update manifests, update checks and a directory of CRX files to serve
+package update
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Namespace and Protocol identify gupdate update manifests
+const (
+	Namespace = "http://www.google.com/update2/response"
+	Protocol  = "2.0"
+)
+
+// Manifest is a gupdate update manifest
+type Manifest struct {
+	XMLName  xml.Name `xml:"gupdate"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Protocol string   `xml:"protocol,attr"`
+	Apps     []App    `xml:"app"`
+}
+
+// App is the update information of one extension
+type App struct {
+	ID string `xml:"appid,attr"`
+	// Status is empty or "ok" for known extensions and "error-unknownApplication" otherwise
+	Status      string       `xml:"status,attr,omitempty"`
+	UpdateCheck *UpdateCheck `xml:"updatecheck"`
+}
+
+// UpdateCheck points at the current version of an extension. Status is
+// "noupdate" when the client already has it, and then nothing else is set.
+type UpdateCheck struct {
+	Status     string `xml:"status,attr,omitempty"`
+	Codebase   string `xml:"codebase,attr,omitempty"`
+	Version    string `xml:"version,attr,omitempty"`
+	HashSHA256 string `xml:"hash_sha256,attr,omitempty"`
+}
+
+// Encode returns the manifest as an XML document
+func (m *Manifest) Encode() ([]byte, error) {
+	m.Xmlns, m.Protocol = Namespace, Protocol
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// ParseManifest decodes an update manifest
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := xml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid update manifest: %v", err)
+	}
+	if m.Protocol != Protocol {
+		return nil, fmt.Errorf("unsupported update manifest protocol %q", m.Protocol)
+	}
+	return &m, nil
+}
+
+// App returns the entry for an extension ID, if the manifest has one
+func (m *Manifest) App(id string) (App, bool) {
+	for _, app := range m.Apps {
+		if app.ID == id {
+			return app, true
+		}
+	}
+	return App{}, false
+}
@@ -0,0 +1,35 @@
+package update
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManifestEncodeParse(t *testing.T) {
+	m := &Manifest{Apps: []App{{ID: "abc", Status: "ok", UpdateCheck: &UpdateCheck{Codebase: "https://example.com/a.crx", Version: "1.2"}}}}
+	data, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	for _, want := range []string{`<gupdate xmlns="http://www.google.com/update2/response" protocol="2.0">`, `<app appid="abc" status="ok">`, `codebase="https://example.com/a.crx"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Encode() = %s, want it to contain %s", data, want)
+		}
+	}
+
+	parsed, err := ParseManifest(data)
+	if err != nil {
+		t.Fatalf("ParseManifest() error = %v", err)
+	}
+	app, ok := parsed.App("abc")
+	if !ok || app.UpdateCheck == nil || app.UpdateCheck.Version != "1.2" {
+		t.Errorf("ParseManifest() app = %+v, %v", app, ok)
+	}
+	if _, ok := parsed.App("missing"); ok {
+		t.Error("App(missing) should not be found")
+	}
+
+	if _, err := ParseManifest([]byte(`<gupdate protocol="3.0"></gupdate>`)); err == nil {
+		t.Error("ParseManifest() should reject other protocols")
+	}
+}
@@ -0,0 +1,189 @@
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+	"github.com/yinxulai/chromium-extension-installer/internal/utils"
+)
+
+// ManifestPath is where Handler serves the update manifest
+const ManifestPath = "/updates.xml"
+
+// CRXContentType is the media type of CRX packages
+const CRXContentType = "application/x-chrome-extension"
+
+// Check is one extension in an update check request
+type Check struct {
+	ID string
+	// Version is the installed version; empty if not installed
+	Version string
+}
+
+// ParseChecks returns the extensions of an update check request. Chromium
+// sends one x parameter per extension, itself a query string such as
+// "id=<id>&v=<version>&uc".
+func ParseChecks(query url.Values) []Check {
+	var checks []Check
+	for _, x := range query["x"] {
+		values, err := url.ParseQuery(x)
+		if err != nil || values.Get("id") == "" {
+			continue
+		}
+		checks = append(checks, Check{ID: values.Get("id"), Version: values.Get("v")})
+	}
+	return checks
+}
+
+// Respond returns the update manifest answering checks: a newer package
+// where there is one, "noupdate" where the client is current and
+// "error-unknownApplication" for IDs without a package. Without checks the
+// manifest offers every package.
+func Respond(packages []Package, baseURL string, checks []Check) *Manifest {
+	if len(checks) == 0 {
+		return BuildManifest(packages, baseURL)
+	}
+
+	m := &Manifest{}
+	for _, check := range checks {
+		var found *Package
+		for i := range packages {
+			if packages[i].ID == check.ID {
+				found = &packages[i]
+				break
+			}
+		}
+
+		switch {
+		case found == nil:
+			m.Apps = append(m.Apps, App{ID: check.ID, Status: "error-unknownApplication"})
+		case check.Version != "" && utils.CompareVersions(check.Version, found.Version) >= 0:
+			m.Apps = append(m.Apps, App{ID: check.ID, Status: "ok", UpdateCheck: &UpdateCheck{Status: "noupdate"}})
+		default:
+			m.Apps = append(m.Apps, BuildManifest([]Package{*found}, baseURL).Apps...)
+		}
+	}
+	return m
+}
+
+// packageIndex caches the index of a directory
+type packageIndex struct {
+	fs     fsys.FS
+	dir    string
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	indexed  bool
+	state    string
+	packages []Package
+}
+
+// dirState describes the CRX files of dir by name, size and modification
+// time, so that any file added, removed or rewritten changes it
+func dirState(fs fsys.FS, dir string) (string, error) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".crx") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since ReadDir; it is skipped by the index as well
+			continue
+		}
+		fmt.Fprintf(&sb, "%s\x00%d\x00%d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// get returns the packages of the directory, indexing it again only when one
+// of its CRX files has been added, removed or changed since the last index
+func (i *packageIndex) get() ([]Package, error) {
+	state, err := dirState(i.fs, i.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.indexed && state == i.state {
+		return i.packages, nil
+	}
+	packages, err := Index(i.fs, i.dir, i.logger)
+	if err != nil {
+		return nil, err
+	}
+	i.indexed, i.state, i.packages = true, state, packages
+	return packages, nil
+}
+
+// Handler serves the update manifest at ManifestPath and the packages of dir
+// below it. dir is indexed again whenever a CRX file in it is added, removed
+// or changed, so packages can be replaced while it runs.
+// baseURL is the URL the handler is reached at; empty derives it from each
+// request's Host header.
+func Handler(fs fsys.FS, dir, baseURL string, logger *slog.Logger) http.Handler {
+	index := &packageIndex{fs: fs, dir: dir, logger: logger}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		packages, err := index.get()
+		if err != nil {
+			logger.Error("failed to index packages", "dir", dir, logging.KeyError, err)
+			http.Error(w, "failed to index packages", http.StatusInternalServerError)
+			return
+		}
+
+		if r.URL.Path == ManifestPath {
+			base := baseURL
+			if base == "" {
+				base = "http://" + r.Host
+			}
+			checks := ParseChecks(r.URL.Query())
+			data, err := Respond(packages, base, checks).Encode()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			logger.Debug("update check", "remote", r.RemoteAddr, "extensions", len(checks))
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.Write(data)
+			return
+		}
+
+		// Only indexed packages are served, so nothing else in dir is exposed
+		name := path.Base(r.URL.Path)
+		for _, pkg := range packages {
+			if r.URL.Path == "/"+pkg.File && name == pkg.File {
+				data, err := fs.ReadFile(filepath.Join(dir, pkg.File))
+				if err != nil {
+					http.Error(w, "failed to read package", http.StatusInternalServerError)
+					return
+				}
+				logger.Info("package downloaded", logging.KeyExtensionID, pkg.ID, "version", pkg.Version, "remote", r.RemoteAddr)
+				w.Header().Set("Content-Type", CRXContentType)
+				http.ServeContent(w, r, pkg.File, time.Time{}, bytes.NewReader(data))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+}
@@ -0,0 +1,143 @@
+package update
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/logging"
+)
+
+func TestParseChecks(t *testing.T) {
+	query, _ := url.ParseQuery("response=updatecheck&x=id%3Dabc%26v%3D1.2%26installsource%3Dondemand%26uc&x=id%3Ddef%26uc&x=v%3D1.0")
+	want := []Check{{ID: "abc", Version: "1.2"}, {ID: "def"}}
+	if got := ParseChecks(query); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseChecks() = %+v, want %+v", got, want)
+	}
+}
+
+func get(t *testing.T, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestHandler(t *testing.T) {
+	fs, a, b := newPackageDir(t)
+	server := httptest.NewServer(Handler(fs, "/crxs", "", logging.Discard))
+	defer server.Close()
+
+	// Without checks every package is offered
+	resp, body := get(t, server.URL+ManifestPath)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/xml") {
+		t.Fatalf("GET %s = %d %s", ManifestPath, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	m, err := ParseManifest([]byte(body))
+	if err != nil || len(m.Apps) != 2 {
+		t.Fatalf("manifest = %s, %v, want two apps", body, err)
+	}
+
+	// Chromium's update check, as sent for an installed and a missing extension
+	query := url.Values{"response": {"updatecheck"}}
+	query.Add("x", url.Values{"id": {testID(a)}, "v": {"1.9"}}.Encode()+"&uc")
+	query.Add("x", url.Values{"id": {testID(b)}, "v": {"3.0"}}.Encode()+"&uc")
+	query.Add("x", url.Values{"id": {strings.Repeat("p", 32)}, "v": {""}}.Encode()+"&uc")
+	_, body = get(t, server.URL+ManifestPath+"?"+query.Encode())
+	if m, err = ParseManifest([]byte(body)); err != nil || len(m.Apps) != 3 {
+		t.Fatalf("update check response = %s, %v", body, err)
+	}
+
+	update := m.Apps[0].UpdateCheck
+	if m.Apps[0].ID != testID(a) || update == nil || update.Version != "1.10" || update.Codebase != server.URL+"/a-1.10.crx" {
+		t.Errorf("update for a = %+v %+v, want 1.10 from %s/a-1.10.crx", m.Apps[0], update, server.URL)
+	}
+	if noupdate := m.Apps[1].UpdateCheck; noupdate == nil || noupdate.Status != "noupdate" || noupdate.Codebase != "" {
+		t.Errorf("update for current b = %+v, want noupdate", noupdate)
+	}
+	if m.Apps[2].Status != "error-unknownApplication" || m.Apps[2].UpdateCheck != nil {
+		t.Errorf("update for unknown ID = %+v, want error-unknownApplication", m.Apps[2])
+	}
+
+	// The codebase serves the package itself
+	resp, body = get(t, update.Codebase)
+	want, _ := fs.ReadFile("/crxs/a-1.10.crx")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != CRXContentType || body != string(want) {
+		t.Errorf("GET codebase = %d %s, %d bytes", resp.StatusCode, resp.Header.Get("Content-Type"), len(body))
+	}
+
+	for _, path := range []string{"/notes.txt", "/broken.crx", "/sub.crx", "/../crxs/a-1.0.crx"} {
+		if resp, _ := get(t, server.URL+path); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Post(server.URL+ManifestPath, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestHandlerBaseURL(t *testing.T) {
+	fs, _, _ := newPackageDir(t)
+	server := httptest.NewServer(Handler(fs, "/crxs", "https://cdn.example.com/crxs", logging.Discard))
+	defer server.Close()
+
+	_, body := get(t, server.URL+ManifestPath)
+	if !strings.Contains(body, `codebase="https://cdn.example.com/crxs/a-1.10.crx"`) {
+		t.Errorf("manifest = %s, want codebases below the base URL", body)
+	}
+}
+
+func TestHandlerReindexesOnPackageChange(t *testing.T) {
+	fs, a, _ := newPackageDir(t)
+	server := httptest.NewServer(Handler(fs, "/crxs", "", logging.Discard))
+	defer server.Close()
+
+	versionOfA := func() (string, int) {
+		t.Helper()
+		_, body := get(t, server.URL+ManifestPath)
+		m, err := ParseManifest([]byte(body))
+		if err != nil {
+			t.Fatalf("manifest = %s, %v", body, err)
+		}
+		for _, app := range m.Apps {
+			if app.ID == testID(a) && app.UpdateCheck != nil {
+				return app.UpdateCheck.Version, len(m.Apps)
+			}
+		}
+		return "", len(m.Apps)
+	}
+	versionOfA()
+
+	// Rewriting a file in place leaves the directory untouched, but the
+	// file itself changed, so the new version is offered
+	fs.WriteFile("/crxs/a-1.10.crx", testPackage(t, a, "A", "2.0"), 0644)
+	if version, apps := versionOfA(); version != "2.0" || apps != 2 {
+		t.Errorf("after an in-place rewrite A = %s of %d apps, want 2.0 of 2", version, apps)
+	}
+
+	// A rewrite that breaks the package drops it
+	fs.WriteFile("/crxs/a-1.10.crx", []byte("Cr24 not really"), 0644)
+	if version, apps := versionOfA(); version != "1.9" || apps != 2 {
+		t.Errorf("after a broken rewrite A = %s of %d apps, want 1.9 of 2", version, apps)
+	}
+
+	// Adding a package rebuilds the index
+	fs.WriteFile("/crxs/c.crx", testPackage(t, newTestKey(t), "C", "1.0"), 0644)
+	if version, apps := versionOfA(); version != "1.9" || apps != 3 {
+		t.Errorf("after adding a package A = %s of %d apps, want 1.9 of 3", version, apps)
+	}
+}
@@ -2,14 +2,21 @@ package utils
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
 )
 
 // DirExists checks if a directory exists
-func DirExists(dirPath string) bool {
-	info, err := os.Stat(dirPath)
+func DirExists(fs fsys.FS, dirPath string) bool {
+	info, err := fs.Stat(dirPath)
 	if os.IsNotExist(err) {
 		return false
 	}
@@ -17,18 +24,18 @@ func DirExists(dirPath string) bool {
 }
 
 // CopyRecursiveSync copies files and directories recursively
-func CopyRecursiveSync(src, dest string) error {
-	srcInfo, err := os.Stat(src)
+func CopyRecursiveSync(fs fsys.FS, src, dest string) error {
+	srcInfo, err := fs.Stat(src)
 	if err != nil {
 		return err
 	}
 
 	if srcInfo.IsDir() {
-		if err := os.MkdirAll(dest, 0755); err != nil {
+		if err := fs.MkdirAll(dest, 0755); err != nil {
 			return err
 		}
 
-		entries, err := os.ReadDir(src)
+		entries, err := fs.ReadDir(src)
 		if err != nil {
 			return err
 		}
@@ -36,69 +43,143 @@ func CopyRecursiveSync(src, dest string) error {
 		for _, entry := range entries {
 			srcFile := filepath.Join(src, entry.Name())
 			destFile := filepath.Join(dest, entry.Name())
-			if err := CopyRecursiveSync(srcFile, destFile); err != nil {
+			if err := CopyRecursiveSync(fs, srcFile, destFile); err != nil {
 				return err
 			}
 		}
 	} else {
-		srcFile, err := os.Open(src)
+		data, err := fs.ReadFile(src)
 		if err != nil {
 			return err
 		}
-		defer srcFile.Close()
+		return fs.WriteFile(dest, data, srcInfo.Mode().Perm())
+	}
 
-		destFile, err := os.Create(dest)
-		if err != nil {
-			return err
-		}
-		defer destFile.Close()
+	return nil
+}
 
-		_, err = io.Copy(destFile, srcFile)
+// UnzipFile extracts a zip file to a destination directory
+func UnzipFile(ctx context.Context, fs fsys.FS, zipPath, destPath string) error {
+	data, err := fs.ReadFile(zipPath)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return UnzipBytes(ctx, fs, data, destPath)
 }
 
-// UnzipFile extracts a zip file to a destination directory
-func UnzipFile(zipPath, destPath string) error {
-	reader, err := zip.OpenReader(zipPath)
+// UnzipBytes extracts an in-memory zip archive to a destination directory.
+// Extraction stops with ctx's error once ctx is done; files already written are left for the caller to remove.
+func UnzipBytes(ctx context.Context, fs fsys.FS, data []byte, destPath string) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
 
+	return extractZip(ctx, fs, reader, destPath)
+}
+
+func extractZip(ctx context.Context, fs fsys.FS, reader *zip.Reader, destPath string) error {
 	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		filePath := filepath.Join(destPath, file.Name)
+		if !strings.HasPrefix(filePath, filepath.Clean(destPath)+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal file path in archive: %s", file.Name)
+		}
 
 		if file.FileInfo().IsDir() {
-			os.MkdirAll(filePath, os.ModePerm)
+			fs.MkdirAll(filePath, os.ModePerm)
 			continue
 		}
 
-		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		if err := fs.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
 			return err
 		}
 
-		outFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
+		rc, err := file.Open()
 		if err != nil {
 			return err
 		}
 
-		rc, err := file.Open()
+		data, err := io.ReadAll(contextReader{ctx: ctx, r: rc})
+		rc.Close()
 		if err != nil {
-			outFile.Close()
 			return err
 		}
 
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
-		rc.Close()
+		if err := fs.WriteFile(filePath, data, file.Mode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// zipModTime is stored for every entry written by ZipDirectory, so the same files always zip to the same bytes
+var zipModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ZipDirectory returns a zip archive of the files below dir with forward-slash names in sorted order.
+// Hidden files and directories (starting with ".") are left out, as Chromium does when packing.
+func ZipDirectory(fs fsys.FS, dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	if err := zipDir(fs, writer, dir, ""); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func zipDir(fs fsys.FS, writer *zip.Writer, dir, prefix string) error {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		name := prefix + entry.Name()
+		if entry.IsDir() {
+			if err := zipDir(fs, writer, path, name+"/"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, err := fs.ReadFile(path)
 		if err != nil {
 			return err
 		}
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: zipModTime})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// contextReader fails reads once ctx is done, so copying a large entry stops promptly
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -2,9 +2,14 @@ package utils
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/yinxulai/chromium-extension-installer/internal/fsys"
 )
 
 func TestDirExists(t *testing.T) {
@@ -43,7 +48,7 @@ func TestDirExists(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			path := tt.setup()
-			result := DirExists(path)
+			result := DirExists(fsys.OS{}, path)
 			if result != tt.expected {
 				t.Errorf("DirExists(%q) = %v, want %v", path, result, tt.expected)
 			}
@@ -91,7 +96,7 @@ func TestCopyRecursiveSync(t *testing.T) {
 
 			tt.setup(srcDir)
 
-			err := CopyRecursiveSync(srcDir, destDir)
+			err := CopyRecursiveSync(fsys.OS{}, srcDir, destDir)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CopyRecursiveSync() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -114,7 +119,7 @@ func TestUnzipFile(t *testing.T) {
 	zipFile.Close()
 
 	destDir := filepath.Join(tempDir, "extracted")
-	err = UnzipFile(zipPath, destDir)
+	err = UnzipFile(context.Background(), fsys.OS{}, zipPath, destDir)
 	if err != nil {
 		t.Fatalf("UnzipFile() error = %v", err)
 	}
@@ -129,3 +134,98 @@ func TestUnzipFile(t *testing.T) {
 		t.Errorf("Content mismatch: got %q, want %q", string(content), "test content")
 	}
 }
+
+func TestUnzipBytes(t *testing.T) {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	fileWriter, _ := zipWriter.Create("dir/test.txt")
+	fileWriter.Write([]byte("test content"))
+	zipWriter.Close()
+
+	destDir := t.TempDir()
+	if err := UnzipBytes(context.Background(), fsys.OS{}, buf.Bytes(), destDir); err != nil {
+		t.Fatalf("UnzipBytes() error = %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(destDir, "dir", "test.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read extracted file: %v", err)
+	}
+	if string(content) != "test content" {
+		t.Errorf("Content mismatch: got %q, want %q", string(content), "test content")
+	}
+
+	if err := UnzipBytes(context.Background(), fsys.OS{}, []byte("not a zip"), destDir); err == nil {
+		t.Error("UnzipBytes() should return error for invalid archive")
+	}
+}
+
+func TestUnzipBytesRejectsPathTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	fileWriter, _ := zipWriter.Create("../evil.txt")
+	fileWriter.Write([]byte("evil"))
+	zipWriter.Close()
+
+	destDir := filepath.Join(t.TempDir(), "dest")
+	if err := UnzipBytes(context.Background(), fsys.OS{}, buf.Bytes(), destDir); err == nil {
+		t.Error("UnzipBytes() should reject entries outside the destination")
+	}
+}
+
+func TestUnzipBytesCanceled(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.Create("big.bin")
+	f.Write(bytes.Repeat([]byte{0}, 1<<20))
+	w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mem := fsys.NewMemory()
+	if err := UnzipBytes(ctx, mem, buf.Bytes(), "/tmp/out"); err != context.Canceled {
+		t.Fatalf("UnzipBytes() error = %v, want context.Canceled", err)
+	}
+	if fsys.Exists(mem, "/tmp/out/big.bin") {
+		t.Error("UnzipBytes() wrote a file after cancellation")
+	}
+}
+
+func TestZipDirectory(t *testing.T) {
+	fs := fsys.NewMemory()
+	fs.MkdirAll("/ext/js", 0755)
+	fs.MkdirAll("/ext/.git", 0755)
+	fs.WriteFile("/ext/manifest.json", []byte("{}"), 0644)
+	fs.WriteFile("/ext/js/b.js", []byte("b"), 0644)
+	fs.WriteFile("/ext/js/a.js", []byte("a"), 0644)
+	fs.WriteFile("/ext/.DS_Store", []byte("hidden"), 0644)
+	fs.WriteFile("/ext/.git/config", []byte("hidden"), 0644)
+
+	data, err := ZipDirectory(fs, "/ext")
+	if err != nil {
+		t.Fatalf("ZipDirectory() error = %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ZipDirectory() did not return a zip archive: %v", err)
+	}
+
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	want := []string{"js/a.js", "js/b.js", "manifest.json"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("ZipDirectory() entries = %v, want %v", names, want)
+	}
+
+	again, _ := ZipDirectory(fs, "/ext")
+	if !bytes.Equal(data, again) {
+		t.Error("ZipDirectory() is not deterministic")
+	}
+
+	if _, err := ZipDirectory(fs, "/missing"); err == nil {
+		t.Error("ZipDirectory() of a missing directory should fail")
+	}
+}
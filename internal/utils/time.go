@@ -0,0 +1,17 @@
+package utils
+
+import "time"
+
+// chromiumEpoch is the start of Chromium's time base, 1601-01-01 UTC
+var chromiumEpoch = time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ToChromiumTime converts a time to microseconds since 1601-01-01 UTC
+func ToChromiumTime(t time.Time) int64 {
+	// time.Sub saturates after ~292 years, so offset from the Unix epoch instead
+	return t.UnixMicro() - chromiumEpoch.UnixMicro()
+}
+
+// FromChromiumTime converts microseconds since 1601-01-01 UTC to a time
+func FromChromiumTime(us int64) time.Time {
+	return time.UnixMicro(us + chromiumEpoch.UnixMicro()).UTC()
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToChromiumTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected int64
+	}{
+		{
+			name:     "Chromium epoch",
+			time:     time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC),
+			expected: 0,
+		},
+		{
+			name:     "Unix epoch",
+			time:     time.Unix(0, 0),
+			expected: 11644473600000000,
+		},
+		{
+			name:     "Microsecond precision",
+			time:     time.Date(2024, 1, 2, 3, 4, 5, 6007000, time.UTC),
+			expected: 13348638245006007,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ToChromiumTime(tt.time)
+			if result != tt.expected {
+				t.Errorf("ToChromiumTime() = %d, want %d", result, tt.expected)
+			}
+			if back := FromChromiumTime(result); !back.Equal(tt.time) {
+				t.Errorf("FromChromiumTime() = %v, want %v", back, tt.time)
+			}
+		})
+	}
+}